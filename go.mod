@@ -14,12 +14,12 @@ require (
 	github.com/fatih/structs v1.1.0
 	github.com/fortytw2/leaktest v1.3.0
 	github.com/gofrs/uuid v4.0.0+incompatible
-	github.com/golang/groupcache v0.0.0-20200121045136-8c9f03a8e57e // indirect
+	github.com/golang/groupcache v0.0.0-20200121045136-8c9f03a8e57e
 	github.com/google/btree v1.0.1
 	github.com/hashicorp/errwrap v1.1.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
 	github.com/hokaccha/go-prettyjson v0.0.0-20210113012101-fb4e108d2519
-	github.com/jackpal/bencode-go v1.0.0 // indirect
+	github.com/jackpal/bencode-go v1.0.0
 	github.com/jroimartin/gocui v0.4.0
 	github.com/juju/ratelimit v1.0.1
 	github.com/klauspost/cpuid/v2 v2.0.6 // indirect
@@ -27,7 +27,7 @@ require (
 	github.com/mattn/go-runewidth v0.0.10 // indirect
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/multiformats/go-multihash v0.0.15
-	github.com/nictuku/dht v0.0.0-20201226073453-fd1c1dd3d66a
+	github.com/nictuku/nettools v0.0.0-20150117095333-8867a2107ad3
 	github.com/nsf/termbox-go v1.1.0 // indirect
 	github.com/powerman/rpc-codec v1.2.2
 	github.com/prometheus/client_golang v1.1.0 // indirect
@@ -42,7 +42,7 @@ require (
 	github.com/youtube/vitess v3.0.0-rc.3+incompatible // indirect
 	github.com/zeebo/bencode v1.0.0
 	go.etcd.io/bbolt v1.3.5
-	golang.org/x/crypto v0.0.0-20210322153248-0c34fe9e7dc2 // indirect
+	golang.org/x/crypto v0.0.0-20210322153248-0c34fe9e7dc2
 	golang.org/x/sys v0.0.0-20210330210617-4fbd30eecc44
 	gopkg.in/yaml.v2 v2.4.0
 )
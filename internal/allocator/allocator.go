@@ -1,6 +1,8 @@
 package allocator
 
 import (
+	"os"
+
 	"github.com/cenkalti/rain/internal/metainfo"
 	"github.com/cenkalti/rain/internal/storage"
 )
@@ -19,7 +21,10 @@ type Allocator struct {
 // File on the disk.
 type File struct {
 	Storage storage.File
-	Name    string
+	// Path of the file in storage. It may be different than the path in torrent if the file is renamed.
+	Name string
+	// State of the file before it is opened by the Allocator. Nil if the file did not exist.
+	Stat os.FileInfo
 }
 
 // Progress about the allocation.
@@ -42,7 +47,8 @@ func (a *Allocator) Close() {
 }
 
 // Run the Allocator.
-func (a *Allocator) Run(info *metainfo.Info, sto storage.Storage, progressC chan Progress, resultC chan *Allocator) {
+// Files are opened in sto with the paths given in files.
+func (a *Allocator) Run(files []metainfo.File, sto storage.Storage, progressC chan Progress, resultC chan *Allocator) {
 	defer close(a.doneC)
 
 	defer func() {
@@ -60,15 +66,34 @@ func (a *Allocator) Run(info *metainfo.Info, sto storage.Storage, progressC chan
 	}()
 
 	var allocatedSize int64
-	a.Files = make([]File, len(info.Files))
-	for i, f := range info.Files {
+	a.Files = make([]File, len(files))
+	for i, f := range files {
+		if !f.Stored() {
+			// Padding files and symlinks are not saved on disk.
+			a.Files[i] = File{Storage: zeroFile{}, Name: f.Path}
+			allocatedSize += f.Length
+			a.sendProgress(progressC, allocatedSize)
+			continue
+		}
+		// Stat before opening because Open may change the size of the file.
+		fi, err := sto.Stat(f.Path)
+		if err != nil && !os.IsNotExist(err) {
+			a.Error = err
+			return
+		}
 		var sf storage.File
 		var exists bool
 		sf, exists, a.Error = sto.Open(f.Path, f.Length)
 		if a.Error != nil {
 			return
 		}
-		a.Files[i] = File{Storage: sf, Name: f.Path}
+		a.Files[i] = File{Storage: sf, Name: f.Path, Stat: fi}
+		if f.Executable || f.Hidden {
+			a.Error = sto.SetAttributes(f.Path, f.Executable, f.Hidden)
+			if a.Error != nil {
+				return
+			}
+		}
 		if exists {
 			a.HasExisting = true
 		} else {
@@ -79,6 +104,25 @@ func (a *Allocator) Run(info *metainfo.Info, sto storage.Storage, progressC chan
 	}
 }
 
+// zeroFile is used in place of the files that are not saved on disk.
+// Reads return zeros and writes are discarded.
+type zeroFile struct{}
+
+func (zeroFile) ReadAt(p []byte, off int64) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func (zeroFile) WriteAt(p []byte, off int64) (int, error) {
+	return len(p), nil
+}
+
+func (zeroFile) Close() error {
+	return nil
+}
+
 func (a *Allocator) sendProgress(progressC chan Progress, size int64) {
 	select {
 	case progressC <- Progress{AllocatedSize: size}:
@@ -169,3 +169,64 @@ func TestEncrypted(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestDialSimultaneous(t *testing.T) {
+	l1, err := Listen(0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l1.Close()
+	l2, err := Listen(0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l2.Close()
+	port1 := l1.Addr().(*net.TCPAddr).Port
+	port2 := l2.Addr().(*net.TCPAddr).Port
+	done := make(chan struct{})
+	var gerr error
+	go func() {
+		defer close(done)
+		conn, ext, id, err2 := DialSimultaneous(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port2}, port1, 10*time.Second, 10*time.Second, ext1, infoHash, id1, nil)
+		if err2 != nil {
+			gerr = err2
+			return
+		}
+		if port := conn.LocalAddr().(*net.TCPAddr).Port; port != port1 {
+			t.Errorf("local port: %d", port)
+		}
+		if ext != ext2 {
+			t.Errorf("ext: %s", ext)
+		}
+		if id != id2 {
+			t.Errorf("id: %s", id)
+		}
+	}()
+	conn, err := l2.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port := conn.RemoteAddr().(*net.TCPAddr).Port; port != port1 {
+		t.Errorf("remote port: %d", port)
+	}
+	_, cipher, ext, id, ih, err := Accept(conn, 10*time.Second, nil, false, func(ih [20]byte) bool { return ih == infoHash }, ext2, id2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if gerr != nil {
+		t.Fatal(gerr)
+	}
+	if cipher != 0 {
+		t.Errorf("cipher: %d", cipher)
+	}
+	if ext != ext1 {
+		t.Errorf("ext: %s", ext)
+	}
+	if ih != infoHash {
+		t.Errorf("ih: %s", ih)
+	}
+	if id != id1 {
+		t.Errorf("id: %s", id)
+	}
+}
@@ -0,0 +1,11 @@
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly,!windows
+
+package btconn
+
+import (
+	"syscall"
+)
+
+func reuseAddr(network, address string, c syscall.RawConn) error {
+	return nil
+}
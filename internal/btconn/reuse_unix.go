@@ -0,0 +1,24 @@
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package btconn
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func reuseAddr(network, address string, c syscall.RawConn) error {
+	var err error
+	cerr := c.Control(func(fd uintptr) {
+		err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1)
+		if err != nil {
+			return
+		}
+		err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if cerr != nil {
+		return cerr
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+package btconn
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/cenkalti/rain/internal/logger"
+)
+
+// Listen on the TCP port for incoming connections.
+// If reuse is true, the port can be shared with the connections made by DialSimultaneous.
+// Sockets must set the reuse options on both sides, so other processes may bind the same port too.
+// Otherwise a plain listener is returned.
+func Listen(port int, reuse bool) (*net.TCPListener, error) {
+	addr := &net.TCPAddr{Port: port}
+	if !reuse {
+		return net.ListenTCP("tcp4", addr)
+	}
+	lc := net.ListenConfig{Control: reuseAddr}
+	l, err := lc.Listen(context.Background(), "tcp4", addr.String())
+	if err != nil {
+		return nil, err
+	}
+	return l.(*net.TCPListener), nil
+}
+
+// DialSimultaneous connects to the address from the local port while the remote peer is connecting to us at the same time.
+// This is called TCP simultaneous open and allows connecting to a peer behind NAT after a holepunch rendezvous.
+// It is even more useful with UDP based transports because NATs handle UDP traffic in a similar way.
+// Since both sides act as the initiator, only the unencrypted BitTorrent handshake is done.
+// Refused connections are tried again until dial timeout because the remote peer may not have started connecting yet.
+func DialSimultaneous(
+	addr *net.TCPAddr,
+	localPort int,
+	dialTimeout, handshakeTimeout time.Duration,
+	ourExtensions [8]byte,
+	ih [20]byte,
+	ourID [20]byte,
+	stopC chan struct{}) (
+	conn net.Conn, peerExtensions [8]byte, peerID [20]byte, err error) {
+	log := logger.New("conn <> " + addr.String())
+	done := make(chan struct{})
+	defer close(done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-stopC:
+			cancel()
+		case <-done:
+		}
+	}()
+
+	log.Debug("Connecting to peer simultaneously...")
+	dialer := net.Dialer{
+		Deadline:  time.Now().Add(dialTimeout),
+		LocalAddr: &net.TCPAddr{Port: localPort},
+		Control:   reuseAddr,
+	}
+	for {
+		conn, err = dialer.DialContext(ctx, "tcp4", addr.String())
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.ECONNREFUSED) || time.Now().After(dialer.Deadline) {
+			return
+		}
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-stopC:
+			return
+		}
+	}
+	log.Debug("Connected")
+	defer func(conn net.Conn) {
+		if err != nil {
+			conn.Close()
+		}
+	}(conn)
+	go func(conn net.Conn) {
+		select {
+		case <-stopC:
+			conn.Close()
+		case <-done:
+		}
+	}(conn)
+
+	// Handshake must be completed in allowed duration.
+	if err = conn.SetDeadline(time.Now().Add(handshakeTimeout)); err != nil {
+		return
+	}
+
+	// Both sides send the handshake without waiting for the other side.
+	out := bytes.NewBuffer(make([]byte, 0, 68))
+	err = writeHandshake(out, ih, ourID, ourExtensions)
+	if err != nil {
+		return
+	}
+	_, err = conn.Write(out.Bytes())
+	if err != nil {
+		return
+	}
+
+	var ihRead [20]byte
+	peerExtensions, ihRead, err = readHandshake1(conn)
+	if err != nil {
+		return
+	}
+	if ihRead != ih {
+		err = errInvalidInfoHash
+		return
+	}
+
+	peerID, err = readHandshake2(conn)
+	if err != nil {
+		return
+	}
+	if peerID == ourID {
+		err = errOwnConnection
+		return
+	}
+	return
+}
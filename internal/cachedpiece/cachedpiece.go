@@ -51,3 +51,22 @@ func (c *CachedPiece) ReadAt(p []byte, off int64) (n int, err error) {
 	begin := off - int64(blkBegin)
 	return copy(p, buf[begin:]), nil
 }
+
+// Cached returns the indexes of pieces that have blocks in the cache. Recently accessed pieces come first.
+func Cached(cache *piececache.Cache, peerID [20]byte) []uint32 {
+	keys := cache.Keys(string(peerID[:]))
+	seen := make(map[uint32]struct{}, len(keys))
+	indexes := make([]uint32, 0, len(keys))
+	for _, key := range keys {
+		if len(key) != 20+4+4 {
+			continue
+		}
+		index := binary.BigEndian.Uint32([]byte(key[20:24]))
+		if _, ok := seen[index]; ok {
+			continue
+		}
+		seen[index] = struct{}{}
+		indexes = append(indexes, index)
+	}
+	return indexes
+}
@@ -1,6 +1,7 @@
 package console
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -23,6 +24,9 @@ const (
 	help
 )
 
+// Duration of showing the error from removing the files of a torrent.
+const removeDataErrorDuration = 5 * time.Second
+
 const (
 	// tabs
 	general int = iota
@@ -47,6 +51,9 @@ type Console struct {
 	errDetails error
 	// error from getting session stats
 	errSessionStats error
+	// error from removing the files of the last removed torrent. Shown in place of the header for a while.
+	errRemoveData   error
+	errRemoveDataAt time.Time
 
 	// id of currently selected torrent
 	selectedID string
@@ -156,8 +163,10 @@ func (c *Console) keybindings(g *gocui.Gui) {
 	_ = g.SetKeybinding("torrents", gocui.KeyCtrlS, gocui.ModNone, c.startTorrent)
 	_ = g.SetKeybinding("torrents", gocui.KeyCtrlS, gocui.ModAlt, c.stopTorrent)
 	_ = g.SetKeybinding("torrents", gocui.KeyCtrlR, gocui.ModNone, c.removeTorrent)
+	_ = g.SetKeybinding("torrents", gocui.KeyCtrlR, gocui.ModAlt, c.removeTorrentKeepData)
 	_ = g.SetKeybinding("torrents", gocui.KeyCtrlA, gocui.ModAlt, c.announce)
 	_ = g.SetKeybinding("torrents", gocui.KeyCtrlV, gocui.ModNone, c.verify)
+	_ = g.SetKeybinding("torrents", gocui.KeyCtrlU, gocui.ModNone, c.toggleSuperSeeding)
 	_ = g.SetKeybinding("torrents", gocui.KeyCtrlA, gocui.ModNone, c.switchAddTorrent)
 	_ = g.SetKeybinding("add-torrent", gocui.KeyEnter, gocui.ModNone, c.addTorrentHandleEnter)
 }
@@ -299,8 +308,10 @@ func (c *Console) drawHelp(g *gocui.Gui) error {
 	fmt.Fprintln(v, "    ctrl+s  Start torrent")
 	fmt.Fprintln(v, "ctrl+alt+s  Stop torrent")
 	fmt.Fprintln(v, "    ctrl+R  Remove torrent")
+	fmt.Fprintln(v, "ctrl+alt+r  Remove torrent but keep its files")
 	fmt.Fprintln(v, "ctrl+alt+a  Announce torrent")
 	fmt.Fprintln(v, "    ctrl+v  Verify torrent")
+	fmt.Fprintln(v, "    ctrl+u  Toggle super-seeding")
 	fmt.Fprintln(v, "    ctrl+a  Add new torrent")
 
 	return nil
@@ -457,13 +468,21 @@ func (c *Console) drawTorrents(g *gocui.Gui) error {
 	if split <= 0 {
 		return nil
 	}
-	if v, err := g.SetView("torrents-header", -1, 0, maxX, split); err != nil {
+	hv, err := g.SetView("torrents-header", -1, 0, maxX, split)
+	if err != nil {
 		if err != gocui.ErrUnknownView {
 			return err
 		}
-		v.Frame = false
-
-		fmt.Fprint(v, getHeader(c.columns))
+		hv.Frame = false
+	}
+	hv.Clear()
+	if c.errRemoveData != nil && time.Since(c.errRemoveDataAt) > removeDataErrorDuration {
+		c.errRemoveData = nil
+	}
+	if c.errRemoveData != nil {
+		fmt.Fprintln(hv, "error:", c.errRemoveData)
+	} else {
+		fmt.Fprint(hv, getHeader(c.columns))
 	}
 	if split <= 1 {
 		return nil
@@ -929,14 +948,41 @@ func (c *Console) removeTorrent(g *gocui.Gui, v *gocui.View) error {
 	id := c.selectedID
 	c.m.Unlock()
 
-	err := c.client.RemoveTorrent(id)
+	resp, err := c.client.RemoveTorrentWithOptions(id, nil)
 	if err != nil {
 		return err
 	}
+	c.setRemoveDataError(resp)
 	c.triggerUpdateTorrents()
 	return nil
 }
 
+func (c *Console) removeTorrentKeepData(g *gocui.Gui, v *gocui.View) error {
+	c.m.Lock()
+	id := c.selectedID
+	c.m.Unlock()
+
+	resp, err := c.client.RemoveTorrentWithOptions(id, &rainrpc.RemoveTorrentOptions{KeepData: true})
+	if err != nil {
+		return err
+	}
+	c.setRemoveDataError(resp)
+	c.triggerUpdateTorrents()
+	return nil
+}
+
+// setRemoveDataError saves the error of removing torrent files to show it to the user.
+// The error of the previous removal is cleared.
+func (c *Console) setRemoveDataError(resp *rpctypes.RemoveTorrentResponse) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.errRemoveData = nil
+	if resp.DataError != "" {
+		c.errRemoveData = errors.New("torrent is removed but its files are not: " + resp.DataError)
+		c.errRemoveDataAt = time.Now()
+	}
+}
+
 func (c *Console) setSelectedID(id string) {
 	changed := id != c.selectedID
 	c.selectedID = id
@@ -997,6 +1043,23 @@ func (c *Console) verify(g *gocui.Gui, v *gocui.View) error {
 	return nil
 }
 
+func (c *Console) toggleSuperSeeding(g *gocui.Gui, v *gocui.View) error {
+	c.m.Lock()
+	id := c.selectedID
+	c.m.Unlock()
+
+	stats, err := c.client.GetTorrentStats(id)
+	if err != nil {
+		return err
+	}
+	err = c.client.SetTorrentSuperSeeding(id, !stats.SuperSeeding)
+	if err != nil {
+		return err
+	}
+	c.triggerUpdateDetails(true)
+	return nil
+}
+
 func (c *Console) tabAdjustDown(g *gocui.Gui, v *gocui.View) error {
 	_, maxY := g.Size()
 	halfY := maxY / 2
@@ -1089,7 +1152,7 @@ func (c *Console) triggerUpdateTorrents() {
 
 func flags(p rpctypes.Peer) string {
 	var sb strings.Builder
-	sb.Grow(6)
+	sb.Grow(7)
 	if p.ClientInterested {
 		if p.PeerChoking {
 			sb.WriteString("d")
@@ -1135,6 +1198,8 @@ func flags(p rpctypes.Peer) string {
 		sb.WriteString("I")
 	case "MANUAL":
 		sb.WriteString("M")
+	case "HOLEPUNCH":
+		sb.WriteString("P")
 	default:
 		sb.WriteString(" ")
 	}
@@ -1146,6 +1211,11 @@ func flags(p rpctypes.Peer) string {
 	default:
 		sb.WriteString(" ")
 	}
+	if p.UploadOnly {
+		sb.WriteString("o")
+	} else {
+		sb.WriteString(" ")
+	}
 	return sb.String()
 }
 
@@ -1157,6 +1227,8 @@ func getProgress(stats *rpctypes.Stats) int {
 			progress = int(stats.Pieces.Checked * 100 / stats.Pieces.Total)
 		case "Allocating":
 			progress = int(stats.Bytes.Allocated * 100 / stats.Bytes.Total)
+		case "Moving":
+			progress = int(stats.Bytes.Moved * 100 / stats.Bytes.Total)
 		default:
 			progress = int(stats.Pieces.Have * 100 / stats.Pieces.Total)
 		}
@@ -1201,10 +1273,20 @@ func getETA(stats *rpctypes.Stats) string {
 	return eta
 }
 
+func getLastScrub(stats *rpctypes.Stats) string {
+	if stats.Scrub.LastPass.IsZero() {
+		return "never"
+	}
+	return stats.Scrub.LastPass.Format(time.RFC3339)
+}
+
 // FormatStats returns the human readable representation of torrent stats object.
 func FormatStats(stats *rpctypes.Stats, v io.Writer) {
 	fmt.Fprintf(v, "Name: %s\n", stats.Name)
 	fmt.Fprintf(v, "Private: %v\n", stats.Private)
+	if stats.SuperSeeding {
+		fmt.Fprintln(v, "Super-seeding: enabled")
+	}
 	status := stats.Status
 	if status == "Stopped" && stats.Error != "" {
 		status = status + ": " + stats.Error
@@ -1217,6 +1299,15 @@ func FormatStats(stats *rpctypes.Stats, v io.Writer) {
 	fmt.Fprintf(v, "Download speed: %11s\n", getDownloadSpeed(stats))
 	fmt.Fprintf(v, "Upload speed:   %11s\n", getUploadSpeed(stats))
 	fmt.Fprintf(v, "ETA: %s\n", getETA(stats))
+	if stats.Scrub.Running || !stats.Scrub.LastPass.IsZero() {
+		fmt.Fprintf(v, "Scrub: %d/%d checked, %d failed, last pass: %s\n", stats.Scrub.Checked, stats.Pieces.Total, stats.Scrub.Failed, getLastScrub(stats))
+	}
+	if h := stats.Holepunch; h.Requested > 0 || h.Relayed > 0 || h.Succeeded > 0 || h.Failed > 0 {
+		fmt.Fprintf(v, "Holepunch: %d requested, %d relayed, %d succeeded, %d failed\n", h.Requested, h.Relayed, h.Succeeded, h.Failed)
+	}
+	if len(stats.ModifiedFiles) > 0 {
+		fmt.Fprintf(v, "Modified files: %s\n", strings.Join(stats.ModifiedFiles, ", "))
+	}
 }
 
 // FormatSessionStats returns the human readable representation of session stats object.
@@ -1227,5 +1318,24 @@ func FormatSessionStats(s *rpctypes.SessionStats, v io.Writer) {
 	fmt.Fprintf(v, "Writes: %d/s, %dKB/s, Active: %d, Pending: %d\n", s.WritesPerSecond, s.SpeedWrite/1024, s.WritesActive, s.WritesPending)
 	fmt.Fprintf(v, "ReadCache Objects: %d, Size: %dMB, Utilization: %d%%\n", s.ReadCacheObjects, s.ReadCacheSize/(1<<20), s.ReadCacheUtilization)
 	fmt.Fprintf(v, "WriteCache Objects: %d, Size: %dMB, PendingKeys: %d\n", s.WriteCacheObjects, s.WriteCacheSize/(1<<20), s.WriteCachePendingKeys)
+	fmt.Fprintf(v, "FilePool Open: %d, Hits: %d/s, Misses: %d/s\n", s.FilePoolOpenFiles, s.FilePoolHits, s.FilePoolMisses)
 	fmt.Fprintf(v, "DownloadSpeed: %dKB/s, UploadSpeed: %dKB/s\n", s.SpeedDownload/1024, s.SpeedUpload/1024)
 }
+
+// FormatDHTStats returns the human readable representation of DHT stats object.
+func FormatDHTStats(s *rpctypes.DHTStats, v io.Writer) {
+	fmt.Fprintln(v, "IPv4:")
+	formatDHTTableStats(&s.IPv4, v)
+	if s.IPv6 != nil {
+		fmt.Fprintln(v, "IPv6:")
+		formatDHTTableStats(s.IPv6, v)
+	}
+}
+
+func formatDHTTableStats(s *rpctypes.DHTTableStats, v io.Writer) {
+	fmt.Fprintf(v, "  NodeID: %s\n", s.NodeID)
+	fmt.Fprintf(v, "  Nodes: %d, Reachable: %d\n", s.Nodes, s.ReachableNodes)
+	for _, b := range s.Buckets {
+		fmt.Fprintf(v, "  Bucket %3d: %d nodes, %d reachable\n", b.Prefix, b.Nodes, b.ReachableNodes)
+	}
+}
@@ -0,0 +1,19 @@
+// Copyright 2011 Yves Junqueira. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dht
+
+import (
+	"testing"
+)
+
+func BenchmarkArena(b *testing.B) {
+	b.StopTimer()
+	a := newArena(1024, 1000)
+
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		a.Push(a.Pop())
+	}
+}
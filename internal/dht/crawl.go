@@ -0,0 +1,335 @@
+package dht
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/golang/groupcache/lru"
+)
+
+// Indexing infohashes stored in DHT is described in BEP 51.
+// Nodes reply to sample_infohashes queries with a random sample of infohashes from their peer store.
+// A crawl queries the nodes in the routing table and keeps querying the nodes returned in responses.
+
+const (
+	// Maximum number of infohashes returned in a sample_infohashes response.
+	maxSamples = 20
+	// Maximum value of "interval" in sample_infohashes responses.
+	maxSampleInterval = 6 * time.Hour
+	// A node is not queried again in a crawl before this duration, even if it returns a shorter interval.
+	minCrawlInterval = 5 * time.Minute
+	// Nodes not responding to a sample_infohashes query are not queried again in a crawl for this duration.
+	crawlRetryPeriod = time.Hour
+	// Maximum number of nodes waiting to be queried in a crawl.
+	maxCrawlQueue = 10000
+	// Maximum number of discovered infohashes waiting to be received from Crawl.C.
+	maxCrawlPending = 10000
+	// Maximum number of nodes remembered for respecting their intervals.
+	maxCrawlNodes = 100000
+
+	defaultCrawlRate          = 10
+	defaultCrawlMaxInfoHashes = 100000
+)
+
+// CrawlConfig contains options for a crawl.
+type CrawlConfig struct {
+	// Number of sample_infohashes queries sent per second. Default value: 10.
+	Rate int
+	// Number of discovered infohashes remembered for filtering duplicates. Default value: 100000.
+	MaxInfoHashes int
+}
+
+// CrawlStats contains statistics about a crawl.
+type CrawlStats struct {
+	// Number of sample_infohashes queries sent.
+	Queried int
+	// Number of sample_infohashes responses received.
+	Responded int
+	// Number of unique infohashes discovered.
+	InfoHashes int
+	// Number of discovered infohashes dropped because Crawl.C is not read fast enough.
+	Dropped int
+}
+
+// Crawl discovers the infohashes in DHT by sending sample_infohashes queries to nodes (BEP 51).
+// Each node is queried once in the interval it returns in its response.
+type Crawl struct {
+	// C receives discovered infohashes. Each infohash is sent once.
+	// C is closed after the crawl is stopped.
+	C <-chan InfoHash
+
+	d     *DHT
+	rate  int
+	c     chan InfoHash
+	stopC chan struct{}
+	doneC chan struct{}
+	once  sync.Once
+
+	// Owned by the DHT loop.
+	queue  []crawlNode
+	queued map[string]struct{}
+	// Value is the time until the node must not be queried again.
+	next *lru.Cache
+	seen *lru.Cache
+
+	m        sync.Mutex
+	stats    CrawlStats
+	pending  []InfoHash
+	pendingC chan struct{}
+}
+
+type crawlNode struct {
+	f    *family
+	id   string
+	addr string
+}
+
+// Crawl starts a new crawl. Crawl must be stopped with Stop after the results are not needed anymore.
+func (d *DHT) Crawl(cfg CrawlConfig) *Crawl {
+	if cfg.Rate <= 0 {
+		cfg.Rate = defaultCrawlRate
+	}
+	if cfg.MaxInfoHashes <= 0 {
+		cfg.MaxInfoHashes = defaultCrawlMaxInfoHashes
+	}
+	c := &Crawl{
+		d:        d,
+		rate:     cfg.Rate,
+		c:        make(chan InfoHash),
+		stopC:    make(chan struct{}),
+		doneC:    make(chan struct{}),
+		queued:   make(map[string]struct{}),
+		next:     lru.New(maxCrawlNodes),
+		seen:     lru.New(cfg.MaxInfoHashes),
+		pendingC: make(chan struct{}, 1),
+	}
+	c.C = c.c
+	go c.run()
+	return c
+}
+
+// Stop the crawl. Queries are not sent anymore and C is closed.
+func (c *Crawl) Stop() {
+	c.once.Do(func() { close(c.stopC) })
+	<-c.doneC
+}
+
+// Stats returns statistics about the crawl.
+func (c *Crawl) Stats() CrawlStats {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.stats
+}
+
+func (c *Crawl) run() {
+	defer close(c.doneC)
+	defer close(c.c)
+	ticker := time.NewTicker(time.Second / time.Duration(c.rate))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			select {
+			case c.d.crawlRequest <- c:
+			case <-c.stopC:
+				return
+			case <-c.d.stop:
+				return
+			}
+		case <-c.pendingC:
+			c.m.Lock()
+			pending := c.pending
+			c.pending = nil
+			c.m.Unlock()
+			for _, ih := range pending {
+				select {
+				case c.c <- ih:
+				case <-c.stopC:
+					return
+				case <-c.d.stop:
+					return
+				}
+			}
+		case <-c.stopC:
+			return
+		case <-c.d.stop:
+			return
+		}
+	}
+}
+
+func (c *Crawl) stopped() bool {
+	select {
+	case <-c.stopC:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Crawl) allowed(addr string, now time.Time) bool {
+	t, ok := c.next.Get(addr)
+	return !ok || now.After(t.(time.Time))
+}
+
+func (c *Crawl) enqueue(n crawlNode) {
+	if len(c.queue) >= maxCrawlQueue {
+		return
+	}
+	if _, ok := c.queued[n.addr]; ok {
+		return
+	}
+	if !c.allowed(n.addr, time.Now()) {
+		return
+	}
+	c.queued[n.addr] = struct{}{}
+	c.queue = append(c.queue, n)
+}
+
+func (c *Crawl) addResults(samples string) {
+	var found []InfoHash
+	for i := 0; i+nodeIdLen <= len(samples); i += nodeIdLen {
+		ih := samples[i : i+nodeIdLen]
+		if _, ok := c.seen.Get(ih); ok {
+			continue
+		}
+		c.seen.Add(ih, nil)
+		found = append(found, InfoHash(ih))
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.stats.Responded++
+	c.stats.InfoHashes += len(found)
+	for _, ih := range found {
+		if len(c.pending) >= maxCrawlPending {
+			c.stats.Dropped++
+			continue
+		}
+		c.pending = append(c.pending, ih)
+	}
+	if len(c.pending) > 0 {
+		select {
+		case c.pendingC <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// crawlNext sends a sample_infohashes query to the next node in the queue of the crawl.
+// When the queue is empty, the nodes in the routing table are queried again after their intervals pass.
+func (d *DHT) crawlNext(c *Crawl) {
+	if c.stopped() {
+		return
+	}
+	if len(c.queue) == 0 {
+		for _, f := range d.families() {
+			nodes := f.routingTable.addresses
+			if len(nodes) == 0 {
+				for _, r := range d.routers(f) {
+					c.enqueue(crawlNode{f: f, id: r.id, addr: r.address.String()})
+				}
+				continue
+			}
+			for addr, r := range nodes {
+				c.enqueue(crawlNode{f: f, id: r.id, addr: addr})
+			}
+		}
+	}
+	now := time.Now()
+	for len(c.queue) > 0 {
+		n := c.queue[0]
+		c.queue = c.queue[1:]
+		delete(c.queued, n.addr)
+		if c.allowed(n.addr, now) {
+			d.sampleInfoHashesFrom(n, c)
+			return
+		}
+	}
+}
+
+func (d *DHT) sampleInfoHashesFrom(n crawlNode, c *Crawl) {
+	r, err := n.f.routingTable.getOrCreateNode(n.id, n.addr, n.f.proto)
+	if err != nil {
+		d.DebugLogger.Debugf("sampleInfoHashesFrom error: %v", err)
+		return
+	}
+	target, err := randNodeId()
+	if err != nil {
+		return
+	}
+	c.next.Add(n.addr, time.Now().Add(crawlRetryPeriod))
+	totalSentSampleInfoHashes.Add(1)
+	ty := "sample_infohashes"
+	transId := r.newQuery(ty)
+	r.pendingQueries[transId].crawl = c
+	queryArguments := map[string]interface{}{
+		"id":     n.f.nodeId,
+		"target": string(target),
+	}
+	if want := d.want(); want != nil {
+		queryArguments["want"] = want
+	}
+	query := queryMessage{transId, "q", ty, queryArguments}
+	d.DebugLogger.Debugf("DHT sending sample_infohashes. nodeID: %x@%v", r.id, r.address)
+	sendMsg(n.f.conn, r.address, query, d.DebugLogger)
+	c.m.Lock()
+	c.stats.Queried++
+	c.m.Unlock()
+}
+
+// Process another node's response to a sample_infohashes query.
+func (d *DHT) processSampleInfoHashesResults(f *family, node *remoteNode, resp responseType) {
+	totalRecvSampleInfoHashesReply.Add(1)
+	query := node.pendingQueries[resp.T]
+	c := query.crawl
+	if c == nil || c.stopped() {
+		return
+	}
+	interval := time.Duration(resp.R.Interval) * time.Second
+	if interval < minCrawlInterval {
+		interval = minCrawlInterval
+	}
+	c.next.Add(node.address.String(), time.Now().Add(interval))
+	c.addResults(resp.R.Samples)
+	for _, f2 := range d.families() {
+		nodelist := d.nodeList(f2, resp)
+		d.newNodes(f2, nodelist, node, query)
+		for id, address := range parseNodesString(nodelist, f2.proto, d.DebugLogger) {
+			if id == f2.nodeId {
+				continue
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil || !d.nodeIDAllowed(id, net.ParseIP(host)) {
+				continue
+			}
+			c.enqueue(crawlNode{f: f2, id: id, addr: address})
+		}
+	}
+}
+
+func (d *DHT) replySampleInfoHashes(f *family, addr net.UDPAddr, r responseType) {
+	totalRecvSampleInfoHashes.Add(1)
+	d.DebugLogger.Debugf("DHT sample_infohashes. Host: %v , nodeID: %x", addr, r.A.Id)
+
+	// The sample is not changed until the interval passes unless the store had fewer infohashes than a full sample.
+	now := time.Now()
+	numInfoHashes := f.peerStore.numInfoHashes()
+	if now.Sub(f.samplesTime) >= maxSampleInterval || (len(f.samples) < maxSamples*nodeIdLen && len(f.samples) < numInfoHashes*nodeIdLen) {
+		var b []byte
+		for _, ih := range f.peerStore.sample(maxSamples) {
+			b = append(b, ih...)
+		}
+		f.samples = string(b)
+		f.samplesTime = now
+	}
+	interval := maxSampleInterval - now.Sub(f.samplesTime)
+	r0 := map[string]interface{}{
+		"id":       f.nodeId,
+		"interval": int64(interval / time.Second),
+		"num":      numInfoHashes,
+		"samples":  f.samples,
+	}
+	d.addClosestNodes(f, r0, InfoHash(r.A.Target), r.A.Want)
+	d.sendReply(f, addr, r.T, r0)
+}
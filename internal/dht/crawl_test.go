@@ -0,0 +1,59 @@
+package dht
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCrawl(t *testing.T) {
+	newNode := func(routers string) *DHT {
+		c := NewConfig()
+		c.Address = "127.0.0.1"
+		c.DHTRouters = routers
+		// Nodes flood each other with find_node queries while the routing tables are nearly empty.
+		c.ClientPerMinuteLimit = 1000000
+		c.RateLimit = -1
+		c.EnforceNodeID = true
+		n, err := New(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = n.Start(); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	n1 := newNode("")
+	defer n1.Stop()
+	router := fmt.Sprintf("127.0.0.1:%d", n1.Port())
+	n2 := newNode(router)
+	defer n2.Stop()
+	n3 := newNode(router)
+	defer n3.Stop()
+
+	ih, err := DecodeInfoHash("d1c5676ae7ac98e8b19f63565905105e3c4c37a2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50 && n2.Stats().IPv4.ReachableNodes == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Announce to n1 so the infohash is in its peer store.
+	n2.PeersRequestPort(string(ih), true, 1234)
+	time.Sleep(500 * time.Millisecond)
+
+	c := n3.Crawl(CrawlConfig{Rate: 100})
+	defer c.Stop()
+	select {
+	case found := <-c.C:
+		if found != ih {
+			t.Fatalf("unexpected infohash: %s", found)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("infohash is not found")
+	}
+	if s := c.Stats(); s.Queried == 0 || s.Responded == 0 || s.InfoHashes != 1 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+}
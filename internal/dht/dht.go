@@ -0,0 +1,1254 @@
+// Copyright 2011 Yves Junqueira. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dht implements a DHT node for tracker-less peer information exchange.
+// It is a fork of github.com/nictuku/dht at revision fd1c1dd3d66a (v0.0.0-20201226073453-fd1c1dd3d66a)
+// with the file based routing table store removed.
+// IPv6 (BEP 32), node ID restrictions (BEP 42), storing arbitrary data (BEP 44) and infohash indexing (BEP 51)
+// are added to the original implementation.
+package dht
+
+// Summary from the bittorrent DHT protocol specification:
+//
+// Message types:
+//  - query
+//  - response
+//  - error
+//
+// RPCs:
+//      ping:
+//         see if node is reachable and save it on routing table.
+//      find_node:
+//	       run when DHT node count drops, or every X minutes. Just to ensure
+//	       our DHT routing table is still useful.
+//      get_peers:
+//	       the real deal. Iteratively queries DHT nodes and find new sources
+//	       for a particular infohash.
+//	announce_peer:
+//         announce that the peer associated with this node is downloading a
+//         torrent.
+//
+// Reference:
+//     http://www.bittorrent.org/beps/bep_0005.html
+//     http://www.bittorrent.org/beps/bep_0032.html
+//     http://www.bittorrent.org/beps/bep_0042.html
+//     http://www.bittorrent.org/beps/bep_0044.html
+//     http://www.bittorrent.org/beps/bep_0051.html
+//
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"expvar"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nictuku/nettools"
+)
+
+// Config for the DHT Node. Use NewConfig to create a configuration with default values.
+type Config struct {
+	// IP Address to listen on.  If left blank, one is chosen automatically.
+	Address string
+	// IPv6 address to listen on if IPv6 is enabled.  If left blank, one is chosen automatically.
+	Address6 string
+	// Run a separate IPv6 node with its own routing table on the same port (BEP 32).
+	// If the IPv6 socket cannot be opened, the node runs on IPv4 only.
+	IPv6 bool
+	// UDP port the DHT node should listen on. If zero, it picks a random port.
+	Port int
+	// Number of peers that DHT will try to find for each infohash being searched. This might
+	// later be moved to a per-infohash option. Default value: 5.
+	NumTargetPeers int
+	// Comma separated list of DHT routers used for bootstrapping the network.
+	DHTRouters string
+	// Maximum number of nodes to store in the routing table. Default value: 100.
+	MaxNodes int
+	// How often to ping nodes in the network to see if they are reachable. Default value: 15 min.
+	CleanupPeriod time.Duration
+	// 20 bytes node ID. If empty, a random ID is generated.
+	NodeID string
+	// 20 bytes node ID of IPv6 node. If empty, a random ID is generated.
+	NodeID6 string
+	// Addresses of nodes in "host:port" format that are known from a previous run.
+	// These nodes are contacted on startup in addition to DHTRouters.
+	Nodes []string
+	// Do not add nodes to the routing table if their IDs are not derived from their IP addresses (BEP 42).
+	// Regardless of this setting, our node ID is changed to a valid one when other nodes report our external IP.
+	EnforceNodeID bool
+	// Maximum packets per second to be processed. Disabled if negative. Default value: 100.
+	RateLimit int64
+	// MaxInfoHashes is the limit of number of infohashes for which we should keep a peer list.
+	// If this and MaxInfoHashPeers are unchanged, it should consume around 25 MB of RAM. Larger
+	// values help keeping the DHT network healthy. Default value: 2048.
+	MaxInfoHashes int
+	// MaxItems is the limit of number of items stored for other nodes (BEP 44). Default value: 1000.
+	MaxItems int
+	// MaxInfoHashPeers is the limit of number of peers to be tracked for each infohash. A
+	// single peer contact typically consumes 6 bytes. Default value: 256.
+	MaxInfoHashPeers int
+	// ClientPerMinuteLimit protects against spammy clients. Ignore their requests if exceeded
+	// this number of packets per minute. Default value: 50.
+	ClientPerMinuteLimit int
+	// ThrottlerTrackedClients is the number of hosts the client throttler remembers. An LRU is used to
+	// track the most interesting ones. Default value: 1000.
+	ThrottlerTrackedClients int64
+}
+
+// Creates a *Config populated with default values.
+func NewConfig() *Config {
+	return &Config{
+		Address:                 "",
+		Port:                    0, // Picks a random port.
+		NumTargetPeers:          5,
+		DHTRouters:              "router.magnets.im:6881,router.bittorrent.com:6881,dht.transmissionbt.com:6881",
+		MaxNodes:                500,
+		CleanupPeriod:           15 * time.Minute,
+		RateLimit:               100,
+		MaxInfoHashes:           2048,
+		MaxInfoHashPeers:        256,
+		MaxItems:                1000,
+		ClientPerMinuteLimit:    50,
+		ThrottlerTrackedClients: 1000,
+	}
+}
+
+var DefaultConfig = NewConfig()
+
+const (
+	// Try to ensure that at least these many nodes are in the routing table.
+	minNodes           = 16
+	secretRotatePeriod = 5 * time.Minute
+)
+
+// DHT should be created by New(). It provides DHT features to a torrent
+// client, such as finding new peers for torrent downloads without requiring a
+// tracker.
+type DHT struct {
+	// PeersRequestResults receives results after user calls PeersRequest method.
+	// Map key contains the 20 bytes infohash string, value contains the list of peer addresses.
+	// Peer addresses are in binary format. You can use DecodePeerAddress function to decode peer addresses.
+	// Addresses of IPv4 peers are 6 bytes, addresses of IPv6 peers are 18 bytes long.
+	PeersRequestResults chan map[InfoHash][]string
+	// Logger contains hooks for a client to attach for certain RPCs.
+	// Hooks is a better name for the job but we don't want to change it and break existing users.
+	Logger Logger
+	// DebugLogger is called with log messages.
+	// By default, nothing is printed to the output from the library.
+	// If you want to see log messages, you have to provide a DebugLogger implementation.
+	DebugLogger DebugLogger
+
+	config Config
+	v4     *family
+	// nil if IPv6 is disabled
+	v6 *family
+	// Node IDs may be changed by the main loop. Protects reads from other goroutines.
+	mNodeID                sync.RWMutex
+	exploredNeighborhood   bool
+	remoteNodeAcquaintance chan string
+	peersRequest           chan ihReq
+	nodesRequest           chan ihReq
+	pingRequest            chan *remoteNode
+	portRequest            chan int
+	statsRequest           chan chan Stats
+	knownNodesRequest      chan chan []Node
+	itemRequest            chan *itemLookup
+	itemLookupDone         chan *itemLookup
+	crawlRequest           chan *Crawl
+	items                  *itemStore
+	removeInfoHash         chan InfoHash
+	stop                   chan bool
+	wg                     sync.WaitGroup
+	clientThrottle         *nettools.ClientThrottle
+	tokenSecrets           []string
+}
+
+// New creates a DHT node. If config is nil, DefaultConfig will be used.
+// Changing the config after calling this function has no effect.
+//
+// This method replaces NewDHTNode.
+func New(config *Config) (node *DHT, err error) {
+	if config == nil {
+		config = DefaultConfig
+	}
+	// Copy to avoid changes.
+	cfg := *config
+	node = &DHT{
+		config:               cfg,
+		PeersRequestResults:  make(chan map[InfoHash][]string, 1),
+		stop:                 make(chan bool),
+		DebugLogger:          &nullLogger{},
+		exploredNeighborhood: false,
+		// Buffer to avoid blocking on sends.
+		remoteNodeAcquaintance: make(chan string, 100),
+		// Buffer to avoid deadlocks and blocking on sends.
+		peersRequest:   make(chan ihReq, 100),
+		nodesRequest:   make(chan ihReq, 100),
+		pingRequest:    make(chan *remoteNode),
+		portRequest:    make(chan int),
+		removeInfoHash: make(chan InfoHash),
+		// Callers send a channel and wait for the reply.
+		statsRequest:      make(chan chan Stats),
+		knownNodesRequest: make(chan chan []Node),
+		itemRequest:       make(chan *itemLookup),
+		itemLookupDone:    make(chan *itemLookup),
+		crawlRequest:      make(chan *Crawl),
+		items:             newItemStore(cfg.MaxItems),
+		clientThrottle:    nettools.NewThrottler(cfg.ClientPerMinuteLimit, cfg.ThrottlerTrackedClients),
+	}
+	node.v4 = newFamily("udp4", &cfg, &node.DebugLogger)
+	if cfg.IPv6 {
+		node.v6 = newFamily("udp6", &cfg, &node.DebugLogger)
+	}
+	node.tokenSecrets = []string{node.newTokenSecret(), node.newTokenSecret()}
+	for _, f := range node.families() {
+		id := cfg.NodeID
+		if f == node.v6 {
+			id = cfg.NodeID6
+		}
+		if bogusId(id) {
+			b, err := randNodeId()
+			if err != nil {
+				return nil, err
+			}
+			id = string(b)
+			node.DebugLogger.Debugf("Using a new random node ID: %x %d", id, len(id))
+		}
+		f.setNodeID(id)
+	}
+
+	// This is called before the engine is up and ready to read from the
+	// underlying channel.
+	node.wg.Add(1)
+	go func() {
+		defer node.wg.Done()
+		for _, addr := range cfg.Nodes {
+			select {
+			case node.remoteNodeAcquaintance <- addr:
+			case <-node.stop:
+				return
+			}
+		}
+	}()
+	return
+}
+
+func (d *DHT) newTokenSecret() string {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		// This would return a string with up to 5 null chars.
+		d.DebugLogger.Errorf("DHT: failed to generate random newTokenSecret: %v", err)
+	}
+	return string(b)
+}
+
+// Logger allows the DHT client to attach hooks for certain RPCs so it can log
+// interesting events any way it wants.
+type Logger interface {
+	GetPeers(addr net.UDPAddr, queryID string, infoHash InfoHash)
+}
+
+type ihReq struct {
+	ih      InfoHash
+	options announceOptions
+	// Family of the routing table to search in. Only used for find_node requests.
+	f *family
+}
+
+type announceOptions struct {
+	announce bool
+	port     int
+}
+
+// PeersRequest asks the DHT to search for more peers for the infoHash
+// provided. announce should be true if the connected peer is actively
+// downloading this infohash, which is normally the case - unless this DHT node
+// is just a router that doesn't downloads torrents.
+// The infoHash added to the store can be deleted with RemoveInfoHash method.
+func (d *DHT) PeersRequest(ih string, announce bool) {
+	d.PeersRequestPort(ih, announce, d.config.Port)
+}
+
+// PeersRequestPort is same as PeersRequest but it takes additional port argument to use in "announce_peer" request.
+func (d *DHT) PeersRequestPort(ih string, announce bool, port int) {
+	d.peersRequest <- ihReq{ih: InfoHash(ih), options: announceOptions{announce, port}}
+	d.DebugLogger.Infof("DHT: torrent client asking more peers for %x.", ih)
+}
+
+// RemoveInfoHash removes infoHash from local store.
+// This method should be called when the peer is no longer downloading this infoHash.
+func (d *DHT) RemoveInfoHash(ih string) {
+	d.removeInfoHash <- InfoHash(ih)
+	d.DebugLogger.Infof("DHT: torrent client removes info hash %x.", ih)
+}
+
+// Stop the DHT node.
+func (d *DHT) Stop() {
+	close(d.stop)
+	d.wg.Wait()
+}
+
+// Port returns the port number assigned to the DHT. This is useful when
+// when initialising the DHT with port 0, i.e. automatic port assignment,
+// in order to retrieve the actual port number used.
+func (d *DHT) Port() int {
+	return <-d.portRequest
+}
+
+// AddNode informs the DHT of a new node it should add to its routing table.
+// addr is a string containing the target node's "host:port" UDP address.
+func (d *DHT) AddNode(addr string) {
+	d.remoteNodeAcquaintance <- addr
+}
+
+// families returns the address families that the node is running on.
+func (d *DHT) families() []*family {
+	if d.v6 == nil {
+		return []*family{d.v4}
+	}
+	return []*family{d.v4, d.v6}
+}
+
+// familyOf returns the family of the IP address. Returns nil if the node is not running on that family.
+func (d *DHT) familyOf(ip net.IP) *family {
+	if ip.To4() != nil {
+		return d.v4
+	}
+	return d.v6
+}
+
+// routers returns the nodes for DHT routers in the family.
+func (d *DHT) routers(f *family) []*remoteNode {
+	var ret []*remoteNode
+	for _, s := range strings.Split(d.config.DHTRouters, ",") {
+		if s != "" {
+			r, e := f.routingTable.getOrCreateNode("", s, f.proto)
+			if e == nil {
+				ret = append(ret, r)
+			}
+		}
+	}
+	return ret
+}
+
+// Asks for more peers for a torrent.
+func (d *DHT) getPeers(infoHash InfoHash) {
+	for _, f := range d.families() {
+		closest := f.routingTable.lookupFiltered(infoHash)
+		if len(closest) == 0 {
+			closest = d.routers(f)
+		}
+		for _, r := range closest {
+			d.getPeersFrom(f, r, infoHash)
+		}
+	}
+}
+
+// Find a DHT node.
+func (d *DHT) findNode(f *family, id string) {
+	ih := InfoHash(id)
+	closest := f.routingTable.lookupFiltered(ih)
+	if len(closest) == 0 {
+		closest = d.routers(f)
+	}
+	for _, r := range closest {
+		d.findNodeFrom(f, r, id)
+	}
+}
+
+// Start launches the dht node. It starts a listener
+// on the desired address, then runs the main loop in a
+// separate go routine - Start replaces Run and will
+// always return, with nil if the dht successfully
+// started or with an error either. d.Stop() is expected
+// by the caller to stop the dht
+func (d *DHT) Start() (err error) {
+	if err = d.initSocket(); err == nil {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			d.loop()
+		}()
+	}
+	return err
+}
+
+// Run launches the dht node. It starts a listener
+// on the desired address, then runs the main loop in the
+// same go routine.
+// If initSocket fails, Run returns with the error.
+// If initSocket succeeds, Run blocks until d.Stop() is called.
+// DEPRECATED - Start should be used instead of Run
+func (d *DHT) Run() error {
+	d.DebugLogger.Infof("dht.Run() is deprecated, use dht.Start() instead")
+	if err := d.initSocket(); err != nil {
+		return err
+	}
+	d.loop()
+	return nil
+}
+
+// initSocket initializes the udp sockets
+// listening to incoming dht requests
+func (d *DHT) initSocket() (err error) {
+	d.v4.conn, err = listen(d.config.Address, d.config.Port, d.v4.proto, d.DebugLogger)
+	if err != nil {
+		return err
+	}
+
+	// Update the stored port number in case it was set 0, meaning it was
+	// set automatically by the system
+	d.config.Port = d.v4.conn.LocalAddr().(*net.UDPAddr).Port
+
+	if d.v6 != nil {
+		d.v6.conn, err = listen(d.config.Address6, d.config.Port, d.v6.proto, d.DebugLogger)
+		if err != nil {
+			d.DebugLogger.Errorf("DHT: cannot listen on IPv6, running on IPv4 only: %v", err)
+			d.v6 = nil
+		}
+	}
+	return nil
+}
+
+func (d *DHT) bootstrap(f *family) {
+	// Bootstrap the network (only if there are configured dht routers).
+	for _, r := range d.routers(f) {
+		d.pingNode(f, r)
+		d.findNodeFrom(f, r, f.nodeId)
+	}
+	d.findNode(f, f.nodeId)
+	d.getMorePeers(f, nil)
+}
+
+// loop is the main working section of dht.
+// It bootstraps a routing table, if necessary,
+// and listens for incoming DHT requests until d.Stop()
+// is called from another go routine.
+func (d *DHT) loop() {
+	// There is goroutine pushing and one popping items out of the arena
+	// for each socket. One passes work to the other. So there is little
+	// contention in the arena, so it doesn't need many items (it used to
+	// have 500!). If readFromSocket or the packet processing ever need to be
+	// parallelized, this would have to be bumped.
+	families := d.families()
+	bytesArena := newArena(maxUDPPacketSize, 3*len(families))
+	socketChan := make(chan packetType)
+	for _, f := range families {
+		// Close socket
+		defer f.conn.Close()
+
+		f := f
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			readFromSocket(f, socketChan, bytesArena, d.stop, d.DebugLogger)
+		}()
+	}
+
+	for _, f := range families {
+		d.bootstrap(f)
+	}
+
+	cleanupTicker := time.Tick(d.config.CleanupPeriod)
+	secretRotateTicker := time.Tick(secretRotatePeriod)
+
+	var fillTokenBucket <-chan time.Time
+	tokenBucket := d.config.RateLimit
+
+	if d.config.RateLimit < 0 {
+		d.DebugLogger.Infof("rate limiting disabled")
+	} else {
+		// Token bucket for limiting the number of packets per second.
+		fillTokenBucket = time.Tick(time.Second / 10)
+		if d.config.RateLimit > 0 && d.config.RateLimit < 10 {
+			// Less than 10 leads to rounding problems.
+			d.config.RateLimit = 10
+		}
+	}
+	for _, f := range families {
+		d.DebugLogger.Infof("DHT: Starting DHT node %x on port %d (%s).", f.nodeId, d.config.Port, f.proto)
+	}
+
+	for {
+		select {
+		case <-d.stop:
+			d.DebugLogger.Infof("DHT exiting.")
+			d.clientThrottle.Stop()
+			return
+		case addr := <-d.remoteNodeAcquaintance:
+			d.helloFromPeer(addr)
+		case req := <-d.peersRequest:
+			// torrent server is asking for more peers for infoHash.  Ask the closest
+			// nodes for directions. The goroutine will write into the
+			// PeersNeededResults channel.
+
+			// Drain all requests sitting in the channel and de-dupe them.
+			m := map[InfoHash]announceOptions{req.ih: req.options}
+		P:
+			for {
+				select {
+				case req = <-d.peersRequest:
+					m[req.ih] = req.options
+				default:
+					// Channel drained.
+					break P
+				}
+			}
+			// Process each unique infohash for which there were requests.
+			for ih, options := range m {
+				if options.announce {
+					for _, f := range families {
+						f.peerStore.addLocalDownload(ih, options.port)
+					}
+				}
+
+				d.getPeers(ih) // I might have enough peers in the peerstore, but no seeds
+			}
+
+		case ih := <-d.removeInfoHash:
+			for _, f := range families {
+				f.peerStore.removeLocalDownload(ih)
+			}
+		case req := <-d.nodesRequest:
+			m := map[ihReq]bool{req: true}
+		L:
+			for {
+				select {
+				case req = <-d.nodesRequest:
+					m[req] = true
+				default:
+					// Channel drained.
+					break L
+				}
+			}
+			for req := range m {
+				d.findNode(req.f, string(req.ih))
+			}
+
+		case p := <-socketChan:
+			totalRecv.Add(1)
+			if d.config.RateLimit > 0 {
+				if tokenBucket > 0 {
+					d.processPacket(p)
+					tokenBucket -= 1
+				} else {
+					// TODO In the future it might be better to avoid dropping things like ping replies.
+					totalDroppedPackets.Add(1)
+				}
+			} else {
+				d.processPacket(p)
+			}
+			bytesArena.Push(p.b)
+
+		case <-fillTokenBucket:
+			if tokenBucket < d.config.RateLimit {
+				tokenBucket += d.config.RateLimit / 10
+			}
+		case <-cleanupTicker:
+			for _, f := range families {
+				needPing := f.routingTable.cleanup(d.config.CleanupPeriod, f.peerStore)
+				d.wg.Add(1)
+				go func() {
+					defer d.wg.Done()
+					pingSlowly(d.pingRequest, needPing, d.config.CleanupPeriod, d.stop)
+				}()
+				if d.needMoreNodes(f) {
+					d.bootstrap(f)
+				}
+			}
+		case node := <-d.pingRequest:
+			if f := d.familyOf(node.address.IP); f != nil {
+				d.pingNode(f, node)
+			}
+		case <-secretRotateTicker:
+			d.tokenSecrets = []string{d.newTokenSecret(), d.tokenSecrets[0]}
+		case d.portRequest <- d.config.Port:
+			continue
+		case c := <-d.statsRequest:
+			c <- d.stats()
+		case c := <-d.knownNodesRequest:
+			c <- d.knownNodes()
+		case l := <-d.itemRequest:
+			d.startItemLookup(l)
+		case l := <-d.itemLookupDone:
+			d.finishItemLookup(l)
+		case c := <-d.crawlRequest:
+			d.crawlNext(c)
+		}
+	}
+}
+
+func (d *DHT) needMoreNodes(f *family) bool {
+	n := f.routingTable.numNodes()
+	return n < minNodes || n*2 < d.config.MaxNodes
+}
+
+func (d *DHT) needMorePeers(f *family, ih InfoHash) bool {
+	return f.peerStore.alive(ih) < d.config.NumTargetPeers
+}
+
+func (d *DHT) getMorePeers(f *family, r *remoteNode) {
+	for ih := range f.peerStore.localActiveDownloads {
+		if d.needMorePeers(f, ih) {
+			if r == nil {
+				d.getPeers(ih)
+			} else {
+				d.getPeersFrom(f, r, ih)
+			}
+		}
+	}
+}
+
+// nodeIDAllowed returns false if the node must not be added to the routing table because of BEP 42 restrictions.
+func (d *DHT) nodeIDAllowed(id string, ip net.IP) bool {
+	return !d.config.EnforceNodeID || ValidNodeID(id, ip)
+}
+
+func (d *DHT) helloFromPeer(addr string) {
+	// We've got a new node id. We need to:
+	// - see if we know it already, skip accordingly.
+	// - ping it and see if it's reachable.
+	// - if it responds, save it in the routing table.
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		d.DebugLogger.Debugf("helloFromPeer error: %v", err)
+		return
+	}
+	f := d.familyOf(udpAddr.IP)
+	if f == nil {
+		return
+	}
+	_, addrResolved, existed, err := f.routingTable.hostPortToNode(udpAddr.String(), f.proto)
+	if err != nil {
+		d.DebugLogger.Debugf("helloFromPeer error: %v", err)
+		return
+	}
+	if existed {
+		// Node host+port already known.
+		return
+	}
+	if f.routingTable.length() < d.config.MaxNodes {
+		d.ping(f, addrResolved)
+		return
+	}
+}
+
+func (d *DHT) processPacket(p packetType) {
+	d.DebugLogger.Debugf("DHT processing packet from %v", p.raddr.String())
+	if p.b[0] != 'd' {
+		// Malformed DHT packet. There are protocol extensions out
+		// there that we don't support or understand.
+		d.DebugLogger.Debugf("Malformed DHT packet.")
+		return
+	}
+	r, err := readResponse(p, d.DebugLogger)
+	if err != nil {
+		d.DebugLogger.Debugf("DHT: readResponse Error: %v, %q", err, string(p.b))
+		return
+	}
+	f := p.f
+	switch {
+	// Response.
+	case r.Y == "r":
+		d.DebugLogger.Debugf("DHT processing response from %x", r.R.Id)
+		if bogusId(r.R.Id) {
+			d.DebugLogger.Debugf("DHT received packet with bogus node id %x", r.R.Id)
+			return
+		}
+		if r.R.Id == f.nodeId {
+			d.DebugLogger.Debugf("DHT received reply from self, id %x", r.A.Id)
+			return
+		}
+		node, addr, existed, err := f.routingTable.hostPortToNode(p.raddr.String(), f.proto)
+		if err != nil {
+			d.DebugLogger.Debugf("DHT readResponse error processing response: %v", err)
+			return
+		}
+		if !existed {
+			d.DebugLogger.Debugf("DHT: Received reply from a host we don't know: %v", p.raddr)
+			if f.routingTable.length() < d.config.MaxNodes {
+				d.ping(f, addr)
+			}
+			return
+		}
+		// Fix the node ID.
+		if node.id == "" {
+			node.id = r.R.Id
+			f.routingTable.update(node, f.proto)
+		}
+		if node.id != r.R.Id {
+			d.DebugLogger.Debugf("DHT: Node changed IDs %x => %x", node.id, r.R.Id)
+		}
+		if query, ok := node.pendingQueries[r.T]; ok {
+			d.DebugLogger.Debugf("DHT: Received reply to %v", query.Type)
+			d.handleExternalIP(f, r.IP, p.raddr.IP)
+			allowed := d.nodeIDAllowed(r.R.Id, p.raddr.IP)
+			if allowed {
+				if !node.reachable {
+					node.reachable = true
+					totalNodesReached.Add(1)
+				}
+				node.lastResponseTime = time.Now()
+				node.pastQueries[r.T] = query
+				f.routingTable.neighborhoodUpkeep(node, f.proto, f.peerStore)
+
+				// If this is the first host added to the routing table, attempt a
+				// recursive lookup of our own address, to build our neighborhood ASAP.
+				if d.needMoreNodes(f) {
+					d.DebugLogger.Debugf("DHT: need more nodes")
+					d.findNode(f, f.nodeId)
+				}
+				d.exploredNeighborhood = true
+			}
+
+			switch query.Type {
+			case "ping":
+				// Served its purpose, nothing else to be done.
+				totalRecvPingReply.Add(1)
+			case "get_peers":
+				d.DebugLogger.Debugf("DHT: got get_peers response")
+				d.processGetPeerResults(f, node, r)
+			case "find_node":
+				d.DebugLogger.Debugf("DHT: got find_node response")
+				d.processFindNodeResults(f, node, r)
+			case "announce_peer":
+				// Nothing to do. In the future, update counters.
+			case "get":
+				d.DebugLogger.Debugf("DHT: got get response")
+				d.processGetItemResults(f, node, r, p.b)
+			case "put":
+				// Nothing to do.
+			case "sample_infohashes":
+				d.DebugLogger.Debugf("DHT: got sample_infohashes response")
+				d.processSampleInfoHashesResults(f, node, r)
+			default:
+				d.DebugLogger.Debugf("DHT: Unknown query type: %v from %v", query.Type, addr)
+			}
+			delete(node.pendingQueries, r.T)
+			if !allowed {
+				// Results are still useful but the node is not kept in the routing table.
+				d.DebugLogger.Debugf("DHT: Node ID %x is not valid for %v", r.R.Id, p.raddr.IP)
+				totalNonCompliantNodes.Add(1)
+				f.routingTable.kill(node, f.peerStore)
+			}
+		} else {
+			d.DebugLogger.Debugf("DHT: Unknown query id: %v", r.T)
+		}
+	case r.Y == "q":
+		// Only queries are throttled. Lookups may receive many responses from the same node.
+		if !d.clientThrottle.CheckBlock(p.raddr.IP.String()) {
+			totalPacketsFromBlockedHosts.Add(1)
+			d.DebugLogger.Debugf("Node exceeded rate limiter. Dropping packet.")
+			return
+		}
+		if r.A.Id == f.nodeId {
+			d.DebugLogger.Debugf("DHT received packet from self, id %x", r.A.Id)
+			return
+		}
+		node, addr, existed, err := f.routingTable.hostPortToNode(p.raddr.String(), f.proto)
+		if err != nil {
+			d.DebugLogger.Debugf("Error readResponse error processing query: %v", err)
+			return
+		}
+		if !existed && d.nodeIDAllowed(r.A.Id, p.raddr.IP) {
+			// Another candidate for the routing table. See if it's reachable.
+			if f.routingTable.length() < d.config.MaxNodes {
+				d.ping(f, addr)
+			}
+		}
+		d.DebugLogger.Debugf("DHT processing %v request", r.Q)
+		switch r.Q {
+		case "ping":
+			d.replyPing(f, p.raddr, r)
+		case "get_peers":
+			d.replyGetPeers(f, p.raddr, r)
+		case "find_node":
+			d.replyFindNode(f, p.raddr, r)
+		case "announce_peer":
+			d.replyAnnouncePeer(f, p.raddr, node, r)
+		case "get":
+			d.replyGetItem(f, p.raddr, r, p.b)
+		case "put":
+			d.replyPutItem(f, p.raddr, r, p.b)
+		case "sample_infohashes":
+			d.replySampleInfoHashes(f, p.raddr, r)
+		default:
+			d.DebugLogger.Debugf("DHT: non-implemented handler for type %v", r.Q)
+		}
+	default:
+		d.DebugLogger.Debugf("DHT: Bogus DHT query from %v.", p.raddr)
+	}
+}
+
+// handleExternalIP counts the external IP address reported in the "ip" key of a response (BEP 42).
+// Node ID is changed if it is not valid for the external IP address that other nodes agree on.
+func (d *DHT) handleExternalIP(f *family, compactAddr string, voter net.IP) {
+	var ip net.IP
+	switch len(compactAddr) {
+	case 6:
+		ip = net.IP(compactAddr[:4])
+	case 18:
+		ip = net.IP(compactAddr[:16])
+	default:
+		return
+	}
+	if d.familyOf(ip) != f {
+		return
+	}
+	ip = f.voteExternalIP(ip, voter)
+	if ip == nil || ValidNodeID(f.nodeId, ip) {
+		return
+	}
+	id, err := GenerateNodeID(ip)
+	if err != nil {
+		d.DebugLogger.Errorf("DHT: cannot generate node ID: %v", err)
+		return
+	}
+	d.DebugLogger.Infof("DHT: External IP is %v. Changing node ID to %x.", ip, id)
+	d.mNodeID.Lock()
+	f.setNodeID(id)
+	d.mNodeID.Unlock()
+	d.findNode(f, id)
+}
+
+func (d *DHT) ping(f *family, address string) {
+	r, err := f.routingTable.getOrCreateNode("", address, f.proto)
+	if err != nil {
+		d.DebugLogger.Debugf("ping error for address %v: %v", address, err)
+		return
+	}
+	d.pingNode(f, r)
+}
+
+func (d *DHT) pingNode(f *family, r *remoteNode) {
+	d.DebugLogger.Debugf("DHT: ping => %+v", r.address)
+	t := r.newQuery("ping")
+
+	queryArguments := map[string]interface{}{"id": f.nodeId}
+	query := queryMessage{t, "q", "ping", queryArguments}
+	sendMsg(f.conn, r.address, query, d.DebugLogger)
+	totalSentPing.Add(1)
+}
+
+// want returns the value for "want" argument of find_node and get_peers queries (BEP 32).
+// Nodes of both families are requested if we are running on both.
+func (d *DHT) want() []string {
+	if d.v6 == nil {
+		return nil
+	}
+	return []string{d.v4.want, d.v6.want}
+}
+
+func (d *DHT) getPeersFrom(f *family, r *remoteNode, ih InfoHash) {
+	if r == nil {
+		return
+	}
+	totalSentGetPeers.Add(1)
+	ty := "get_peers"
+	transId := r.newQuery(ty)
+	if _, ok := r.pendingQueries[transId]; ok {
+		r.pendingQueries[transId].ih = ih
+	} else {
+		r.pendingQueries[transId] = &queryType{ih: ih}
+	}
+	queryArguments := map[string]interface{}{
+		"id":        f.nodeId,
+		"info_hash": ih,
+	}
+	if want := d.want(); want != nil {
+		queryArguments["want"] = want
+	}
+	query := queryMessage{transId, "q", ty, queryArguments}
+	d.DebugLogger.Debugf("DHT sending get_peers. nodeID: %x@%v, InfoHash: %x , distance: %x", r.id, r.address, ih, hashDistance(InfoHash(r.id), ih))
+	r.lastSearchTime = time.Now()
+	sendMsg(f.conn, r.address, query, d.DebugLogger)
+}
+
+func (d *DHT) findNodeFrom(f *family, r *remoteNode, id string) {
+	if r == nil {
+		return
+	}
+	totalSentFindNode.Add(1)
+	ty := "find_node"
+	transId := r.newQuery(ty)
+	ih := InfoHash(id)
+	d.DebugLogger.Debugf("findNodeFrom adding pendingQueries transId=%v ih=%x", transId, ih)
+	if _, ok := r.pendingQueries[transId]; ok {
+		r.pendingQueries[transId].ih = ih
+	} else {
+		r.pendingQueries[transId] = &queryType{ih: ih}
+	}
+	queryArguments := map[string]interface{}{
+		"id":     f.nodeId,
+		"target": id,
+	}
+	if want := d.want(); want != nil {
+		queryArguments["want"] = want
+	}
+	query := queryMessage{transId, "q", ty, queryArguments}
+	d.DebugLogger.Debugf("DHT sending find_node. nodeID: %x@%v, target ID: %x , distance: %x", r.id, r.address, id, hashDistance(InfoHash(r.id), ih))
+	r.lastSearchTime = time.Now()
+	sendMsg(f.conn, r.address, query, d.DebugLogger)
+}
+
+// announcePeer sends a message to the destination address to advertise that
+// our node is a peer for this infohash, using the provided token to
+// 'authenticate'.
+func (d *DHT) announcePeer(f *family, address net.UDPAddr, ih InfoHash, port int, token string) {
+	r, err := f.routingTable.getOrCreateNode("", address.String(), f.proto)
+	if err != nil {
+		d.DebugLogger.Debugf("announcePeer error: %v", err)
+		return
+	}
+	ty := "announce_peer"
+	d.DebugLogger.Debugf("DHT: announce_peer => address: %v, ih: %x, token: %x", address, ih, token)
+	transId := r.newQuery(ty)
+	queryArguments := map[string]interface{}{
+		"id":        f.nodeId,
+		"info_hash": ih,
+		"port":      port,
+		"token":     token,
+	}
+	query := queryMessage{transId, "q", ty, queryArguments}
+	sendMsg(f.conn, address, query, d.DebugLogger)
+}
+
+func (d *DHT) hostToken(addr net.UDPAddr, secret string) string {
+	h := sha1.New()
+	io.WriteString(h, addr.String())
+	io.WriteString(h, secret)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func (d *DHT) checkToken(addr net.UDPAddr, token string) bool {
+	match := false
+	for _, secret := range d.tokenSecrets {
+		if d.hostToken(addr, secret) == token {
+			match = true
+			break
+		}
+	}
+	d.DebugLogger.Debugf("checkToken for %v, %q matches? %v", addr, token, match)
+	return match
+}
+
+// sendReply sends a response to a query. The "ip" key tells the querying node its external address (BEP 42).
+func (d *DHT) sendReply(f *family, addr net.UDPAddr, t string, r map[string]interface{}) {
+	reply := replyMessage{
+		T:  t,
+		Y:  "r",
+		R:  r,
+		IP: nettools.DottedPortToBinary(addr.String()),
+	}
+	sendMsg(f.conn, addr, reply, d.DebugLogger)
+}
+
+func (d *DHT) replyAnnouncePeer(f *family, addr net.UDPAddr, node *remoteNode, r responseType) {
+	ih := InfoHash(r.A.InfoHash)
+	d.DebugLogger.Debugf("DHT: announce_peer. Host %v, nodeID: %x, infoHash: %x, peerPort %d, distance to me %x",
+		addr, r.A.Id, ih, r.A.Port, hashDistance(ih, InfoHash(f.nodeId)),
+	)
+	// node can be nil if, for example, the server just restarted and received an announce_peer
+	// from a node it doesn't yet know about.
+	if node != nil && d.checkToken(addr, r.A.Token) {
+		peerAddr := net.TCPAddr{IP: addr.IP, Port: r.A.Port}
+		f.peerStore.addContact(ih, nettools.DottedPortToBinary(peerAddr.String()))
+		// Allow searching this node immediately, since it's telling us
+		// it has an infohash. Enables faster upgrade of other nodes to
+		// "peer" of an infohash, if the announcement is valid.
+		node.lastResponseTime = time.Now().Add(-searchRetryPeriod)
+		port := f.peerStore.hasLocalDownload(ih)
+		if port != 0 {
+			select {
+			case d.PeersRequestResults <- map[InfoHash][]string{ih: {nettools.DottedPortToBinary(peerAddr.String())}}:
+			case <-d.stop:
+			}
+		}
+	}
+	// Always reply positively. jech says this is to avoid "back-tracking", not sure what that means.
+	d.sendReply(f, addr, r.T, map[string]interface{}{"id": f.nodeId})
+}
+
+func (d *DHT) replyGetPeers(f *family, addr net.UDPAddr, r responseType) {
+	totalRecvGetPeers.Add(1)
+	d.DebugLogger.Debugf("DHT get_peers. Host: %v , nodeID: %x , InfoHash: %x , distance to me: %x",
+		addr, r.A.Id, InfoHash(r.A.InfoHash), hashDistance(r.A.InfoHash, InfoHash(f.nodeId)))
+
+	if d.Logger != nil {
+		d.Logger.GetPeers(addr, r.A.Id, r.A.InfoHash)
+	}
+
+	ih := r.A.InfoHash
+	r0 := map[string]interface{}{"id": f.nodeId, "token": d.hostToken(addr, d.tokenSecrets[0])}
+
+	if peerContacts := d.peersForInfoHash(f, ih); len(peerContacts) > 0 {
+		r0["values"] = peerContacts
+	} else {
+		d.addClosestNodes(f, r0, ih, r.A.Want)
+	}
+	d.sendReply(f, addr, r.T, r0)
+}
+
+// addClosestNodes adds the nodes closest to the target into the response.
+// Nodes in the same family with the query are returned unless other families are requested in "want" argument (BEP 32).
+func (d *DHT) addClosestNodes(f *family, r map[string]interface{}, target InfoHash, want []string) {
+	families := []*family{f}
+	if len(want) > 0 {
+		families = families[:0]
+		for _, f2 := range d.families() {
+			for _, w := range want {
+				if w == f2.want {
+					families = append(families, f2)
+					break
+				}
+			}
+		}
+	}
+	for _, f2 := range families {
+		r[f2.nodesKey] = d.closestNodes(f2, target)
+	}
+}
+
+// closestNodes returns the nodes closest to the target in compact format.
+func (d *DHT) closestNodes(f *family, target InfoHash) string {
+	neighbors := f.routingTable.lookupFiltered(target)
+	if len(neighbors) < kNodes {
+		neighbors = append(neighbors, f.routingTable.lookup(target)...)
+	}
+	seen := make(map[string]struct{}, kNodes)
+	n := make([]string, 0, kNodes)
+	for _, r := range neighbors {
+		if _, ok := seen[r.id]; ok {
+			continue
+		}
+		if len(r.addressBinaryFormat) != f.contactLen-nodeIdLen {
+			d.DebugLogger.Debugf("killing node with bogus address %v", r.address.String())
+			f.routingTable.kill(r, f.peerStore)
+			continue
+		}
+		seen[r.id] = struct{}{}
+		n = append(n, r.id+r.addressBinaryFormat)
+		if len(n) == kNodes {
+			break
+		}
+	}
+	d.DebugLogger.Debugf("closestNodes: Giving %d %s", len(n), f.nodesKey)
+	return strings.Join(n, "")
+}
+
+func (d *DHT) peersForInfoHash(f *family, ih InfoHash) []string {
+	peerContacts := f.peerStore.peerContacts(ih)
+	if len(peerContacts) > 0 {
+		d.DebugLogger.Debugf("replyGetPeers: Giving peers! %x was requested, and we knew %d peers!", ih, len(peerContacts))
+	}
+	return peerContacts
+}
+
+func (d *DHT) replyFindNode(f *family, addr net.UDPAddr, r responseType) {
+	totalRecvFindNode.Add(1)
+	d.DebugLogger.Debugf("DHT find_node. Host: %v , nodeId: %x , target ID: %x , distance to me: %x",
+		addr, r.A.Id, r.A.Target, hashDistance(InfoHash(r.A.Target), InfoHash(f.nodeId)))
+
+	r0 := map[string]interface{}{"id": f.nodeId}
+	d.addClosestNodes(f, r0, InfoHash(r.A.Target), r.A.Want)
+	d.sendReply(f, addr, r.T, r0)
+}
+
+func (d *DHT) replyPing(f *family, addr net.UDPAddr, response responseType) {
+	d.DebugLogger.Debugf("DHT: reply ping => %v", addr)
+	d.sendReply(f, addr, response.T, map[string]interface{}{"id": f.nodeId})
+}
+
+// Process another node's response to a get_peers query. If the response
+// contains peers, send them to the Torrent engine, our client, using the
+// DHT.PeersRequestResults channel. If it contains closest nodes, query
+// them if we still need it. Also announce ourselves as a peer for that node,
+// unless we are in supernode mode.
+func (d *DHT) processGetPeerResults(f *family, node *remoteNode, resp responseType) {
+	totalRecvGetPeersReply.Add(1)
+
+	query, _ := node.pendingQueries[resp.T]
+	port := f.peerStore.hasLocalDownload(query.ih)
+	if port != 0 {
+		d.announcePeer(f, node.address, query.ih, port, resp.R.Token)
+	}
+	if resp.R.Values != nil {
+		peers := make([]string, 0)
+		for _, peerContact := range resp.R.Values {
+			// send peer even if we already have it in store
+			// the underlying client does/should handle dupes
+			f.peerStore.addContact(query.ih, peerContact)
+			peers = append(peers, peerContact)
+		}
+		if len(peers) > 0 {
+			// Finally, new peers.
+			result := map[InfoHash][]string{query.ih: peers}
+			totalPeers.Add(int64(len(peers)))
+			d.DebugLogger.Debugf("DHT: processGetPeerResults, totalPeers: %v", totalPeers.String())
+			select {
+			case d.PeersRequestResults <- result:
+			case <-d.stop:
+				// if we're closing down and the caller has stopped reading
+				// from PeersRequestResults, drop the result.
+			}
+		}
+	}
+	for _, f2 := range d.families() {
+		for range d.newNodes(f2, d.nodeList(f2, resp), node, query) {
+			if d.needMorePeers(f2, query.ih) {
+				// Re-add this request to the queue. This would in theory
+				// batch similar requests, because new nodes are already
+				// available in the routing table and will be used at the
+				// next opportunity - before this particular channel send is
+				// processed. As soon we reach target number of peers these
+				// channel sends become noops.
+				//
+				// Setting the announce parameter to false because it's not
+				// needed here: if this node is downloading that particular
+				// infohash, that has already been recorded with
+				// peerStore.addLocalDownload(). The announcement itself is
+				// sent not when get_peers is sent, but when processing the
+				// reply to get_peers.
+				//
+				select {
+				case d.peersRequest <- ihReq{ih: query.ih}:
+				default:
+					// The channel is full, so drop this item. The node
+					// was added to the routing table already, so it
+					// will be used next time getPeers() is called -
+					// assuming it's close enough to the ih.
+				}
+			}
+		}
+	}
+}
+
+// Process another node's response to a find_node query.
+func (d *DHT) processFindNodeResults(f *family, node *remoteNode, resp responseType) {
+	totalRecvFindNodeReply.Add(1)
+
+	query, _ := node.pendingQueries[resp.T]
+	d.DebugLogger.Debugf("processFindNodeResults find_node = %s", nettools.BinaryToDottedPort(node.addressBinaryFormat))
+
+	for _, f2 := range d.families() {
+		for _, r := range d.newNodes(f2, d.nodeList(f2, resp), node, query) {
+			if d.needMoreNodes(f2) {
+				select {
+				case d.nodesRequest <- ihReq{ih: query.ih, f: f2}:
+				default:
+					// Too many find_node commands queued up. Dropping
+					// this. The node has already been added to the
+					// routing table so we're not losing any
+					// information.
+				}
+			}
+			d.getMorePeers(f2, r)
+		}
+	}
+}
+
+// nodeList returns the nodes of the family in the response.
+func (d *DHT) nodeList(f *family, resp responseType) string {
+	if f == d.v6 {
+		return resp.R.Nodes6
+	}
+	return resp.R.Nodes
+}
+
+// newNodes adds the nodes in the list received from the node into the routing table of family.
+// Returns the nodes that were not known before.
+func (d *DHT) newNodes(f *family, nodelist string, node *remoteNode, query *queryType) []*remoteNode {
+	if nodelist == "" {
+		return nil
+	}
+	d.DebugLogger.Debugf("DHT: handling %s, len(nodelist)=%d", f.nodesKey, len(nodelist))
+	var ret []*remoteNode
+	for id, address := range parseNodesString(nodelist, f.proto, d.DebugLogger) {
+		if id == f.nodeId {
+			d.DebugLogger.Debugf("DHT got reference of self, id %x", id)
+			continue
+		}
+
+		// If it's in our routing table already, ignore it.
+		_, addr, existed, err := f.routingTable.hostPortToNode(address, f.proto)
+		if err != nil {
+			d.DebugLogger.Debugf("DHT error parsing node: %v", err)
+			continue
+		}
+		if addr == node.address.String() {
+			// This smartass is probably trying to
+			// sniff the network, or attract a lot
+			// of traffic to itself. Ignore all
+			// their results.
+			// SelfPromotions are more common for find_node. They are
+			// happening even for router.bittorrent.com
+			totalSelfPromotions.Add(1)
+			continue
+		}
+		if existed {
+			d.DebugLogger.Debugf("DHT: DUPE node reference, query %x: %x@%v from %x@%v. Distance: %x.",
+				query.ih, id, address, node.id, node.address, hashDistance(query.ih, InfoHash(node.id)))
+			if query.Type == "get_peers" {
+				totalGetPeersDupes.Add(1)
+			} else {
+				totalFindNodeDupes.Add(1)
+			}
+			continue
+		}
+		host, _, _ := net.SplitHostPort(addr)
+		if !d.nodeIDAllowed(id, net.ParseIP(host)) {
+			totalNonCompliantNodes.Add(1)
+			continue
+		}
+		// And it is actually new. Interesting.
+		d.DebugLogger.Debugf("DHT: Got new node reference, query %x: %x@%v from %x@%v. Distance: %x.",
+			query.ih, id, address, node.id, node.address, hashDistance(query.ih, InfoHash(node.id)))
+		// Includes the node in the routing table and ignores errors.
+		r, err := f.routingTable.getOrCreateNode(id, addr, f.proto)
+		if err != nil {
+			d.DebugLogger.Debugf("DHT: calling getOrCreateNode: %v. Id=%x, Address=%q", err, id, addr)
+			continue
+		}
+		ret = append(ret, r)
+	}
+	return ret
+}
+
+func randNodeId() ([]byte, error) {
+	b := make([]byte, 20)
+	_, err := io.ReadFull(rand.Reader, b)
+	return b, err
+}
+
+var (
+	totalNodesReached              = expvar.NewInt("totalNodesReached")
+	totalGetPeersDupes             = expvar.NewInt("totalGetPeersDupes")
+	totalFindNodeDupes             = expvar.NewInt("totalFindNodeDupes")
+	totalSelfPromotions            = expvar.NewInt("totalSelfPromotions")
+	totalNonCompliantNodes         = expvar.NewInt("totalNonCompliantNodes")
+	totalPeers                     = expvar.NewInt("totalPeers")
+	totalSentPing                  = expvar.NewInt("totalSentPing")
+	totalSentGetPeers              = expvar.NewInt("totalSentGetPeers")
+	totalSentFindNode              = expvar.NewInt("totalSentFindNode")
+	totalRecvGetPeers              = expvar.NewInt("totalRecvGetPeers")
+	totalRecvGetPeersReply         = expvar.NewInt("totalRecvGetPeersReply")
+	totalRecvPingReply             = expvar.NewInt("totalRecvPingReply")
+	totalRecvFindNode              = expvar.NewInt("totalRecvFindNode")
+	totalRecvFindNodeReply         = expvar.NewInt("totalRecvFindNodeReply")
+	totalSentGet                   = expvar.NewInt("totalSentGet")
+	totalSentPut                   = expvar.NewInt("totalSentPut")
+	totalRecvGet                   = expvar.NewInt("totalRecvGet")
+	totalRecvGetReply              = expvar.NewInt("totalRecvGetReply")
+	totalRecvPut                   = expvar.NewInt("totalRecvPut")
+	totalSentSampleInfoHashes      = expvar.NewInt("totalSentSampleInfoHashes")
+	totalRecvSampleInfoHashes      = expvar.NewInt("totalRecvSampleInfoHashes")
+	totalRecvSampleInfoHashesReply = expvar.NewInt("totalRecvSampleInfoHashesReply")
+	totalPacketsFromBlockedHosts   = expvar.NewInt("totalPacketsFromBlockedHosts")
+	totalDroppedPackets            = expvar.NewInt("totalDroppedPackets")
+	totalRecv                      = expvar.NewInt("totalRecv")
+)
@@ -0,0 +1,220 @@
+// Copyright 2011 Yves Junqueira. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dht
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func startNode(routers string, ih string) (*DHT, error) {
+	c := NewConfig()
+	c.DHTRouters = routers
+	c.Port = 0
+	node, err := New(c)
+	if err != nil {
+		return nil, err
+	}
+	// Remove the buffer
+	node.peersRequest = make(chan ihReq, 0)
+	if err = node.Start(); err != nil {
+		return nil, err
+	}
+	node.PeersRequest(ih, true)
+	return node, nil
+}
+
+// drainResults loops until the target number of peers are found, or a time limit is reached.
+func drainResults(n *DHT, ih string, targetCount int, timeout time.Duration) error {
+	count := 0
+	for {
+		select {
+		case r := <-n.PeersRequestResults:
+			for _, peers := range r {
+				for range peers {
+					count++
+					if count >= targetCount {
+						return nil
+					}
+				}
+			}
+		case <-time.Tick(timeout):
+			return fmt.Errorf("drainResult timed out")
+
+		case <-time.Tick(time.Second / 5):
+			n.PeersRequest(ih, true)
+		}
+	}
+}
+
+func TestDHTLocal(t *testing.T) {
+	if testing.Short() {
+		fmt.Println("Skipping TestDHTLocal")
+		return
+	}
+	searchRetryPeriod = time.Second
+	infoHash, err := DecodeInfoHash("d1c5676ae7ac98e8b19f63565905105e3c4c37a2")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	n1, err := startNode("", string(infoHash))
+	if err != nil {
+		t.Errorf("n1 startNode: %v", err)
+		return
+	}
+
+	router := fmt.Sprintf("localhost:%d", n1.Port())
+	n2, err := startNode(router, string(infoHash))
+	if err != nil {
+		t.Errorf("n2 startNode: %v", err)
+		return
+	}
+	n3, err := startNode(router, string(infoHash))
+	if err != nil {
+		t.Errorf("n3 startNode: %v", err)
+		return
+	}
+	// n2 and n3 should find each other.
+	wg := new(sync.WaitGroup)
+	wg.Add(2)
+	go func() {
+		if err := drainResults(n2, string(infoHash), 1, 10*time.Second); err != nil {
+			t.Errorf("drainResult n2: %v", err)
+		}
+		wg.Done()
+	}()
+	go func() {
+		if err := drainResults(n3, string(infoHash), 1, 10*time.Second); err != nil {
+			t.Errorf("drainResult n3: %v", err)
+		}
+		wg.Done()
+	}()
+	wg.Wait()
+	n1.Stop()
+	n2.Stop()
+	n3.Stop()
+	searchRetryPeriod = time.Second * 15
+}
+
+func TestNewDHTConfig(t *testing.T) {
+	c := NewConfig()
+	c.Port = 6060
+	c.NumTargetPeers = 10
+
+	d, err := New(c)
+	if err != nil {
+		t.Fatalf("DHT failed to init with config: %v", err)
+	}
+	if d.config.Port != c.Port || d.config.NumTargetPeers != c.NumTargetPeers {
+		t.Fatal("DHT not initialized with config")
+	}
+}
+
+func TestNodeIDAndKnownNodes(t *testing.T) {
+	c := NewConfig()
+	c.NodeID = "01abcdefghij01234567"
+	c.DHTRouters = ""
+	n1, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = n1.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer n1.Stop()
+	if n1.NodeID() != c.NodeID {
+		t.Fatalf("unexpected node id: %x", n1.NodeID())
+	}
+
+	c = NewConfig()
+	c.DHTRouters = ""
+	c.Nodes = []string{fmt.Sprintf("127.0.0.1:%d", n1.Port())}
+	n2, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = n2.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer n2.Stop()
+	if len(n2.NodeID()) != 20 {
+		t.Fatalf("invalid random node id: %x", n2.NodeID())
+	}
+
+	// n2 pings the node given in config and adds it to the routing table after reply.
+	var nodes []Node
+	for i := 0; i < 50 && len(nodes) == 0; i++ {
+		time.Sleep(100 * time.Millisecond)
+		nodes = n2.KnownNodes()
+	}
+	if len(nodes) != 1 {
+		t.Fatalf("unexpected number of known nodes: %d", len(nodes))
+	}
+	if nodes[0].ID != n1.NodeID() || nodes[0].Addr != c.Nodes[0] {
+		t.Fatalf("unexpected node: %x@%s", nodes[0].ID, nodes[0].Addr)
+	}
+	s := n2.Stats().IPv4
+	if s.Nodes != 1 || s.ReachableNodes != 1 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+	if len(s.Buckets) != 1 || s.Buckets[0].Prefix != commonBits(n1.NodeID(), n2.NodeID()) || s.Buckets[0].ReachableNodes != 1 {
+		t.Fatalf("unexpected buckets: %+v", s.Buckets)
+	}
+}
+
+func TestIPv6(t *testing.T) {
+	newConfig := func() *Config {
+		c := NewConfig()
+		c.Address = "127.0.0.1"
+		c.Address6 = "::1"
+		c.IPv6 = true
+		c.DHTRouters = ""
+		c.EnforceNodeID = true
+		return c
+	}
+	n1, err := New(newConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = n1.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer n1.Stop()
+	if n1.NodeID6() == "" {
+		t.Skip("IPv6 is not available")
+	}
+
+	c := newConfig()
+	c.Nodes = []string{fmt.Sprintf("[::1]:%d", n1.Port())}
+	n2, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = n2.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer n2.Stop()
+
+	var s Stats
+	for i := 0; i < 50; i++ {
+		time.Sleep(100 * time.Millisecond)
+		s = n2.Stats()
+		if s.IPv6 != nil && s.IPv6.ReachableNodes == 1 {
+			break
+		}
+	}
+	if s.IPv6 == nil || s.IPv6.ReachableNodes != 1 || s.IPv6.NodeID != n2.NodeID6() {
+		t.Fatalf("unexpected IPv6 stats: %+v", s.IPv6)
+	}
+	if s.IPv4.Nodes != 0 {
+		t.Fatalf("unexpected IPv4 stats: %+v", s.IPv4)
+	}
+	nodes := n2.KnownNodes()
+	if len(nodes) != 1 || nodes[0].ID != n1.NodeID6() {
+		t.Fatalf("unexpected known nodes: %+v", nodes)
+	}
+}
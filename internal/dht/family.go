@@ -0,0 +1,88 @@
+package dht
+
+import (
+	"net"
+	"time"
+)
+
+// family contains the state of DHT node that is specific to an address family.
+// IPv4 and IPv6 nodes have separate sockets, node IDs and routing tables (BEP 32).
+type family struct {
+	// "udp4" or "udp6"
+	proto string
+	// Key used in "want" argument and the name of the "nodes" key in responses.
+	want         string
+	nodesKey     string
+	contactLen   int
+	conn         *net.UDPConn
+	nodeId       string
+	routingTable *routingTable
+	peerStore    *peerStore
+	// Our external IP reported by other nodes in "ip" key of responses (BEP 42).
+	externalIP net.IP
+	ipVotes    map[string]int
+	ipVoters   map[string]struct{}
+	// Infohashes returned in sample_infohashes responses (BEP 51).
+	samples     string
+	samplesTime time.Time
+}
+
+func newFamily(proto string, cfg *Config, log *DebugLogger) *family {
+	f := &family{
+		proto:        proto,
+		routingTable: newRoutingTable(log),
+		peerStore:    newPeerStore(cfg.MaxInfoHashes, cfg.MaxInfoHashPeers),
+		ipVotes:      make(map[string]int),
+		ipVoters:     make(map[string]struct{}),
+	}
+	if proto == "udp4" {
+		f.want = "n4"
+		f.nodesKey = "nodes"
+		f.contactLen = v4nodeContactLen
+	} else {
+		f.want = "n6"
+		f.nodesKey = "nodes6"
+		f.contactLen = v6nodeContactLen
+	}
+	return f
+}
+
+// setNodeID changes the ID of our node in the family.
+// Nodes in the routing table are kept but the neighborhood is recalculated.
+func (f *family) setNodeID(id string) {
+	f.nodeId = id
+	f.routingTable.nodeId = id
+	f.routingTable.resetNeighborhoodBoundary()
+}
+
+// voteExternalIP counts the external IP address reported by a remote node.
+// Returns the IP address when enough number of nodes agree on the same address.
+func (f *family) voteExternalIP(ip net.IP, voter net.IP) net.IP {
+	if _, ok := f.ipVoters[voter.String()]; ok {
+		return nil
+	}
+	if len(f.ipVoters) >= maxExternalIPVoters {
+		// Votes are too scattered. Start over.
+		f.ipVotes = make(map[string]int)
+		f.ipVoters = make(map[string]struct{})
+	}
+	f.ipVoters[voter.String()] = struct{}{}
+	f.ipVotes[ip.String()]++
+	if f.ipVotes[ip.String()] < externalIPVotes {
+		return nil
+	}
+	f.ipVotes = make(map[string]int)
+	f.ipVoters = make(map[string]struct{})
+	if ip.Equal(f.externalIP) {
+		return nil
+	}
+	f.externalIP = ip
+	return ip
+}
+
+const (
+	// Number of nodes that must report the same external IP before we accept it.
+	externalIPVotes = 10
+	// Votes are reset after this number of nodes have voted without a consensus.
+	maxExternalIPVoters = 100
+)
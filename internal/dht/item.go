@@ -0,0 +1,577 @@
+package dht
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang/groupcache/lru"
+	bencode "github.com/jackpal/bencode-go"
+)
+
+// Storing arbitrary data in DHT is described in BEP 44.
+// Immutable items are stored under the SHA-1 hash of their value.
+// Mutable items are signed with an ed25519 key and stored under the SHA-1 hash of the public key and salt.
+
+const (
+	// Maximum length of the bencoded value of an item.
+	maxItemValueLen = 1000
+	// Maximum length of the salt of a mutable item.
+	maxItemSaltLen = 64
+	// Items are dropped if they are not put again in this duration.
+	itemExpiry = 2 * time.Hour
+	// Maximum number of nodes queried in a single item lookup.
+	maxItemLookupQueries = 100
+)
+
+var (
+	// ErrItemNotFound is returned when no node returns a valid item for the target.
+	ErrItemNotFound = errors.New("item not found in DHT")
+
+	errStopped = errors.New("DHT is stopped")
+)
+
+// Errors returned to the querying node in response to "put" queries.
+var (
+	errInvalidPut      = &protocolError{203, "Protocol Error, such as a malformed packet, invalid arguments, or bad token"}
+	errItemTooBig      = &protocolError{205, "message (v field) too big"}
+	errInvalidSig      = &protocolError{206, "invalid signature"}
+	errSaltTooBig      = &protocolError{207, "salt (salt field) too big"}
+	errCASMismatch     = &protocolError{301, "the CAS hash mismatched, re-read value and try again"}
+	errSeqLessThanCurr = &protocolError{302, "sequence number less than current"}
+)
+
+type protocolError struct {
+	code    int
+	message string
+}
+
+func (e *protocolError) Error() string {
+	return strconv.Itoa(e.code) + " " + e.message
+}
+
+// Item is a value stored in DHT.
+type Item struct {
+	// Bencoded value.
+	V []byte
+	// Public key of a mutable item. Nil for immutable items.
+	K ed25519.PublicKey
+	// Signature of a mutable item.
+	Sig []byte
+	// Sequence number of a mutable item. It must be increased on every update.
+	Seq int64
+	// Optional salt of a mutable item. Allows storing multiple items with the same key.
+	Salt []byte
+}
+
+// NewImmutableItem returns a new item with bencoded value v.
+func NewImmutableItem(v []byte) *Item {
+	return &Item{V: v}
+}
+
+// NewMutableItem returns a new item with bencoded value v signed with the key.
+func NewMutableItem(key ed25519.PrivateKey, salt []byte, seq int64, v []byte) *Item {
+	return &Item{
+		V:    v,
+		K:    key.Public().(ed25519.PublicKey),
+		Sig:  ed25519.Sign(key, signedBytes(salt, seq, v)),
+		Seq:  seq,
+		Salt: salt,
+	}
+}
+
+// ImmutableTarget returns the 20 bytes target that an immutable item with bencoded value v is stored under.
+func ImmutableTarget(v []byte) string {
+	sum := sha1.Sum(v)
+	return string(sum[:])
+}
+
+// MutableTarget returns the 20 bytes target that mutable items with the public key and salt are stored under.
+func MutableTarget(k ed25519.PublicKey, salt []byte) string {
+	h := sha1.New()
+	h.Write(k)
+	h.Write(salt)
+	return string(h.Sum(nil))
+}
+
+// Mutable returns true if the item is signed with a key.
+func (i *Item) Mutable() bool {
+	return i.K != nil
+}
+
+// Target returns the 20 bytes target that the item is stored under.
+func (i *Item) Target() string {
+	if i.Mutable() {
+		return MutableTarget(i.K, i.Salt)
+	}
+	return ImmutableTarget(i.V)
+}
+
+// signedBytes returns the buffer that the signature of a mutable item is calculated over.
+func signedBytes(salt []byte, seq int64, v []byte) []byte {
+	var b bytes.Buffer
+	if len(salt) > 0 {
+		fmt.Fprintf(&b, "4:salt%d:%s", len(salt), salt)
+	}
+	fmt.Fprintf(&b, "3:seqi%de1:v", seq)
+	b.Write(v)
+	return b.Bytes()
+}
+
+func (i *Item) verify() error {
+	if len(i.V) > maxItemValueLen {
+		return errItemTooBig
+	}
+	if _, err := decodeValue(i.V); err != nil {
+		return errInvalidPut
+	}
+	if !i.Mutable() {
+		return nil
+	}
+	if len(i.Salt) > maxItemSaltLen {
+		return errSaltTooBig
+	}
+	if len(i.K) != ed25519.PublicKeySize || len(i.Sig) != ed25519.SignatureSize {
+		return errInvalidPut
+	}
+	if !ed25519.Verify(i.K, signedBytes(i.Salt, i.Seq, i.V), i.Sig) {
+		return errInvalidSig
+	}
+	return nil
+}
+
+// decodeValue decodes a bencoded value so it can be embedded in messages.
+// Only canonical encodings are accepted because hashes and signatures are calculated over the encoded value.
+func decodeValue(v []byte) (value interface{}, err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("cannot decode value: %v", x)
+		}
+	}()
+	value, err = bencode.Decode(bytes.NewReader(v))
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	err = bencode.Marshal(&b, value)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(b.Bytes(), v) {
+		return nil, errors.New("value is not in canonical form")
+	}
+	return value, nil
+}
+
+// itemFields contains the BEP 44 fields in query arguments or response values.
+// They are read separately from responseType because values can be of any bencode type.
+type itemFields struct {
+	V    []byte
+	K    string
+	Sig  string
+	Salt string
+	Seq  *int64
+	Cas  *int64
+}
+
+func readItemFields(b []byte, key string) (f itemFields, err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("cannot decode message: %v", x)
+		}
+	}()
+	data, err := bencode.Decode(bytes.NewReader(b))
+	if err != nil {
+		return
+	}
+	m, _ := data.(map[string]interface{})
+	d, _ := m[key].(map[string]interface{})
+	if v, ok := d["v"]; ok {
+		var buf bytes.Buffer
+		err = bencode.Marshal(&buf, v)
+		if err != nil {
+			return
+		}
+		f.V = buf.Bytes()
+	}
+	f.K, _ = d["k"].(string)
+	f.Sig, _ = d["sig"].(string)
+	f.Salt, _ = d["salt"].(string)
+	if seq, ok := d["seq"].(int64); ok {
+		f.Seq = &seq
+	}
+	if cas, ok := d["cas"].(int64); ok {
+		f.Cas = &cas
+	}
+	return
+}
+
+func (f *itemFields) item() *Item {
+	i := &Item{V: f.V}
+	if f.K != "" {
+		i.K = ed25519.PublicKey(f.K)
+		i.Sig = []byte(f.Sig)
+		if f.Seq != nil {
+			i.Seq = *f.Seq
+		}
+		if f.Salt != "" {
+			i.Salt = []byte(f.Salt)
+		}
+	}
+	return i
+}
+
+// itemStore keeps the items put by other nodes.
+type itemStore struct {
+	items *lru.Cache
+}
+
+type storedItem struct {
+	item *Item
+	// Decoded value of item.
+	value   interface{}
+	expires time.Time
+}
+
+func newItemStore(maxItems int) *itemStore {
+	return &itemStore{items: lru.New(maxItems)}
+}
+
+func (s *itemStore) get(target string) *storedItem {
+	v, ok := s.items.Get(target)
+	if !ok {
+		return nil
+	}
+	si := v.(*storedItem)
+	if time.Now().After(si.expires) {
+		s.items.Remove(target)
+		return nil
+	}
+	return si
+}
+
+// put validates the item and stores it. cas is the expected sequence number of the stored item, if given.
+func (s *itemStore) put(i *Item, cas *int64) error {
+	if err := i.verify(); err != nil {
+		return err
+	}
+	target := i.Target()
+	if old := s.get(target); old != nil && i.Mutable() {
+		if cas != nil && *cas != old.item.Seq {
+			return errCASMismatch
+		}
+		if i.Seq < old.item.Seq || (i.Seq == old.item.Seq && !bytes.Equal(i.V, old.item.V)) {
+			return errSeqLessThanCurr
+		}
+	}
+	value, _ := decodeValue(i.V)
+	s.items.Add(target, &storedItem{item: i, value: value, expires: time.Now().Add(itemExpiry)})
+	return nil
+}
+
+// itemLookup is an iterative search for an item, optionally followed by storing an item on the closest nodes.
+type itemLookup struct {
+	target InfoHash
+	// Expected public key and salt of the mutable item. Nil for immutable items.
+	k    ed25519.PublicKey
+	salt []byte
+	// Item to put on the closest nodes when the lookup is finished.
+	put *Item
+	// The latest valid item returned by nodes.
+	item *Item
+	// Write tokens of nodes replied to "get" queries, keyed by node address.
+	tokens  map[string]itemToken
+	queried map[string]struct{}
+	done    bool
+	// Closed when an immutable item is found. There is no need to search more.
+	found chan struct{}
+	// Receives the number of nodes that the item is put on when the lookup is finished.
+	result chan int
+}
+
+type itemToken struct {
+	f     *family
+	addr  net.UDPAddr
+	id    string
+	token string
+}
+
+func newItemLookup(target string) *itemLookup {
+	return &itemLookup{
+		target:  InfoHash(target),
+		tokens:  make(map[string]itemToken),
+		queried: make(map[string]struct{}),
+		found:   make(chan struct{}),
+		result:  make(chan int, 1),
+	}
+}
+
+// accept saves the item returned by a node if it is valid and newer than the one found before.
+func (l *itemLookup) accept(i *Item) {
+	if l.k == nil {
+		if i.Mutable() || ImmutableTarget(i.V) != string(l.target) || i.verify() != nil {
+			return
+		}
+		if l.item == nil && l.put == nil {
+			close(l.found)
+		}
+		l.item = i
+		return
+	}
+	// Salt is not sent in responses.
+	i.Salt = l.salt
+	if !bytes.Equal(i.K, l.k) || i.verify() != nil {
+		return
+	}
+	if l.item == nil || i.Seq > l.item.Seq {
+		l.item = i
+	}
+}
+
+// GetImmutableItem searches the immutable item with the 20 bytes target in DHT.
+// Returns ErrItemNotFound if no node returns the item before timeout.
+func (d *DHT) GetImmutableItem(target string, timeout time.Duration) (*Item, error) {
+	l := newItemLookup(target)
+	_, err := d.lookupItem(l, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if l.item == nil {
+		return nil, ErrItemNotFound
+	}
+	return l.item, nil
+}
+
+// GetMutableItem searches the mutable item with the public key and salt in DHT.
+// Nodes are queried until timeout and the item with the highest sequence number is returned.
+// Returns ErrItemNotFound if no node returns a valid item.
+func (d *DHT) GetMutableItem(k ed25519.PublicKey, salt []byte, timeout time.Duration) (*Item, error) {
+	l := newItemLookup(MutableTarget(k, salt))
+	l.k = k
+	l.salt = salt
+	_, err := d.lookupItem(l, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if l.item == nil {
+		return nil, ErrItemNotFound
+	}
+	return l.item, nil
+}
+
+// PutItem searches the nodes closest to the target of the item until timeout and stores the item on them.
+// Returns the number of nodes that the item is sent to.
+// Items expire in 2 hours, so they must be put again periodically.
+func (d *DHT) PutItem(i *Item, timeout time.Duration) (int, error) {
+	if err := i.verify(); err != nil {
+		return 0, err
+	}
+	l := newItemLookup(i.Target())
+	l.put = i
+	return d.lookupItem(l, timeout)
+}
+
+func (d *DHT) lookupItem(l *itemLookup, timeout time.Duration) (int, error) {
+	select {
+	case d.itemRequest <- l:
+	case <-d.stop:
+		return 0, errStopped
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-l.found:
+	case <-d.stop:
+		return 0, errStopped
+	}
+	select {
+	case d.itemLookupDone <- l:
+	case <-d.stop:
+		return 0, errStopped
+	}
+	select {
+	case n := <-l.result:
+		return n, nil
+	case <-d.stop:
+		return 0, errStopped
+	}
+}
+
+func (d *DHT) startItemLookup(l *itemLookup) {
+	if l.put != nil {
+		// We are also a node in the network.
+		if err := d.items.put(l.put, nil); err != nil {
+			d.DebugLogger.Debugf("DHT: cannot store own item: %v", err)
+		}
+	}
+	for _, f := range d.families() {
+		closest := f.routingTable.lookup(l.target)
+		if len(closest) == 0 {
+			closest = d.routers(f)
+		}
+		for _, r := range closest {
+			d.getItemFrom(f, r, l)
+		}
+	}
+}
+
+func (d *DHT) finishItemLookup(l *itemLookup) {
+	l.done = true
+	var n int
+	if l.put != nil {
+		tokens := make([]itemToken, 0, len(l.tokens))
+		for _, t := range l.tokens {
+			tokens = append(tokens, t)
+		}
+		sort.Slice(tokens, func(i, j int) bool {
+			return hashDistance(l.target, InfoHash(tokens[i].id)) < hashDistance(l.target, InfoHash(tokens[j].id))
+		})
+		for _, t := range tokens {
+			if n == kNodes {
+				break
+			}
+			d.putItemTo(t, l.put)
+			n++
+		}
+	}
+	l.result <- n
+}
+
+func (d *DHT) getItemFrom(f *family, r *remoteNode, l *itemLookup) {
+	addr := r.address.String()
+	if _, ok := l.queried[addr]; ok || len(l.queried) >= maxItemLookupQueries {
+		return
+	}
+	l.queried[addr] = struct{}{}
+	totalSentGet.Add(1)
+	ty := "get"
+	transId := r.newQuery(ty)
+	r.pendingQueries[transId].ih = l.target
+	r.pendingQueries[transId].lookup = l
+	queryArguments := map[string]interface{}{
+		"id":     f.nodeId,
+		"target": string(l.target),
+	}
+	if want := d.want(); want != nil {
+		queryArguments["want"] = want
+	}
+	query := queryMessage{transId, "q", ty, queryArguments}
+	d.DebugLogger.Debugf("DHT sending get. nodeID: %x@%v, target: %x", r.id, r.address, l.target)
+	r.lastSearchTime = time.Now()
+	sendMsg(f.conn, r.address, query, d.DebugLogger)
+}
+
+func (d *DHT) putItemTo(t itemToken, i *Item) {
+	r, err := t.f.routingTable.getOrCreateNode("", t.addr.String(), t.f.proto)
+	if err != nil {
+		d.DebugLogger.Debugf("putItemTo error: %v", err)
+		return
+	}
+	totalSentPut.Add(1)
+	ty := "put"
+	transId := r.newQuery(ty)
+	value, _ := decodeValue(i.V)
+	queryArguments := map[string]interface{}{
+		"id":    t.f.nodeId,
+		"token": t.token,
+		"v":     value,
+	}
+	if i.Mutable() {
+		queryArguments["k"] = string(i.K)
+		queryArguments["sig"] = string(i.Sig)
+		queryArguments["seq"] = i.Seq
+		if len(i.Salt) > 0 {
+			queryArguments["salt"] = string(i.Salt)
+		}
+	}
+	query := queryMessage{transId, "q", ty, queryArguments}
+	d.DebugLogger.Debugf("DHT sending put. nodeID: %x@%v, target: %x", r.id, r.address, i.Target())
+	sendMsg(t.f.conn, t.addr, query, d.DebugLogger)
+}
+
+// Process another node's response to a get query.
+func (d *DHT) processGetItemResults(f *family, node *remoteNode, resp responseType, b []byte) {
+	totalRecvGetReply.Add(1)
+	query := node.pendingQueries[resp.T]
+	l := query.lookup
+	if l == nil || l.done {
+		return
+	}
+	if resp.R.Token != "" {
+		l.tokens[node.address.String()] = itemToken{f: f, addr: node.address, id: resp.R.Id, token: resp.R.Token}
+	}
+	if fields, err := readItemFields(b, "r"); err == nil && fields.V != nil {
+		l.accept(fields.item())
+	}
+	for _, f2 := range d.families() {
+		nodelist := d.nodeList(f2, resp)
+		d.newNodes(f2, nodelist, node, query)
+		for _, address := range parseNodesString(nodelist, f2.proto, d.DebugLogger) {
+			r, _, existed, err := f2.routingTable.hostPortToNode(address, f2.proto)
+			if err == nil && existed {
+				d.getItemFrom(f2, r, l)
+			}
+		}
+	}
+}
+
+func (d *DHT) replyGetItem(f *family, addr net.UDPAddr, r responseType, b []byte) {
+	totalRecvGet.Add(1)
+	target := InfoHash(r.A.Target)
+	d.DebugLogger.Debugf("DHT get. Host: %v , nodeID: %x , target: %x", addr, r.A.Id, target)
+
+	r0 := map[string]interface{}{"id": f.nodeId, "token": d.hostToken(addr, d.tokenSecrets[0])}
+	if si := d.items.get(string(target)); si != nil {
+		fields, _ := readItemFields(b, "a")
+		if fields.Seq == nil || si.item.Seq > *fields.Seq {
+			r0["v"] = si.value
+		}
+		if si.item.Mutable() {
+			r0["k"] = string(si.item.K)
+			r0["sig"] = string(si.item.Sig)
+			r0["seq"] = si.item.Seq
+		}
+	}
+	d.addClosestNodes(f, r0, target, r.A.Want)
+	d.sendReply(f, addr, r.T, r0)
+}
+
+func (d *DHT) replyPutItem(f *family, addr net.UDPAddr, r responseType, b []byte) {
+	totalRecvPut.Add(1)
+	d.DebugLogger.Debugf("DHT put. Host: %v , nodeID: %x", addr, r.A.Id)
+	if !d.checkToken(addr, r.A.Token) {
+		d.sendError(f, addr, r.T, errInvalidPut)
+		return
+	}
+	fields, err := readItemFields(b, "a")
+	if err != nil || fields.V == nil {
+		d.sendError(f, addr, r.T, errInvalidPut)
+		return
+	}
+	if fields.K != "" && fields.Seq == nil {
+		d.sendError(f, addr, r.T, errInvalidPut)
+		return
+	}
+	if err = d.items.put(fields.item(), fields.Cas); err != nil {
+		d.DebugLogger.Debugf("DHT: rejected put from %v: %v", addr, err)
+		d.sendError(f, addr, r.T, err.(*protocolError))
+		return
+	}
+	d.sendReply(f, addr, r.T, map[string]interface{}{"id": f.nodeId})
+}
+
+func (d *DHT) sendError(f *family, addr net.UDPAddr, t string, e *protocolError) {
+	msg := errorMessage{
+		T: t,
+		Y: "e",
+		E: []interface{}{e.code, e.message},
+	}
+	sendMsg(f.conn, addr, msg, d.DebugLogger)
+}
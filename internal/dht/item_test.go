@@ -0,0 +1,123 @@
+package dht
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Test vectors from BEP 44.
+func TestItemVectors(t *testing.T) {
+	v := []byte("12:Hello World!")
+	if target := hex.EncodeToString([]byte(ImmutableTarget(v))); target != "e5f96f6f38320f0f33959cb4d3d656452117aadb" {
+		t.Fatalf("unexpected immutable target: %s", target)
+	}
+
+	k, _ := hex.DecodeString("77ff84905a91936367c01360803104f92432fcd904a43511876df5cdf3e7e548")
+	sig, _ := hex.DecodeString("305ac8aeb6c9c151fa120f120ea2cfb923564e11552d06a5d856091e5e853cff1260d3f39e4999684aa92eb73ffd136e6f4f3ecbfda0ce53a1608ecd7ae21f01")
+	i := &Item{V: v, K: k, Sig: sig, Seq: 1}
+	if err := i.verify(); err != nil {
+		t.Fatal(err)
+	}
+	if target := hex.EncodeToString([]byte(i.Target())); target != "4a533d47ec9c7d95b1ad75f576cffc641853b750" {
+		t.Fatalf("unexpected mutable target: %s", target)
+	}
+
+	sig, _ = hex.DecodeString("6834284b6b24c3204eb2fea824d82f88883a3d95e8b4a21b8c0ded553d17d17ddf9a8a7104b1258f30bed3787e6cb896fca78c58f8e03b5f18f14951a87d9a08")
+	i = &Item{V: v, K: k, Sig: sig, Seq: 1, Salt: []byte("foobar")}
+	if err := i.verify(); err != nil {
+		t.Fatal(err)
+	}
+	if target := hex.EncodeToString([]byte(i.Target())); target != "411eba73b6f087ca51a3795d9c8c938d365e32c1" {
+		t.Fatalf("unexpected mutable target with salt: %s", target)
+	}
+	i.Seq = 2
+	if err := i.verify(); err != errInvalidSig {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestItemStore(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newItemStore(10)
+	if err = s.put(NewMutableItem(key, nil, 2, []byte("i2e")), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.put(NewMutableItem(key, nil, 1, []byte("i1e")), nil); err != errSeqLessThanCurr {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cas := int64(1)
+	if err = s.put(NewMutableItem(key, nil, 3, []byte("i3e")), &cas); err != errCASMismatch {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = s.put(NewImmutableItem([]byte("d1:bi1e1:ai2ee")), nil); err != errInvalidPut {
+		t.Fatalf("non-canonical value must be rejected: %v", err)
+	}
+}
+
+func TestPutGetItem(t *testing.T) {
+	newNode := func(routers string) *DHT {
+		c := NewConfig()
+		c.Address = "127.0.0.1"
+		c.DHTRouters = routers
+		c.ClientPerMinuteLimit = 1000
+		c.EnforceNodeID = true
+		n, err := New(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = n.Start(); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	n1 := newNode("")
+	defer n1.Stop()
+	router := fmt.Sprintf("127.0.0.1:%d", n1.Port())
+	n2 := newNode(router)
+	defer n2.Stop()
+	n3 := newNode(router)
+	defer n3.Stop()
+
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt := []byte("salt")
+	for seq := int64(1); seq <= 2; seq++ {
+		n, err := n2.PutItem(NewMutableItem(key, salt, seq, []byte(fmt.Sprintf("i%de", seq))), 500*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			t.Fatal("item is not put on any node")
+		}
+	}
+	i, err := n3.GetMutableItem(key.Public().(ed25519.PublicKey), salt, 500*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.Seq != 2 || string(i.V) != "i2e" {
+		t.Fatalf("unexpected item: %+v", i)
+	}
+	if _, err = n3.GetMutableItem(key.Public().(ed25519.PublicKey), nil, 500*time.Millisecond); err != ErrItemNotFound {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	v := []byte("5:hello")
+	if _, err = n2.PutItem(NewImmutableItem(v), 500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	i, err = n3.GetImmutableItem(ImmutableTarget(v), 500*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(i.V) != string(v) {
+		t.Fatalf("unexpected value: %q", i.V)
+	}
+}
@@ -0,0 +1,17 @@
+// Copyright 2011 Yves Junqueira. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dht
+
+type DebugLogger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+type nullLogger struct{}
+
+func (l *nullLogger) Debugf(format string, args ...interface{}) {}
+func (l *nullLogger) Infof(format string, args ...interface{})  {}
+func (l *nullLogger) Errorf(format string, args ...interface{}) {}
@@ -0,0 +1,98 @@
+package dht
+
+import (
+	"errors"
+	"hash/crc32"
+	"net"
+)
+
+// Node ID restrictions are described in BEP 42.
+// First 21 bits of the node ID are derived from the external IP address of the node.
+// Last byte of the node ID contains the random number used in derivation.
+
+var (
+	v4Mask = []byte{0x03, 0x0f, 0x3f, 0xff}
+	v6Mask = []byte{0x01, 0x03, 0x07, 0x0f, 0x1f, 0x3f, 0x7f, 0xff}
+
+	crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+	// Nodes in local networks are exempt from node ID restrictions.
+	localNets = mustParseCIDRs(
+		"10.0.0.0/8",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"169.254.0.0/16",
+		"127.0.0.0/8",
+		"::1/128",
+		"fe80::/10",
+		"fc00::/7",
+	)
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	ret := make([]*net.IPNet, len(cidrs))
+	for i, s := range cidrs {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			panic(err)
+		}
+		ret[i] = n
+	}
+	return ret
+}
+
+// nodeIDPrefix returns the CRC32-C of the masked IP address that the first 21 bits of node ID is derived from.
+func nodeIDPrefix(ip net.IP, r byte) (uint32, error) {
+	var mask []byte
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		mask = v4Mask
+	} else if len(ip) == net.IPv6len {
+		mask = v6Mask
+	} else {
+		return 0, errors.New("invalid IP address")
+	}
+	b := make([]byte, len(mask))
+	for i := range mask {
+		b[i] = ip[i] & mask[i]
+	}
+	b[0] |= (r & 0x07) << 5
+	return crc32.Checksum(b, crc32cTable), nil
+}
+
+// GenerateNodeID returns a random 20 bytes node ID that is valid for the IP address.
+func GenerateNodeID(ip net.IP) (string, error) {
+	id, err := randNodeId()
+	if err != nil {
+		return "", err
+	}
+	r := id[19]
+	crc, err := nodeIDPrefix(ip, r)
+	if err != nil {
+		return "", err
+	}
+	id[0] = byte(crc >> 24)
+	id[1] = byte(crc >> 16)
+	id[2] = byte(crc>>8)&0xf8 | id[2]&0x07
+	return string(id), nil
+}
+
+// ValidNodeID returns true if the node ID is derived from the IP address.
+// IDs of nodes in local networks are always valid.
+func ValidNodeID(id string, ip net.IP) bool {
+	if bogusId(id) {
+		return false
+	}
+	for _, n := range localNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	crc, err := nodeIDPrefix(ip, id[19])
+	if err != nil {
+		return false
+	}
+	return id[0] == byte(crc>>24) &&
+		id[1] == byte(crc>>16) &&
+		id[2]&0xf8 == byte(crc>>8)&0xf8
+}
@@ -0,0 +1,52 @@
+package dht
+
+import (
+	"encoding/hex"
+	"net"
+	"testing"
+)
+
+// Test vectors from BEP 42.
+var nodeIDTests = []struct {
+	ip string
+	id string
+}{
+	{"124.31.75.21", "5fbfbff10c5d6a4ec8a88e4c6ab4c28b95eee401"},
+	{"21.75.31.124", "5a3ce9c14e7a08645677bbd1cfe7d8f956d53256"},
+	{"65.23.51.170", "a5d43220bc8f112a3d426c84764f8c2a1150e616"},
+	{"84.124.73.14", "1b0321dd1bb1fe518101ceef99462b947a01ff41"},
+	{"43.213.53.83", "e56f6cbf5b7c4be0237986d5243b87aa6d51305a"},
+}
+
+func TestValidNodeID(t *testing.T) {
+	for _, tc := range nodeIDTests {
+		id, err := hex.DecodeString(tc.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ip := net.ParseIP(tc.ip)
+		if !ValidNodeID(string(id), ip) {
+			t.Errorf("node ID %s must be valid for %s", tc.id, tc.ip)
+		}
+		id[0] ^= 0xff
+		if ValidNodeID(string(id), ip) {
+			t.Errorf("modified node ID must not be valid for %s", tc.ip)
+		}
+	}
+	if !ValidNodeID("01234567890123456789", net.ParseIP("192.168.1.2")) {
+		t.Error("node IDs in local networks must be valid")
+	}
+}
+
+func TestGenerateNodeID(t *testing.T) {
+	for _, s := range []string{"124.31.75.21", "2001:db8::1"} {
+		ip := net.ParseIP(s)
+		id, err := GenerateNodeID(ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ValidNodeID(id, ip) {
+			t.Errorf("generated node ID %x is not valid for %s", id, s)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package dht
+
+import "sort"
+
+// Node is a remote DHT node that has replied to our queries.
+type Node struct {
+	// 20 bytes node ID.
+	ID string
+	// UDP address of the node in "host:port" format.
+	Addr string
+}
+
+// Stats contains statistics about the routing tables.
+type Stats struct {
+	IPv4 TableStats
+	// nil if IPv6 is disabled.
+	IPv6 *TableStats
+}
+
+// TableStats contains statistics about the routing table of an address family.
+type TableStats struct {
+	// 20 bytes node ID used in the address family.
+	NodeID string
+	// Number of nodes in the routing table, including the ones not replied yet.
+	Nodes int
+	// Number of nodes that have replied to our queries.
+	ReachableNodes int
+	// Non-empty buckets ordered by the number of leading bits shared with our node ID.
+	Buckets []Bucket
+}
+
+// Bucket is a group of nodes in the routing table sharing the same number of leading bits with our node ID.
+// The routing table is a binary tree, so buckets are only computed for reporting.
+type Bucket struct {
+	// Number of leading bits shared with our node ID.
+	Prefix int
+	// Number of nodes in the bucket.
+	Nodes int
+	// Number of nodes in the bucket that have replied to our queries.
+	ReachableNodes int
+}
+
+// NodeID returns the 20 bytes ID of the IPv4 DHT node.
+// The ID may change after start if it is not valid for the external IP address (BEP 42).
+func (d *DHT) NodeID() string {
+	d.mNodeID.RLock()
+	defer d.mNodeID.RUnlock()
+	return d.v4.nodeId
+}
+
+// NodeID6 returns the 20 bytes ID of the IPv6 DHT node.
+// Returns empty string if IPv6 is disabled.
+func (d *DHT) NodeID6() string {
+	d.mNodeID.RLock()
+	defer d.mNodeID.RUnlock()
+	if d.v6 == nil {
+		return ""
+	}
+	return d.v6.nodeId
+}
+
+// Stats returns statistics about the routing tables.
+// Must be called after Start.
+func (d *DHT) Stats() Stats {
+	c := make(chan Stats, 1)
+	select {
+	case d.statsRequest <- c:
+		return <-c
+	case <-d.stop:
+		return Stats{}
+	}
+}
+
+// KnownNodes returns the nodes in the routing tables that have replied to our queries.
+// Returned nodes can be passed in Config.Nodes to speed up bootstrapping on next run.
+// Must be called after Start.
+func (d *DHT) KnownNodes() []Node {
+	c := make(chan []Node, 1)
+	select {
+	case d.knownNodesRequest <- c:
+		return <-c
+	case <-d.stop:
+		return nil
+	}
+}
+
+func (d *DHT) stats() Stats {
+	s := Stats{IPv4: d.v4.routingTable.stats()}
+	if d.v6 != nil {
+		s6 := d.v6.routingTable.stats()
+		s.IPv6 = &s6
+	}
+	return s
+}
+
+func (d *DHT) knownNodes() []Node {
+	var nodes []Node
+	for _, f := range d.families() {
+		nodes = append(nodes, f.routingTable.knownNodes()...)
+	}
+	return nodes
+}
+
+func (r *routingTable) stats() TableStats {
+	s := TableStats{NodeID: r.nodeId}
+	buckets := make(map[int]*Bucket)
+	for _, n := range r.addresses {
+		s.Nodes++
+		if n.reachable {
+			s.ReachableNodes++
+		}
+		if bogusId(n.id) {
+			continue
+		}
+		prefix := commonBits(r.nodeId, n.id)
+		b, ok := buckets[prefix]
+		if !ok {
+			b = &Bucket{Prefix: prefix}
+			buckets[prefix] = b
+		}
+		b.Nodes++
+		if n.reachable {
+			b.ReachableNodes++
+		}
+	}
+	s.Buckets = make([]Bucket, 0, len(buckets))
+	for _, b := range buckets {
+		s.Buckets = append(s.Buckets, *b)
+	}
+	sort.Slice(s.Buckets, func(i, j int) bool { return s.Buckets[i].Prefix < s.Buckets[j].Prefix })
+	return s
+}
+
+func (r *routingTable) knownNodes() []Node {
+	tbl := r.reachableNodes()
+	nodes := make([]Node, 0, len(tbl))
+	for addr, id := range tbl {
+		nodes = append(nodes, Node{ID: string(id), Addr: addr})
+	}
+	return nodes
+}
@@ -0,0 +1,36 @@
+// Package diskspace provides functions for querying free space on the disk.
+package diskspace
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Free returns the number of bytes available to the user on the filesystem containing path.
+// If path does not exist yet, the nearest existing parent directory is queried.
+func Free(path string) (int64, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		_, err = os.Stat(path)
+		if !os.IsNotExist(err) {
+			break
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			break
+		}
+		path = parent
+	}
+	if err != nil {
+		return 0, err
+	}
+	return free(path)
+}
+
+// IsFull returns true if err is caused by the disk being full.
+func IsFull(err error) bool {
+	return isFull(err)
+}
@@ -0,0 +1,26 @@
+// +build windows
+
+package diskspace
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+func free(path string) (int64, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var avail uint64
+	err = windows.GetDiskFreeSpaceEx(p, &avail, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	return int64(avail), nil
+}
+
+func isFull(err error) bool {
+	return errors.Is(err, windows.ERROR_DISK_FULL) || errors.Is(err, windows.ERROR_HANDLE_DISK_FULL)
+}
@@ -0,0 +1,352 @@
+// Package filepool provides a pool of open files that is shared by all torrents in a Session.
+// Files are opened when they are read or written, and closed when they are idle or the pool is full.
+package filepool
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/rain/internal/storage"
+	"github.com/rcrowley/go-metrics"
+)
+
+// Pool keeps the most recently used files open.
+type Pool struct {
+	maxOpen     int
+	idleTimeout time.Duration
+
+	// Number of accesses to a file that is already open.
+	Hits metrics.Meter
+	// Number of accesses to a file that needs to be opened.
+	Misses metrics.Meter
+
+	m   sync.Mutex
+	lru *list.List // open files, most recently used at front
+
+	closeC chan struct{}
+	doneC  chan struct{}
+}
+
+// New returns a new Pool.
+// At most maxOpen files are kept open if they are not being read or written at the moment. Zero means no limit.
+// Files that are not used for idleTimeout are closed. Zero means files are not closed when idle.
+func New(maxOpen int, idleTimeout time.Duration) *Pool {
+	p := &Pool{
+		maxOpen:     maxOpen,
+		idleTimeout: idleTimeout,
+		Hits:        metrics.NewMeter(),
+		Misses:      metrics.NewMeter(),
+		lru:         list.New(),
+		closeC:      make(chan struct{}),
+		doneC:       make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Close the pool. Files must be closed before closing the pool.
+func (p *Pool) Close() {
+	close(p.closeC)
+	<-p.doneC
+	p.Hits.Stop()
+	p.Misses.Stop()
+}
+
+// Len returns the number of open files in the pool.
+func (p *Pool) Len() int {
+	p.m.Lock()
+	defer p.m.Unlock()
+	return p.lru.Len()
+}
+
+func (p *Pool) run() {
+	defer close(p.doneC)
+	if p.idleTimeout <= 0 {
+		<-p.closeC
+		return
+	}
+	ticker := time.NewTicker(p.idleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.closeIdle()
+		case <-p.closeC:
+			return
+		}
+	}
+}
+
+func (p *Pool) closeIdle() {
+	var files []storage.File
+	p.m.Lock()
+	for e := p.lru.Back(); e != nil; {
+		prev := e.Prev()
+		f := e.Value.(*File)
+		if f.inUse == 0 && time.Since(f.lastUsed) > p.idleTimeout {
+			files = append(files, p.removeLocked(f))
+		}
+		e = prev
+	}
+	p.m.Unlock()
+	closeFiles(files)
+}
+
+// evictLocked removes the least recently used files that are not in use until the pool size is below the limit.
+// Returned files must be closed after releasing the lock.
+func (p *Pool) evictLocked() []storage.File {
+	if p.maxOpen <= 0 {
+		return nil
+	}
+	var files []storage.File
+	for e := p.lru.Back(); e != nil && p.lru.Len() > p.maxOpen; {
+		prev := e.Prev()
+		f := e.Value.(*File)
+		if f.inUse == 0 {
+			files = append(files, p.removeLocked(f))
+		}
+		e = prev
+	}
+	return files
+}
+
+func (p *Pool) removeLocked(f *File) storage.File {
+	p.lru.Remove(f.elem)
+	f.elem = nil
+	file := f.file
+	f.file = nil
+	return file
+}
+
+func closeFiles(files []storage.File) {
+	for _, f := range files {
+		_ = f.Close()
+	}
+}
+
+// Wrap returns a Storage that opens its files through the pool.
+func (p *Pool) Wrap(sto storage.Storage) storage.Storage {
+	return &poolStorage{Storage: sto, pool: p, files: make(map[string]*File)}
+}
+
+type poolStorage struct {
+	storage.Storage
+	pool *Pool
+
+	// Open files by name. Guarded by pool mutex.
+	files map[string]*File
+}
+
+// Open the file in underlying storage and put it into the pool.
+// The file is reopened when it is accessed again after it is closed by the pool.
+func (s *poolStorage) Open(name string, size int64) (storage.File, bool, error) {
+	of, exists, err := s.Storage.Open(name, size)
+	if err != nil {
+		return nil, false, err
+	}
+	f := &File{
+		pool: s.pool,
+		name: name,
+		size: size,
+		sto:  s,
+	}
+	p := s.pool
+	p.m.Lock()
+	s.files[name] = f
+	f.file = of
+	f.lastUsed = time.Now()
+	f.elem = p.lru.PushFront(f)
+	files := p.evictLocked()
+	p.m.Unlock()
+	closeFiles(files)
+	return f, exists, nil
+}
+
+// Rename the file in underlying storage.
+// The pooled file is closed before renaming and it is opened with the new name when it is accessed again.
+func (s *poolStorage) Rename(oldName, newName string) error {
+	p := s.pool
+	p.m.Lock()
+	f := s.files[oldName]
+	p.m.Unlock()
+	if f == nil {
+		return s.Storage.Rename(oldName, newName)
+	}
+
+	// Prevent the file from being opened with the old name while renaming.
+	f.mOpen.Lock()
+	defer f.mOpen.Unlock()
+
+	var files []storage.File
+	p.m.Lock()
+	if f.file != nil && f.inUse == 0 {
+		files = append(files, p.removeLocked(f))
+	}
+	p.m.Unlock()
+	closeFiles(files)
+
+	err := s.Storage.Rename(oldName, newName)
+	if err != nil {
+		return err
+	}
+	p.m.Lock()
+	f.name = newName
+	if s.files[oldName] == f {
+		delete(s.files, oldName)
+	}
+	s.files[newName] = f
+	p.m.Unlock()
+	return nil
+}
+
+// File is a handle that opens the underlying file on demand.
+type File struct {
+	pool *Pool
+	name string
+	size int64
+	sto  *poolStorage
+
+	// Prevents opening the same file concurrently.
+	mOpen sync.Mutex
+
+	// Fields below are guarded by pool mutex.
+	file     storage.File // nil if not open
+	elem     *list.Element
+	inUse    int
+	lastUsed time.Time
+	closed   bool
+}
+
+var _ storage.File = (*File)(nil)
+
+func (f *File) acquire() (storage.File, error) {
+	f.mOpen.Lock()
+	defer f.mOpen.Unlock()
+
+	p := f.pool
+	p.m.Lock()
+	if f.closed {
+		p.m.Unlock()
+		return nil, os.ErrClosed
+	}
+	if f.file != nil {
+		f.inUse++
+		p.lru.MoveToFront(f.elem)
+		file := f.file
+		p.m.Unlock()
+		p.Hits.Mark(1)
+		return file, nil
+	}
+	p.m.Unlock()
+
+	p.Misses.Mark(1)
+	// Do not create the file again if it is deleted while it is closed.
+	_, err := f.sto.Storage.Stat(f.name)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("file is deleted: %s", f.name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	file, _, err := f.sto.Storage.Open(f.name, f.size)
+	if err != nil {
+		return nil, err
+	}
+
+	p.m.Lock()
+	if f.closed {
+		p.m.Unlock()
+		_ = file.Close()
+		return nil, os.ErrClosed
+	}
+	f.file = file
+	f.inUse++
+	f.elem = p.lru.PushFront(f)
+	files := p.evictLocked()
+	p.m.Unlock()
+	closeFiles(files)
+	return file, nil
+}
+
+func (f *File) release() {
+	p := f.pool
+	p.m.Lock()
+	f.inUse--
+	f.lastUsed = time.Now()
+	var files []storage.File
+	if !f.closed {
+		// Pool may exceed the limit while all files are in use.
+		files = p.evictLocked()
+	} else if f.inUse == 0 && f.file != nil {
+		// File is closed while it is in use. Last user closes the underlying file.
+		files = []storage.File{f.file}
+		f.file = nil
+	}
+	p.m.Unlock()
+	closeFiles(files)
+}
+
+// ReadAt implements io.ReaderAt interface.
+func (f *File) ReadAt(b []byte, off int64) (int, error) {
+	file, err := f.acquire()
+	if err != nil {
+		return 0, err
+	}
+	defer f.release()
+	return file.ReadAt(b, off)
+}
+
+// WriteAt implements io.WriterAt interface.
+func (f *File) WriteAt(b []byte, off int64) (int, error) {
+	file, err := f.acquire()
+	if err != nil {
+		return 0, err
+	}
+	defer f.release()
+	return file.WriteAt(b, off)
+}
+
+// SyncRange flushes the range to disk if the underlying file supports it.
+func (f *File) SyncRange(off, length int64) error {
+	file, err := f.acquire()
+	if err != nil {
+		return err
+	}
+	defer f.release()
+	if s, ok := file.(interface{ SyncRange(off, length int64) error }); ok {
+		return s.SyncRange(off, length)
+	}
+	return nil
+}
+
+// Close the file and remove it from the pool.
+// New reads and writes fail after Close. If there are ongoing reads or writes,
+// the underlying file is closed when the last of them is finished.
+func (f *File) Close() error {
+	p := f.pool
+	p.m.Lock()
+	if f.closed {
+		p.m.Unlock()
+		return nil
+	}
+	f.closed = true
+	if f.sto.files[f.name] == f {
+		delete(f.sto.files, f.name)
+	}
+	if f.file == nil {
+		p.m.Unlock()
+		return nil
+	}
+	if f.inUse > 0 {
+		p.lru.Remove(f.elem)
+		f.elem = nil
+		p.m.Unlock()
+		return nil
+	}
+	file := p.removeLocked(f)
+	p.m.Unlock()
+	return file.Close()
+}
@@ -0,0 +1,195 @@
+package filepool
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/storage"
+	"github.com/cenkalti/rain/internal/storage/filestorage"
+)
+
+func newTestStorage(t *testing.T, p *Pool) (storage.Storage, string) {
+	dir, err := ioutil.TempDir("", "rain-filepool-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sto, err := filestorage.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.Wrap(sto), dir
+}
+
+func TestPool(t *testing.T) {
+	p := New(2, 0)
+	defer p.Close()
+	sto, dir := newTestStorage(t, p)
+	defer os.RemoveAll(dir)
+
+	var files []storage.File
+	for _, name := range []string{"a", "b", "c"} {
+		f, _, err := sto.Open(name, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		files = append(files, f)
+	}
+	if p.Len() != 2 {
+		t.Fatalf("open files: %d", p.Len())
+	}
+
+	// "a" is evicted and must be opened again.
+	_, err := files[0].WriteAt([]byte("foo"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Misses.Count() != 1 || p.Hits.Count() != 0 {
+		t.Fatalf("misses: %d, hits: %d", p.Misses.Count(), p.Hits.Count())
+	}
+	if p.Len() != 2 {
+		t.Fatalf("open files: %d", p.Len())
+	}
+
+	b := make([]byte, 3)
+	_, err = files[0].ReadAt(b, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "foo" {
+		t.Fatalf("read: %q", b)
+	}
+	if p.Misses.Count() != 1 || p.Hits.Count() != 1 {
+		t.Fatalf("misses: %d, hits: %d", p.Misses.Count(), p.Hits.Count())
+	}
+
+	// "b" is evicted by now and must not be created again after it is deleted.
+	err = os.Remove(filepath.Join(dir, "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = files[1].ReadAt(b, 0)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err = os.Stat(filepath.Join(dir, "b")); !os.IsNotExist(err) {
+		t.Fatal("file is created again")
+	}
+
+	err = files[2].Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = files[2].ReadAt(b, 0); err != os.ErrClosed {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Len() != 1 {
+		t.Fatalf("open files: %d", p.Len())
+	}
+}
+
+func TestPoolIdle(t *testing.T) {
+	p := New(0, 100*time.Millisecond)
+	defer p.Close()
+	sto, dir := newTestStorage(t, p)
+	defer os.RemoveAll(dir)
+
+	f, _, err := sto.Open("a", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if p.Len() != 1 {
+		t.Fatalf("open files: %d", p.Len())
+	}
+	time.Sleep(300 * time.Millisecond)
+	if p.Len() != 0 {
+		t.Fatalf("open files: %d", p.Len())
+	}
+	_, err = f.WriteAt([]byte("foo"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Len() != 1 {
+		t.Fatalf("open files: %d", p.Len())
+	}
+}
+
+func TestCloseWhileInUse(t *testing.T) {
+	p := New(0, 0)
+	defer p.Close()
+	sto, dir := newTestStorage(t, p)
+	defer os.RemoveAll(dir)
+
+	sf, _, err := sto.Open("a", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := sf.(*File)
+	file, err := f.acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Len() != 0 {
+		t.Fatalf("open files: %d", p.Len())
+	}
+	b := make([]byte, 3)
+	if _, err = f.ReadAt(b, 0); err != os.ErrClosed {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Underlying file must stay open until it is released.
+	_, err = file.ReadAt(b, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.release()
+	if _, err = file.ReadAt(b, 0); err == nil {
+		t.Fatal("file is not closed after release")
+	}
+}
+
+func TestRenameEvicted(t *testing.T) {
+	p := New(1, 0)
+	defer p.Close()
+	sto, dir := newTestStorage(t, p)
+	defer os.RemoveAll(dir)
+
+	a, _, err := sto.Open("a", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	_, err = a.WriteAt([]byte("foo"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sto.Rename("a", "renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Opening "b" evicts "a" from the pool.
+	b, _, err := sto.Open("b", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	buf := make([]byte, 3)
+	_, err = a.ReadAt(buf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "foo" {
+		t.Fatalf("unexpected data: %q", buf)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "a")); !os.IsNotExist(err) {
+		t.Fatalf("old file exists: %v", err)
+	}
+}
@@ -8,6 +8,9 @@ type FileSection struct {
 	Offset int64
 	Length int64
 	Name   string
+	// Padding sections are not downloaded from webseeds. Their data is always zeros.
+	// Sections of symlinks are treated the same way.
+	Padding bool
 }
 
 // ReadWriterAt combines the io.ReaderAt and io.WriterAt interfaces.
@@ -16,6 +19,11 @@ type ReadWriterAt interface {
 	io.WriterAt
 }
 
+// rangeSyncer is implemented by the files that need to be flushed to disk explicitly after writing.
+type rangeSyncer interface {
+	SyncRange(off, length int64) error
+}
+
 // Piece is contiguous sections of files. When piece hashes in torrent file is being calculated
 // all files are concatenated and splitted into pieces in length specified in the torrent file.
 type Piece []FileSection
@@ -67,5 +75,14 @@ func (p Piece) Write(b []byte) (n int, err error) {
 		}
 		b = b[m:]
 	}
+	// Flush the piece after all sections are written.
+	for _, sec := range p {
+		if s, ok := sec.File.(rangeSyncer); ok {
+			err = s.SyncRange(sec.Offset, sec.Length)
+			if err != nil {
+				return
+			}
+		}
+	}
 	return
 }
@@ -21,6 +21,9 @@ type OutgoingHandshaker struct {
 	Cipher     mse.CryptoMethod
 	Error      error
 
+	// LocalPort is the port that the connection is made from when the Source is Holepunch.
+	LocalPort int
+
 	closeC chan struct{}
 	doneC  chan struct{}
 }
@@ -46,7 +49,15 @@ func (h *OutgoingHandshaker) Run(dialTimeout, handshakeTimeout time.Duration, pe
 	defer close(h.doneC)
 	log := logger.New("peer -> " + h.Addr.String())
 
-	conn, cipher, peerExtensions, peerID, err := btconn.Dial(h.Addr, dialTimeout, handshakeTimeout, !disableOutgoingEncryption, forceOutgoingEncryption, ourExtensions, infoHash, peerID, h.closeC)
+	var conn net.Conn
+	var cipher mse.CryptoMethod
+	var peerExtensions [8]byte
+	var err error
+	if h.Source == peersource.Holepunch {
+		conn, peerExtensions, peerID, err = btconn.DialSimultaneous(h.Addr, h.LocalPort, dialTimeout, handshakeTimeout, ourExtensions, infoHash, peerID, h.closeC)
+	} else {
+		conn, cipher, peerExtensions, peerID, err = btconn.Dial(h.Addr, dialTimeout, handshakeTimeout, !disableOutgoingEncryption, forceOutgoingEncryption, ourExtensions, infoHash, peerID, h.closeC)
+	}
 	if err != nil {
 		if err == io.EOF {
 			log.Debug("peer has closed the connection: EOF")
@@ -15,10 +15,15 @@ import (
 
 // Magnet link contains the information to download torrent metadata from network.
 type Magnet struct {
+	// Zero if the magnet link only contains the public key of an updatable torrent.
 	InfoHash [20]byte
 	Name     string
 	Trackers [][]string
 	Peers    []string
+	// ed25519 public key that the latest info hash of an updatable torrent is published with (BEP 46).
+	PublicKey []byte
+	// Optional salt of the published item.
+	Salt []byte
 }
 
 // New parses the string and returns new Magnet.
@@ -34,19 +39,34 @@ func New(s string) (*Magnet, error) {
 
 	params := u.Query()
 
+	var magnet Magnet
+	if xs := params.Get("xs"); strings.HasPrefix(xs, "urn:btpk:") {
+		magnet.PublicKey, err = hex.DecodeString(xs[9:])
+		if err != nil {
+			return nil, err
+		}
+		if len(magnet.PublicKey) != 32 {
+			return nil, errors.New("public key must be 64 characters")
+		}
+		magnet.Salt, err = hex.DecodeString(params.Get("s"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	xts, ok := params["xt"]
-	if !ok {
+	switch {
+	case !ok && magnet.PublicKey != nil:
+		// Info hash is resolved from DHT.
+	case !ok:
 		return nil, errors.New("missing xt param")
-	}
-	if len(xts) == 0 {
+	case len(xts) == 0:
 		return nil, errors.New("empty xt param")
-	}
-	xt := xts[0]
-
-	var magnet Magnet
-	magnet.InfoHash, err = infoHashString(xt)
-	if err != nil {
-		return nil, err
+	default:
+		magnet.InfoHash, err = infoHashString(xts[0])
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	names := params["dn"]
@@ -83,8 +103,22 @@ func New(s string) (*Magnet, error) {
 func (m *Magnet) String() string {
 	var b strings.Builder
 	b.Grow(2048)
-	b.WriteString("magnet:?xt=urn:btih:")
-	b.WriteString(hex.EncodeToString(m.InfoHash[:]))
+	b.WriteString("magnet:?")
+	if m.InfoHash != [20]byte{} {
+		b.WriteString("xt=urn:btih:")
+		b.WriteString(hex.EncodeToString(m.InfoHash[:]))
+		if m.PublicKey != nil {
+			b.WriteString("&")
+		}
+	}
+	if m.PublicKey != nil {
+		b.WriteString("xs=urn:btpk:")
+		b.WriteString(hex.EncodeToString(m.PublicKey))
+		if len(m.Salt) > 0 {
+			b.WriteString("&s=")
+			b.WriteString(hex.EncodeToString(m.Salt))
+		}
+	}
 	if m.Name != "" {
 		b.WriteString("&dn=")
 		b.WriteString(url.QueryEscape(m.Name))
@@ -31,3 +31,25 @@ func TestParse(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestParseUpdatable(t *testing.T) {
+	u := "magnet:?xs=urn:btpk:8543d3e6115f0f98c944077a4493dcd543e49c739fd998550a1f614ab36ed63e&s=73616c74&dn=sample_torrent"
+	m, err := New(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.InfoHash != [20]byte{} {
+		t.Fatal("info hash must be empty")
+	}
+	if hex.EncodeToString(m.PublicKey) != "8543d3e6115f0f98c944077a4493dcd543e49c739fd998550a1f614ab36ed63e" {
+		t.Fatal("invalid public key")
+	}
+	if string(m.Salt) != "salt" {
+		t.Fatal("invalid salt")
+	}
+	if s := m.String(); s != u {
+		t.Log(u)
+		t.Log(s)
+		t.FailNow()
+	}
+}
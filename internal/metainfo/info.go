@@ -9,6 +9,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"unicode"
 
@@ -40,11 +41,30 @@ type Info struct {
 type File struct {
 	Length int64
 	Path   string
+	// Padding files align the next file to a piece boundary. Their data is always zeros. (BEP 47)
+	Padding bool
+	// File should be marked as executable on disk.
+	Executable bool
+	// File should be marked as hidden on disk.
+	Hidden bool
+	// Target of the symlink relative to the torrent root. Empty if the file is not a symlink.
+	// Symlinks are not created on disk.
+	Symlink string
+	// SHA-1 hash of the file content. It is optional and not used for verification.
+	SHA1 []byte
+}
+
+// Stored returns false for the files that are not saved on disk, i.e. padding files and symlinks.
+func (f *File) Stored() bool {
+	return !f.Padding && f.Symlink == ""
 }
 
 type file struct {
-	Length int64    `bencode:"length"`
-	Path   []string `bencode:"path"`
+	Length      int64    `bencode:"length"`
+	Path        []string `bencode:"path"`
+	Attr        string   `bencode:"attr,omitempty"`
+	SymlinkPath []string `bencode:"symlink path,omitempty"`
+	SHA1        []byte   `bencode:"sha1,omitempty"`
 }
 
 // NewInfo returns info from bencoded bytes in b.
@@ -56,6 +76,10 @@ func NewInfo(b []byte) (*Info, error) {
 		Private     bencode.RawMessage `bencode:"private"`
 		Length      int64              `bencode:"length"` // Single File Mode
 		Files       []file             `bencode:"files"`  // Multiple File mode
+		// Single File Mode attributes (BEP 47)
+		Attr        string   `bencode:"attr"`
+		SymlinkPath []string `bencode:"symlink path"`
+		SHA1        []byte   `bencode:"sha1"`
 	}
 	if err := bencode.DecodeBytes(b, &ib); err != nil {
 		return nil, err
@@ -77,6 +101,11 @@ func NewInfo(b []byte) (*Info, error) {
 				return nil, fmt.Errorf("invalid file name: %q", filepath.Join(file.Path...))
 			}
 		}
+		for _, path := range file.SymlinkPath {
+			if strings.TrimSpace(path) == ".." {
+				return nil, fmt.Errorf("invalid symlink path: %q", filepath.Join(file.SymlinkPath...))
+			}
+		}
 	}
 	i := Info{
 		PieceLength: ib.PieceLength,
@@ -121,17 +150,35 @@ func NewInfo(b []byte) (*Info, error) {
 			for _, p := range f.Path {
 				parts = append(parts, cleanName(p))
 			}
-			i.Files[j] = File{
-				Path:   filepath.Join(parts...),
-				Length: f.Length,
-			}
+			i.Files[j] = newFile(filepath.Join(parts...), f.Length, f.Attr, f.SymlinkPath, f.SHA1)
 		}
 	} else {
-		i.Files = []File{{Path: cleanName(i.Name), Length: i.Length}}
+		i.Files = []File{newFile(cleanName(i.Name), i.Length, ib.Attr, ib.SymlinkPath, ib.SHA1)}
 	}
 	return &i, nil
 }
 
+func newFile(path string, length int64, attr string, symlinkPath []string, sum []byte) File {
+	f := File{
+		Path:       path,
+		Length:     length,
+		Padding:    strings.ContainsRune(attr, 'p'),
+		Executable: strings.ContainsRune(attr, 'x'),
+		Hidden:     strings.ContainsRune(attr, 'h'),
+	}
+	if strings.ContainsRune(attr, 'l') {
+		parts := make([]string, len(symlinkPath))
+		for i, p := range symlinkPath {
+			parts[i] = cleanName(p)
+		}
+		f.Symlink = filepath.Join(parts...)
+	}
+	if len(sum) == sha1.Size {
+		f.SHA1 = sum
+	}
+	return f
+}
+
 func cleanName(s string) string {
 	return cleanNameN(s, 255)
 }
@@ -182,7 +229,8 @@ func parsePrivateField(s bencode.RawMessage) bool {
 }
 
 // NewInfoBytes creates a new Info dictionary by reading and hashing the files on the disk.
-func NewInfoBytes(root string, paths []string, private bool, pieceLength uint32, name string, log logger.Logger) ([]byte, error) {
+// If alignFiles is true, padding files are inserted between files so that each file starts at a piece boundary.
+func NewInfoBytes(root string, paths []string, private bool, pieceLength uint32, name string, alignFiles bool, log logger.Logger) ([]byte, error) {
 	var singleFileTorrent bool
 	switch len(paths) {
 	case 0:
@@ -245,6 +293,18 @@ func NewInfoBytes(root string, paths []string, private bool, pieceLength uint32,
 			if err != nil {
 				return err
 			}
+			if alignFiles && offset > 0 {
+				// Fill the rest of the piece with a padding file.
+				padding := remaining()
+				for i := range padding {
+					padding[i] = 0
+				}
+				files = append(files, file{Path: []string{".pad", strconv.Itoa(len(padding))}, Length: int64(len(padding)), Attr: "p"})
+				_, _ = hash.Write(buf)
+				pieces = hash.Sum(pieces)
+				hash.Reset()
+				offset = 0
+			}
 			files = append(files, file{Path: strings.Split(relpath, string(os.PathSeparator)), Length: fi.Size()})
 			for {
 				n, err := io.ReadFull(f, remaining())
@@ -1,9 +1,16 @@
 package metainfo
 
 import (
+	"bytes"
+	"crypto/sha1"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/cenkalti/rain/internal/logger"
 	"github.com/stretchr/testify/assert"
+	"github.com/zeebo/bencode"
 )
 
 func TestCalculatePieceLength(t *testing.T) {
@@ -47,3 +54,80 @@ func TestCleanName(t *testing.T) {
 		assert.Equal(t, c.cleaned, cleanNameN(c.name, c.max))
 	}
 }
+
+func TestNewInfoBytesAlignFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rain-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "root")
+	err = os.Mkdir(root, 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(root, "a"), bytes.Repeat([]byte{1}, 100), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(root, "b"), bytes.Repeat([]byte{2}, 50), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewInfoBytes("", []string{root}, false, 16<<10, "", true, logger.New("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := NewInfo(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint32(2), info.NumPieces)
+	assert.Equal(t, int64(16<<10+50), info.Length)
+	assert.Equal(t, 3, len(info.Files))
+	assert.Equal(t, filepath.Join("root", "a"), info.Files[0].Path)
+	assert.Equal(t, filepath.Join("root", ".pad", "16284"), info.Files[1].Path)
+	assert.Equal(t, int64(16284), info.Files[1].Length)
+	assert.True(t, info.Files[1].Padding)
+	assert.False(t, info.Files[1].Stored())
+	assert.Equal(t, filepath.Join("root", "b"), info.Files[2].Path)
+	assert.False(t, info.Files[2].Padding)
+
+	// Second piece contains only the second file.
+	sum := sha1.Sum(bytes.Repeat([]byte{2}, 50))
+	assert.Equal(t, sum[:], info.PieceHash(1))
+}
+
+func TestFileAttributes(t *testing.T) {
+	sum := sha1.Sum(nil)
+	ib := struct {
+		Name        string `bencode:"name"`
+		PieceLength uint32 `bencode:"piece length"`
+		Pieces      []byte `bencode:"pieces"`
+		Files       []file `bencode:"files"`
+	}{
+		Name:        "foo",
+		PieceLength: 16 << 10,
+		Pieces:      make([]byte, 20),
+		Files: []file{
+			{Path: []string{"bin"}, Length: 10, Attr: "xh", SHA1: sum[:]},
+			{Path: []string{"link"}, Attr: "l", SymlinkPath: []string{"dir", "bin"}},
+		},
+	}
+	b, err := bencode.EncodeBytes(ib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := NewInfo(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, info.Files[0].Executable)
+	assert.True(t, info.Files[0].Hidden)
+	assert.False(t, info.Files[0].Padding)
+	assert.Equal(t, sum[:], info.Files[0].SHA1)
+	assert.True(t, info.Files[0].Stored())
+
+	assert.Equal(t, filepath.Join("dir", "bin"), info.Files[1].Symlink)
+	assert.False(t, info.Files[1].Stored())
+}
@@ -18,6 +18,8 @@ type MetaInfo struct {
 	Info         Info
 	AnnounceList [][]string
 	URLList      []string
+	// Signatures of the info dict (BEP 35). Signatures are not verified while parsing.
+	Signatures []Signature
 }
 
 // New returns a torrent from bencoded stream.
@@ -28,6 +30,7 @@ func New(r io.Reader) (*MetaInfo, error) {
 		Announce     bencode.RawMessage `bencode:"announce"`
 		AnnounceList bencode.RawMessage `bencode:"announce-list"`
 		URLList      bencode.RawMessage `bencode:"url-list"`
+		Signatures   bencode.RawMessage `bencode:"signatures"`
 	}
 	err := bencode.NewDecoder(r).Decode(&t)
 	if err != nil {
@@ -83,6 +86,12 @@ func New(r io.Reader) (*MetaInfo, error) {
 			}
 		}
 	}
+	if len(t.Signatures) > 0 {
+		ret.Signatures, err = ParseSignatures(t.Signatures)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return &ret, nil
 }
 
@@ -95,7 +104,7 @@ func isWebseedSupported(s string) bool {
 }
 
 // NewBytes creates a new torrent metadata file from given information.
-func NewBytes(info []byte, trackers [][]string, webseeds []string, comment string) ([]byte, error) {
+func NewBytes(info []byte, trackers [][]string, webseeds []string, comment string, signatures []Signature) ([]byte, error) {
 	mi := struct {
 		Info         bencode.RawMessage `bencode:"info"`
 		Announce     string             `bencode:"announce,omitempty"`
@@ -104,6 +113,7 @@ func NewBytes(info []byte, trackers [][]string, webseeds []string, comment strin
 		Comment      string             `bencode:"comment,omitempty"`
 		CreationDate int64              `bencode:"creation date"`
 		CreatedBy    string             `bencode:"created by,omitempty"`
+		Signatures   bencode.RawMessage `bencode:"signatures,omitempty"`
 	}{
 		Info:         info,
 		Comment:      comment,
@@ -120,5 +130,12 @@ func NewBytes(info []byte, trackers [][]string, webseeds []string, comment strin
 	} else if len(webseeds) > 1 {
 		mi.URLList, _ = bencode.EncodeBytes(webseeds)
 	}
+	if len(signatures) > 0 {
+		var err error
+		mi.Signatures, err = EncodeSignatures(signatures)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return bencode.EncodeBytes(mi)
 }
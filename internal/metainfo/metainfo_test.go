@@ -1,9 +1,17 @@
 package metainfo
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/hex"
+	"math/big"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -27,3 +35,52 @@ func TestTorrent(t *testing.T) {
 		{"http://ipv6.torrent.ubuntu.com:6969/announce"},
 	}, tor.AnnounceList)
 }
+
+func TestSignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open("testdata/ubuntu-14.04.1-server-amd64.iso.torrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	mi, err := New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := Sign(mi.Info.Bytes, "com.example", key, cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewBytes(mi.Info.Bytes, mi.AnnounceList, nil, "", []Signature{*sig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi2, err := New(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, mi2.Signatures, 1)
+	assert.Equal(t, "com.example", mi2.Signatures[0].Identity)
+	assert.Equal(t, cert.Raw, mi2.Signatures[0].Certificate.Raw)
+	assert.NoError(t, mi2.Signatures[0].Verify(mi2.Info.Bytes))
+
+	tampered := bytes.Replace(mi2.Info.Bytes, []byte("ubuntu"), []byte("UBUNTU"), 1)
+	assert.Error(t, mi2.Signatures[0].Verify(tampered))
+}
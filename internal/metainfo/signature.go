@@ -0,0 +1,125 @@
+package metainfo
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/zeebo/bencode"
+)
+
+// Signatures of torrents are described in BEP 35.
+// Each entry in the "signatures" dict of the torrent signs the SHA-1 hash of the info dict
+// concatenated with the optional "info" dict of the entry.
+
+var errNoCertificate = errors.New("signature has no certificate")
+
+// Signature is a signature of the info dict of a torrent.
+type Signature struct {
+	// Identity of the signer. It is the key of the signature in the "signatures" dict.
+	Identity string
+	// Certificate of the signer. Nil if the torrent does not contain the certificate.
+	Certificate *x509.Certificate
+	// Bencoded dict of additional data covered by the signature. Nil if not present.
+	Info []byte
+	// Signature of the hash of the info dict and Info.
+	Signature []byte
+}
+
+type signature struct {
+	Certificate []byte             `bencode:"certificate,omitempty"`
+	Info        bencode.RawMessage `bencode:"info,omitempty"`
+	Signature   []byte             `bencode:"signature"`
+}
+
+// ParseSignatures parses the bencoded "signatures" dict of a torrent.
+// Entries with an invalid certificate are skipped.
+func ParseSignatures(b []byte) ([]Signature, error) {
+	var m map[string]signature
+	err := bencode.DecodeBytes(b, &m)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]Signature, 0, len(m))
+	for id, s := range m {
+		sig := Signature{
+			Identity:  id,
+			Info:      s.Info,
+			Signature: s.Signature,
+		}
+		if len(s.Certificate) > 0 {
+			sig.Certificate, err = x509.ParseCertificate(s.Certificate)
+			if err != nil {
+				continue
+			}
+		}
+		ret = append(ret, sig)
+	}
+	return ret, nil
+}
+
+// EncodeSignatures returns the bencoded "signatures" dict of a torrent.
+func EncodeSignatures(sigs []Signature) ([]byte, error) {
+	m := make(map[string]signature, len(sigs))
+	for _, sig := range sigs {
+		s := signature{
+			Info:      sig.Info,
+			Signature: sig.Signature,
+		}
+		if sig.Certificate != nil {
+			s.Certificate = sig.Certificate.Raw
+		}
+		m[sig.Identity] = s
+	}
+	return bencode.EncodeBytes(m)
+}
+
+// Sign the info dict with the private key of the certificate.
+// RSA and ECDSA keys are supported.
+func Sign(info []byte, identity string, key crypto.Signer, cert *x509.Certificate) (*Signature, error) {
+	sig := &Signature{
+		Identity:    identity,
+		Certificate: cert,
+	}
+	var err error
+	sig.Signature, err = key.Sign(rand.Reader, sig.digest(info), crypto.SHA1)
+	if err != nil {
+		return nil, err
+	}
+	err = sig.Verify(info)
+	if err != nil {
+		return nil, fmt.Errorf("key does not match the certificate: %s", err)
+	}
+	return sig, nil
+}
+
+// Verify checks that the info dict is signed with the key of the certificate in the signature.
+func (s *Signature) Verify(info []byte) error {
+	if s.Certificate == nil {
+		return errNoCertificate
+	}
+	digest := s.digest(info)
+	switch pub := s.Certificate.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA1, digest, s.Signature)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest, s.Signature) {
+			return errors.New("ecdsa: verification error")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported public key type: %T", pub)
+	}
+}
+
+func (s *Signature) digest(info []byte) []byte {
+	h := sha1.New()
+	_, _ = h.Write(info)
+	_, _ = h.Write(s.Info)
+	return h.Sum(nil)
+}
@@ -0,0 +1,188 @@
+// Package mover implements a worker that moves the files of a torrent to another directory.
+package mover
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/cenkalti/rain/internal/metainfo"
+)
+
+var errClosed = errors.New("mover is closed")
+
+// Mover moves files of a torrent from a directory to another.
+type Mover struct {
+	Error error
+
+	closeC chan struct{}
+	doneC  chan struct{}
+}
+
+// Progress about the move operation.
+type Progress struct {
+	MovedSize int64
+}
+
+// New returns a new Mover.
+func New() *Mover {
+	return &Mover{
+		closeC: make(chan struct{}),
+		doneC:  make(chan struct{}),
+	}
+}
+
+// Close the Mover. Files that are already moved are moved back to the source directory.
+func (m *Mover) Close() {
+	close(m.closeC)
+	<-m.doneC
+}
+
+// Run the Mover.
+// Files are renamed if possible. Files that cannot be renamed (i.e. on another device) are copied,
+// then removed from the source directory after all files are copied.
+// If an error occurs, files are moved back to the source directory.
+func (m *Mover) Run(files []metainfo.File, src, dest string, progressC chan Progress, resultC chan *Mover) {
+	defer close(m.doneC)
+
+	defer func() {
+		select {
+		case resultC <- m:
+		case <-m.closeC:
+		}
+	}()
+
+	var renamed, copied []string
+	defer func() {
+		if m.Error == nil {
+			// Move is cancelled if the Mover is closed before the source files are removed.
+			select {
+			case <-m.closeC:
+				m.Error = errClosed
+			default:
+			}
+		}
+		if m.Error != nil {
+			for _, name := range renamed {
+				_ = os.Rename(filepath.Join(dest, name), filepath.Join(src, name))
+			}
+			for _, name := range copied {
+				_ = os.Remove(filepath.Join(dest, name))
+			}
+			return
+		}
+		for _, name := range copied {
+			_ = os.Remove(filepath.Join(src, name))
+		}
+		removeEmptyDirs(src, files)
+	}()
+
+	var moved int64
+	for _, f := range files {
+		name := filepath.Clean(f.Path)
+		from, to := filepath.Join(src, name), filepath.Join(dest, name)
+		_, err := os.Stat(from)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			m.Error = err
+			return
+		}
+		if _, err = os.Stat(to); err == nil {
+			m.Error = fmt.Errorf("file already exists: %s", to)
+			return
+		}
+		err = os.MkdirAll(filepath.Dir(to), os.ModeDir|0750)
+		if err != nil {
+			m.Error = err
+			return
+		}
+		if os.Rename(from, to) == nil {
+			renamed = append(renamed, name)
+			moved += f.Length
+			if !m.sendProgress(progressC, moved) {
+				m.Error = errClosed
+				return
+			}
+			continue
+		}
+		// Rename fails when moving across devices.
+		err = m.copyFile(from, to, &moved, progressC)
+		if err != nil {
+			_ = os.Remove(to)
+			m.Error = err
+			return
+		}
+		copied = append(copied, name)
+	}
+}
+
+func (m *Mover) copyFile(from, to string, moved *int64, progressC chan Progress) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode())
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 1<<20)
+	for {
+		n, rerr := src.Read(buf)
+		if n > 0 {
+			_, err = dst.Write(buf[:n])
+			if err != nil {
+				_ = dst.Close()
+				return err
+			}
+			*moved += int64(n)
+			if !m.sendProgress(progressC, *moved) {
+				_ = dst.Close()
+				return errClosed
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			_ = dst.Close()
+			return rerr
+		}
+	}
+	err = dst.Close()
+	if err != nil {
+		return err
+	}
+	// Keep modification time so the data is not considered as modified on next start.
+	return os.Chtimes(to, fi.ModTime(), fi.ModTime())
+}
+
+func (m *Mover) sendProgress(progressC chan Progress, size int64) bool {
+	select {
+	case progressC <- Progress{MovedSize: size}:
+		return true
+	case <-m.closeC:
+		return false
+	}
+}
+
+// removeEmptyDirs removes the directories that are left empty after moving files. Root is not removed.
+func removeEmptyDirs(root string, files []metainfo.File) {
+	for _, f := range files {
+		dir := filepath.Dir(filepath.Join(root, filepath.Clean(f.Path)))
+		for dir != root && len(dir) > len(root) {
+			if os.Remove(dir) != nil {
+				break
+			}
+			dir = filepath.Dir(dir)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package mover
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cenkalti/rain/internal/metainfo"
+)
+
+func setup(t *testing.T) (src, dest string, files []metainfo.File, c func()) {
+	dir, err := ioutil.TempDir("", "rain-mover-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, dest = filepath.Join(dir, "src"), filepath.Join(dir, "dest")
+	files = []metainfo.File{
+		{Path: filepath.Join("a", "file1"), Length: 5},
+		{Path: filepath.Join("a", "b", "file2"), Length: 6},
+	}
+	for _, f := range files {
+		err = os.MkdirAll(filepath.Dir(filepath.Join(src, f.Path)), 0750)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(src, f.Path), make([]byte, f.Length), 0640)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return src, dest, files, func() { os.RemoveAll(dir) }
+}
+
+func exists(t *testing.T, dir string, files []metainfo.File) bool {
+	n := 0
+	for _, f := range files {
+		if _, err := os.Stat(filepath.Join(dir, f.Path)); err == nil {
+			n++
+		}
+	}
+	if n != 0 && n != len(files) {
+		t.Fatalf("%d of %d files are in %s", n, len(files), dir)
+	}
+	return n == len(files)
+}
+
+func TestMove(t *testing.T) {
+	src, dest, files, c := setup(t)
+	defer c()
+	m := New()
+	progressC := make(chan Progress)
+	resultC := make(chan *Mover)
+	go m.Run(files, src, dest, progressC, resultC)
+	var moved int64
+	for res := (*Mover)(nil); res == nil; {
+		select {
+		case p := <-progressC:
+			moved = p.MovedSize
+		case res = <-resultC:
+		}
+	}
+	if m.Error != nil {
+		t.Fatal(m.Error)
+	}
+	if moved != 11 {
+		t.Fatalf("moved %d bytes", moved)
+	}
+	if !exists(t, dest, files) || exists(t, src, files) {
+		t.Fatal("files are not moved")
+	}
+	if _, err := os.Stat(filepath.Join(src, "a")); !os.IsNotExist(err) {
+		t.Fatal("empty dirs are not removed")
+	}
+}
+
+func TestCloseRevertsMove(t *testing.T) {
+	src, dest, files, c := setup(t)
+	defer c()
+	m := New()
+	// Progress is not received, so the Mover is blocked after moving the first file.
+	go m.Run(files, src, dest, make(chan Progress), make(chan *Mover))
+	m.Close()
+	if m.Error != errClosed {
+		t.Fatalf("unexpected error: %v", m.Error)
+	}
+	if !exists(t, src, files) || exists(t, dest, files) {
+		t.Fatal("files are not moved back")
+	}
+}
+
+func TestCloseBeforeResult(t *testing.T) {
+	src, dest, _, c := setup(t)
+	defer c()
+	m := New()
+	// Mover is closed after all files are handled but before the result is sent.
+	// Missing files are skipped without sending progress, so the loop does not see the close.
+	close(m.closeC)
+	missing := []metainfo.File{{Path: "missing", Length: 1}}
+	m.Run(missing, src, dest, make(chan Progress), make(chan *Mover))
+	if m.Error != errClosed {
+		t.Fatalf("unexpected error: %v", m.Error)
+	}
+}
@@ -33,6 +33,9 @@ type Peer struct {
 	Bitfield            *bitfield.Bitfield
 	ReceivedAllowedFast pieceset.PieceSet
 	SentAllowedFast     pieceset.PieceSet
+	ReceivedSuggested   pieceset.PieceSet
+	// Pieces that are suggested to the peer. Created on first suggestion.
+	SentSuggested *bitfield.Bitfield
 
 	ID                [20]byte
 	ExtensionsEnabled bool
@@ -52,6 +55,11 @@ type Peer struct {
 
 	Downloading bool
 
+	// Pieces are revealed to the peer one by one because the peer is connected in super-seeding mode.
+	SuperSeeding bool
+	// Pieces that are revealed to the peer in super-seeding mode.
+	SuperSeedRevealed *bitfield.Bitfield
+
 	downloadSpeed metrics.Meter
 	uploadSpeed   metrics.Meter
 
@@ -62,6 +70,9 @@ type Peer struct {
 
 	PEX *pex
 
+	// Tracker URLs that are sent to the peer with tracker exchange extension.
+	SentTrackers map[string]struct{}
+
 	snubTimeout time.Duration
 	snubTimer   *time.Timer
 
@@ -103,6 +114,7 @@ func New(conn net.Conn, source peersource.Source, id [20]byte, extensions [8]byt
 		EncryptionCipher:  cipher,
 		snubTimeout:       snubTimeout,
 		snubTimer:         t,
+		SentTrackers:      make(map[string]struct{}),
 		closeC:            make(chan struct{}),
 		doneC:             make(chan struct{}),
 		downloadSpeed:     metrics.NewMeter(),
@@ -244,6 +256,36 @@ func (p *Peer) MetadataSize() uint32 {
 	return uint32(p.ExtensionHandshake.MetadataSize)
 }
 
+// HolepunchEnabled returns true if the Peer supports the holepunch extension.
+// Zero id means the extension is disabled by the peer.
+func (p *Peer) HolepunchEnabled() bool {
+	if p.ExtensionHandshake == nil {
+		return false
+	}
+	return p.ExtensionHandshake.M[peerprotocol.ExtensionKeyHolepunch] != 0
+}
+
+// DontHaveEnabled returns true if the Peer supports the donthave extension.
+func (p *Peer) DontHaveEnabled() bool {
+	if p.ExtensionHandshake == nil {
+		return false
+	}
+	return p.ExtensionHandshake.M[peerprotocol.ExtensionKeyDontHave] != 0
+}
+
+// TEXEnabled returns true if the Peer supports the tracker exchange extension.
+func (p *Peer) TEXEnabled() bool {
+	if p.ExtensionHandshake == nil {
+		return false
+	}
+	return p.ExtensionHandshake.M[peerprotocol.ExtensionKeyTEX] != 0
+}
+
+// UploadOnly returns true if the Peer has told that it is not going to download any pieces.
+func (p *Peer) UploadOnly() bool {
+	return p.ExtensionHandshake != nil && p.ExtensionHandshake.UploadOnly != 0
+}
+
 // RequestMetadataPiece is used to send a message that is requesting a metadata piece at index.
 func (p *Peer) RequestMetadataPiece(index uint32) {
 	p.SendMessage(peerprotocol.ExtensionMessage{
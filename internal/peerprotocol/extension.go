@@ -2,7 +2,9 @@ package peerprotocol
 
 import (
 	"bytes"
+	"encoding"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -17,6 +19,12 @@ const (
 	ExtensionIDMetadata
 	// ExtensionIDPEX is ID for PEX extension messages.
 	ExtensionIDPEX
+	// ExtensionIDHolepunch is ID for holepunch extension messages.
+	ExtensionIDHolepunch
+	// ExtensionIDDontHave is ID for donthave extension messages.
+	ExtensionIDDontHave
+	// ExtensionIDTEX is ID for tracker exchange extension messages.
+	ExtensionIDTEX
 )
 
 const (
@@ -24,6 +32,12 @@ const (
 	ExtensionKeyMetadata = "ut_metadata"
 	// ExtensionKeyPEX is the key for the PEX extension.
 	ExtensionKeyPEX = "ut_pex"
+	// ExtensionKeyHolepunch is the key for the holepunch extension.
+	ExtensionKeyHolepunch = "ut_holepunch"
+	// ExtensionKeyDontHave is the key for the donthave extension.
+	ExtensionKeyDontHave = "lt_donthave"
+	// ExtensionKeyTEX is the key for the tracker exchange extension.
+	ExtensionKeyTEX = "lt_tex"
 )
 
 const (
@@ -35,6 +49,26 @@ const (
 	ExtensionMetadataMessageTypeReject
 )
 
+const (
+	// ExtensionHolepunchMessageTypeRendezvous is the id of holepunch message when asking a relay peer to connect us with a target peer.
+	ExtensionHolepunchMessageTypeRendezvous = iota
+	// ExtensionHolepunchMessageTypeConnect is the id of holepunch message when the relay tells both peers to connect each other.
+	ExtensionHolepunchMessageTypeConnect
+	// ExtensionHolepunchMessageTypeError is the id of holepunch message when the relay cannot do the rendezvous.
+	ExtensionHolepunchMessageTypeError
+)
+
+const (
+	// ExtensionHolepunchErrorNoSuchPeer means the target peer is not known by the relay.
+	ExtensionHolepunchErrorNoSuchPeer = iota + 1
+	// ExtensionHolepunchErrorNotConnected means the relay is not connected to the target peer.
+	ExtensionHolepunchErrorNotConnected
+	// ExtensionHolepunchErrorNoSupport means the target peer does not support the holepunch extension.
+	ExtensionHolepunchErrorNoSupport
+	// ExtensionHolepunchErrorNoSelf means the target peer is the relay itself.
+	ExtensionHolepunchErrorNoSelf
+)
+
 // ExtensionMessage is extension to BitTorrent protocol.
 type ExtensionMessage struct {
 	ExtendedMessageID uint8
@@ -56,6 +90,16 @@ func (m ExtensionMessage) WriteTo(w io.Writer) (n int64, err error) {
 	if err != nil {
 		return
 	}
+	if bm, ok := m.Payload.(encoding.BinaryMarshaler); ok {
+		var b []byte
+		b, err = bm.MarshalBinary()
+		if err != nil {
+			return
+		}
+		nn, err = w.Write(b)
+		n += int64(nn)
+		return
+	}
 	wc := newWriterCounter(w)
 	err = bencode.NewEncoder(wc).Encode(m.Payload)
 	n += wc.Count()
@@ -100,6 +144,18 @@ func (m *ExtensionMessage) UnmarshalBinary(data []byte) error {
 		var extMsg ExtensionPEXMessage
 		err = dec.Decode(&extMsg)
 		m.Payload = extMsg
+	case ExtensionIDTEX:
+		var extMsg ExtensionTEXMessage
+		err = dec.Decode(&extMsg)
+		m.Payload = extMsg
+	case ExtensionIDHolepunch:
+		var extMsg ExtensionHolepunchMessage
+		err = extMsg.UnmarshalBinary(payload)
+		m.Payload = extMsg
+	case ExtensionIDDontHave:
+		var extMsg ExtensionDontHaveMessage
+		err = extMsg.UnmarshalBinary(payload)
+		m.Payload = extMsg
 	default:
 		return fmt.Errorf("peer sent invalid extension message id: %d", m.ExtendedMessageID)
 	}
@@ -113,20 +169,28 @@ type ExtensionHandshakeMessage struct {
 	YourIP       string           `bencode:"yourip,omitempty"`
 	MetadataSize int              `bencode:"metadata_size,omitempty"`
 	RequestQueue int              `bencode:"reqq"`
+	UploadOnly   int              `bencode:"upload_only,omitempty"`
 }
 
 // NewExtensionHandshake returns a new ExtensionHandshakeMessage by filling the struct with given values.
-func NewExtensionHandshake(metadataSize uint32, version string, yourip net.IP, requestQueueLength int) ExtensionHandshakeMessage {
-	return ExtensionHandshakeMessage{
+func NewExtensionHandshake(metadataSize uint32, version string, yourip net.IP, requestQueueLength int, uploadOnly bool) ExtensionHandshakeMessage {
+	m := ExtensionHandshakeMessage{
 		M: map[string]uint8{
-			ExtensionKeyMetadata: ExtensionIDMetadata,
-			ExtensionKeyPEX:      ExtensionIDPEX,
+			ExtensionKeyMetadata:  ExtensionIDMetadata,
+			ExtensionKeyPEX:       ExtensionIDPEX,
+			ExtensionKeyHolepunch: ExtensionIDHolepunch,
+			ExtensionKeyDontHave:  ExtensionIDDontHave,
+			ExtensionKeyTEX:       ExtensionIDTEX,
 		},
 		V:            version,
 		YourIP:       string(truncateIP(yourip)),
 		MetadataSize: int(metadataSize),
 		RequestQueue: requestQueueLength,
 	}
+	if uploadOnly {
+		m.UploadOnly = 1
+	}
+	return m
 }
 
 // ExtensionMetadataMessage is the message for the Metadata extension.
@@ -143,6 +207,92 @@ type ExtensionPEXMessage struct {
 	Dropped string `bencode:"dropped"`
 }
 
+// ExtensionTEXMessage is the message for the tracker exchange extension.
+type ExtensionTEXMessage struct {
+	Added []string `bencode:"added"`
+}
+
+// ExtensionHolepunchMessage is the message for the holepunch extension.
+// Unlike other extension messages, it is encoded in binary format instead of bencode.
+type ExtensionHolepunchMessage struct {
+	Type    uint8
+	Addr    *net.TCPAddr
+	ErrCode uint32
+}
+
+// MarshalBinary encodes the message as: msg_type, addr_type, addr, port, err_code.
+func (m ExtensionHolepunchMessage) MarshalBinary() ([]byte, error) {
+	if m.Addr == nil {
+		return nil, errors.New("holepunch message has no address")
+	}
+	var addrType byte
+	ip := m.Addr.IP.To4()
+	if ip == nil {
+		addrType = 1
+		ip = m.Addr.IP.To16()
+		if ip == nil {
+			return nil, fmt.Errorf("invalid holepunch address: %s", m.Addr)
+		}
+	}
+	b := make([]byte, 2+len(ip)+2+4)
+	b[0] = m.Type
+	b[1] = addrType
+	copy(b[2:], ip)
+	binary.BigEndian.PutUint16(b[2+len(ip):], uint16(m.Addr.Port))
+	binary.BigEndian.PutUint32(b[2+len(ip)+2:], m.ErrCode)
+	return b, nil
+}
+
+// UnmarshalBinary decodes the message.
+func (m *ExtensionHolepunchMessage) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 {
+		return io.ErrUnexpectedEOF
+	}
+	m.Type = data[0]
+	var ipLen int
+	switch data[1] {
+	case 0:
+		ipLen = net.IPv4len
+	case 1:
+		ipLen = net.IPv6len
+	default:
+		return fmt.Errorf("invalid holepunch address type: %d", data[1])
+	}
+	data = data[2:]
+	if len(data) < ipLen+2+4 {
+		return io.ErrUnexpectedEOF
+	}
+	m.Addr = &net.TCPAddr{
+		IP:   append(net.IP(nil), data[:ipLen]...),
+		Port: int(binary.BigEndian.Uint16(data[ipLen:])),
+	}
+	m.ErrCode = binary.BigEndian.Uint32(data[ipLen+2:])
+	return nil
+}
+
+// ExtensionDontHaveMessage is the message for the donthave extension.
+// It is sent to tell that we no longer have the piece at index.
+// The payload is the piece index encoded as 4 bytes big endian integer.
+type ExtensionDontHaveMessage struct {
+	Index uint32
+}
+
+// MarshalBinary encodes the message.
+func (m ExtensionDontHaveMessage) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, m.Index)
+	return b, nil
+}
+
+// UnmarshalBinary decodes the message.
+func (m *ExtensionDontHaveMessage) UnmarshalBinary(data []byte) error {
+	if len(data) < 4 {
+		return io.ErrUnexpectedEOF
+	}
+	m.Index = binary.BigEndian.Uint32(data)
+	return nil
+}
+
 func truncateIP(ip net.IP) net.IP {
 	ip4 := ip.To4()
 	if ip4 != nil {
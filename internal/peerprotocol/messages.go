@@ -97,6 +97,9 @@ func (m emptyMessage) Read(b []byte) (int, error) {
 // AllowedFastMessage is sent to tell a peer that it can download pieces regardless of choking status.
 type AllowedFastMessage struct{ HaveMessage }
 
+// SuggestPieceMessage is sent to tell a peer that downloading the piece is preferred.
+type SuggestPieceMessage struct{ HaveMessage }
+
 // ChokeMessage is sent to peer that it should not request pieces.
 type ChokeMessage struct{ emptyMessage }
 
@@ -144,3 +147,9 @@ func (m RejectMessage) ID() MessageID { return Reject }
 
 // ID returns the peer protocol message type.
 func (m CancelMessage) ID() MessageID { return Cancel }
+
+// ID returns the peer protocol message type.
+func (m AllowedFastMessage) ID() MessageID { return AllowedFast }
+
+// ID returns the peer protocol message type.
+func (m SuggestPieceMessage) ID() MessageID { return Suggest }
@@ -14,6 +14,8 @@ const (
 	Manual
 	// Incoming indicates that the peer found us. We did not found the peer.
 	Incoming
+	// Holepunch indicates that the peer is connected after a holepunch rendezvous via another peer.
+	Holepunch
 )
 
 func (s Source) String() string {
@@ -28,6 +30,8 @@ func (s Source) String() string {
 		return "manual"
 	case Incoming:
 		return "incoming"
+	case Holepunch:
+		return "holepunch"
 	default:
 		panic("unhandled source")
 	}
@@ -69,10 +69,11 @@ func NewPieces(info *metainfo.Info, files []allocator.File) []Piece {
 			n := uint32(minInt64(int64(left), fileLeft())) // number of bytes to write
 
 			file := filesection.FileSection{
-				File:   files[fileIndex].Storage,
-				Offset: fileOffset,
-				Length: int64(n),
-				Name:   files[fileIndex].Name,
+				File:    files[fileIndex].Storage,
+				Offset:  fileOffset,
+				Length:  int64(n),
+				Name:    info.Files[fileIndex].Path,
+				Padding: !info.Files[fileIndex].Stored(),
 			}
 			sections = append(sections, file)
 
@@ -2,6 +2,8 @@ package piececache
 
 import (
 	"container/heap"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -99,6 +101,25 @@ func (c *Cache) Utilization() int {
 	return int((100 * c.NumCached.Rate1()) / total)
 }
 
+// Keys returns the keys of the items in the cache that begin with prefix.
+// Recently accessed items come first.
+func (c *Cache) Keys(prefix string) []string {
+	c.m.RLock()
+	items := make([]*item, 0, len(c.accessList))
+	for _, i := range c.accessList {
+		if strings.HasPrefix(i.key, prefix) {
+			items = append(items, i)
+		}
+	}
+	sort.Slice(items, func(a, b int) bool { return items[a].lastAccessed.After(items[b].lastAccessed) })
+	keys := make([]string, len(items))
+	for n, i := range items {
+		keys[n] = i.key
+	}
+	c.m.RUnlock()
+	return keys
+}
+
 // Get item with the key from cache. If item is not in cache, load by calling `loader` func and put into the cache.
 func (c *Cache) Get(key string, loader Loader) ([]byte, error) {
 	i := c.getItem(key)
@@ -256,3 +256,28 @@ func TestClear(t *testing.T) {
 
 	time.Sleep(ttl + 10*time.Millisecond)
 }
+
+func TestKeys(t *testing.T) {
+	c := New(10, time.Minute, 1)
+
+	loader := func() ([]byte, error) {
+		return []byte("x"), nil
+	}
+	for _, key := range []string{"a1", "b1", "a2"} {
+		_, err := c.Get(key, loader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Access a1 again to make it the most recent.
+	_, err := c.Get("a1", loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := c.Keys("a")
+	if len(keys) != 2 || keys[0] != "a1" || keys[1] != "a2" {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+}
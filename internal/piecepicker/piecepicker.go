@@ -29,6 +29,9 @@ Do not forget to re-check these when making changes.
 
 */
 
+// Maximum number of suggested pieces that are remembered for a peer.
+const maxSuggested = 32
+
 // PiecePicker runs an algorithm to determine which piece to download next, from which peer or webseed source.
 // PiecePicker keeps track availability of pieces among peers.
 type PiecePicker struct {
@@ -152,11 +155,36 @@ func (p *PiecePicker) HandleHave(pe *peer.Peer, i uint32) {
 	p.addHavingPeer(i, pe)
 }
 
+// HandleDontHave must be called when the peer tells that it does not have the piece anymore.
+func (p *PiecePicker) HandleDontHave(pe *peer.Peer, i uint32) {
+	pe.Bitfield.Clear(i)
+	p.removeHavingPeer(int(i), pe)
+}
+
 // HandleAllowedFast must be called to set the allowed-fast status of the piece at peer.
 func (p *PiecePicker) HandleAllowedFast(pe *peer.Peer, i uint32) {
 	pe.ReceivedAllowedFast.Add(p.pieces[i].Piece)
 }
 
+// HandleSuggest must be called when the peer suggests downloading the piece.
+// Suggested pieces are preferred over other pieces with same availability.
+// Completed pieces are forgotten and the oldest suggestion is dropped when the limit is reached.
+func (p *PiecePicker) HandleSuggest(pe *peer.Peer, i uint32) {
+	if p.pieces[i].Done || pe.ReceivedSuggested.Has(p.pieces[i].Piece) {
+		return
+	}
+	suggested := pe.ReceivedSuggested.Pieces[:0]
+	for _, pi := range pe.ReceivedSuggested.Pieces {
+		if !p.pieces[pi.Index].Done {
+			suggested = append(suggested, pi)
+		}
+	}
+	if len(suggested) >= maxSuggested {
+		suggested = append(suggested[:0], suggested[len(suggested)-maxSuggested+1:]...)
+	}
+	pe.ReceivedSuggested.Pieces = append(suggested, p.pieces[i].Piece)
+}
+
 // HandleSnubbed must be called to set the peer as snubbed when it is slow or stalled.
 func (p *PiecePicker) HandleSnubbed(pe *peer.Peer, i uint32) {
 	if p.pieces[i].Choked.Has(pe) {
@@ -276,7 +304,12 @@ func (p *PiecePicker) pickAllowedFast(pe *peer.Peer) *myPiece {
 func (p *PiecePicker) pickRarest(pe *peer.Peer) *myPiece {
 	// Sort by rarity
 	sort.Slice(p.piecesByAvailability, func(i, j int) bool {
-		return len(p.piecesByAvailability[i].Having.Peers) < len(p.piecesByAvailability[j].Having.Peers)
+		a, b := p.piecesByAvailability[i], p.piecesByAvailability[j]
+		if len(a.Having.Peers) != len(b.Having.Peers) {
+			return len(a.Having.Peers) < len(b.Having.Peers)
+		}
+		// Pieces suggested by the peer are likely to be in its cache.
+		return pe.ReceivedSuggested.Has(a.Piece) && !pe.ReceivedSuggested.Has(b.Piece)
 	})
 	var picked *myPiece
 	var hasUnrequested bool
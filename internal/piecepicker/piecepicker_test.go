@@ -69,6 +69,69 @@ func TestPiecePicker(t *testing.T) {
 	assert.True(t, pp.endgame)
 }
 
+func TestPiecePickerDontHave(t *testing.T) {
+	pieces := make([]piece.Piece, numPieces)
+	for i := range pieces {
+		pieces[i] = newPiece(i)
+	}
+	pe := newPeer(0)
+	pp := New(pieces, 2, nil)
+	pp.HandleHave(pe, 2)
+	assert.Equal(t, uint32(1), pp.Available())
+
+	pp.HandleDontHave(pe, 2)
+	assert.Equal(t, uint32(0), pp.Available())
+	assert.False(t, pe.Bitfield.Test(2))
+	assert.Nil(t, pp.pickFor(pe))
+}
+
+func TestPiecePickerSuggest(t *testing.T) {
+	pieces := make([]piece.Piece, numPieces)
+	for i := range pieces {
+		pieces[i] = newPiece(i)
+	}
+	pe := newPeer(0)
+	pp := New(pieces, 2, nil)
+	for i := range pieces {
+		pp.HandleHave(pe, uint32(i))
+	}
+	pp.HandleHave(newPeer(1), 3)
+	pp.HandleSuggest(pe, 3)
+	pp.HandleSuggest(pe, 5)
+
+	// Suggested piece is preferred among the rarest pieces.
+	assert.Equal(t, &pieces[5], pp.pickFor(pe))
+	// Suggestion does not override rarity.
+	assert.NotEqual(t, &pieces[3], pp.pickFor(pe))
+}
+
+func TestPiecePickerSuggestLimit(t *testing.T) {
+	pieces := make([]piece.Piece, maxSuggested+2)
+	for i := range pieces {
+		pieces[i] = newPiece(i)
+	}
+	pe := newPeer(0)
+	pp := New(pieces, 2, nil)
+	for i := 0; i < maxSuggested; i++ {
+		pp.HandleSuggest(pe, uint32(i))
+	}
+	assert.Equal(t, maxSuggested, pe.ReceivedSuggested.Len())
+
+	// Oldest suggestion is dropped when the limit is reached.
+	pp.HandleSuggest(pe, maxSuggested)
+	assert.Equal(t, maxSuggested, pe.ReceivedSuggested.Len())
+	assert.False(t, pe.ReceivedSuggested.Has(&pieces[0]))
+	assert.True(t, pe.ReceivedSuggested.Has(&pieces[maxSuggested]))
+
+	// Completed pieces are forgotten.
+	pp.pieces[1].Done = true
+	pp.pieces[2].Done = true
+	pp.HandleSuggest(pe, maxSuggested+1)
+	assert.Equal(t, maxSuggested-1, pe.ReceivedSuggested.Len())
+	assert.False(t, pe.ReceivedSuggested.Has(&pieces[1]))
+	assert.True(t, pe.ReceivedSuggested.Has(&pieces[3]))
+}
+
 func newPiece(i int) piece.Piece {
 	return piece.Piece{Index: uint32(i)}
 }
@@ -28,6 +28,15 @@ var Keys = struct {
 	BytesWasted     []byte
 	SeededFor       []byte
 	Started         []byte
+	FileStats       []byte
+	LastScrubAt     []byte
+	FilePaths       []byte
+	Archive         []byte
+	SuperSeeding    []byte
+	PublicKey       []byte
+	Salt            []byte
+	Seq             []byte
+	Signatures      []byte
 }{
 	InfoHash:        []byte("info_hash"),
 	Port:            []byte("port"),
@@ -44,6 +53,15 @@ var Keys = struct {
 	BytesWasted:     []byte("bytes_wasted"),
 	SeededFor:       []byte("seeded_for"),
 	Started:         []byte("started"),
+	FileStats:       []byte("file_stats"),
+	LastScrubAt:     []byte("last_scrub_at"),
+	FilePaths:       []byte("file_paths"),
+	Archive:         []byte("archive"),
+	SuperSeeding:    []byte("super_seeding"),
+	PublicKey:       []byte("public_key"),
+	Salt:            []byte("salt"),
+	Seq:             []byte("seq"),
+	Signatures:      []byte("signatures"),
 }
 
 // Resumer contains methods for saving/loading resume information of a torrent to a BoltDB database.
@@ -82,6 +100,14 @@ func (r *Resumer) Write(torrentID string, spec *Spec) error {
 	if err != nil {
 		return err
 	}
+	fileStats, err := json.Marshal(spec.FileStats)
+	if err != nil {
+		return err
+	}
+	filePaths, err := json.Marshal(spec.FilePaths)
+	if err != nil {
+		return err
+	}
 	return r.db.Update(func(tx *bbolt.Tx) error {
 		b, err := tx.Bucket(r.bucket).CreateBucketIfNotExists([]byte(torrentID))
 		if err != nil {
@@ -101,6 +127,26 @@ func (r *Resumer) Write(torrentID string, spec *Spec) error {
 		_ = b.Put(Keys.BytesWasted, []byte(strconv.FormatInt(spec.BytesWasted, 10)))
 		_ = b.Put(Keys.SeededFor, []byte(spec.SeededFor.String()))
 		_ = b.Put(Keys.Started, []byte(strconv.FormatBool(spec.Started)))
+		_ = b.Put(Keys.SuperSeeding, []byte(strconv.FormatBool(spec.SuperSeeding)))
+		_ = b.Put(Keys.FileStats, fileStats)
+		_ = b.Put(Keys.FilePaths, filePaths)
+		if spec.Dest != "" {
+			_ = b.Put(Keys.Dest, []byte(spec.Dest))
+		}
+		if spec.Archive != "" {
+			_ = b.Put(Keys.Archive, []byte(spec.Archive))
+		}
+		if !spec.LastScrubAt.IsZero() {
+			_ = b.Put(Keys.LastScrubAt, []byte(spec.LastScrubAt.Format(time.RFC3339)))
+		}
+		if spec.PublicKey != nil {
+			_ = b.Put(Keys.PublicKey, spec.PublicKey)
+			_ = b.Put(Keys.Salt, spec.Salt)
+			_ = b.Put(Keys.Seq, []byte(strconv.FormatInt(spec.Seq, 10)))
+		}
+		if spec.Signatures != nil {
+			_ = b.Put(Keys.Signatures, spec.Signatures)
+		}
 		return nil
 	})
 }
@@ -127,6 +173,58 @@ func (r *Resumer) WriteBitfield(torrentID string, value []byte) error {
 	})
 }
 
+// WriteFileStats writes the state of files on disk at the time the bitfield is saved.
+func (r *Resumer) WriteFileStats(torrentID string, stats []FileStat) error {
+	value, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		return b.Put(Keys.FileStats, value)
+	})
+}
+
+// WriteFilePaths writes the paths of files on disk that are renamed by the user.
+func (r *Resumer) WriteFilePaths(torrentID string, paths []string) error {
+	value, err := json.Marshal(paths)
+	if err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		return b.Put(Keys.FilePaths, value)
+	})
+}
+
+// WriteLastScrubAt writes the time of the last completed scrub pass of a torrent.
+func (r *Resumer) WriteLastScrubAt(torrentID string, value time.Time) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		return b.Put(Keys.LastScrubAt, []byte(value.Format(time.RFC3339)))
+	})
+}
+
+// WriteDest writes the directory that the files of a torrent are saved in.
+func (r *Resumer) WriteDest(torrentID string, value string) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		return b.Put(Keys.Dest, []byte(value))
+	})
+}
+
 // WriteStarted writes the start status of a torrent.
 func (r *Resumer) WriteStarted(torrentID string, value bool) error {
 	return r.db.Update(func(tx *bbolt.Tx) error {
@@ -138,6 +236,17 @@ func (r *Resumer) WriteStarted(torrentID string, value bool) error {
 	})
 }
 
+// WriteSuperSeeding writes the super-seeding mode of a torrent.
+func (r *Resumer) WriteSuperSeeding(torrentID string, value bool) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(r.bucket).Bucket([]byte(torrentID))
+		if b == nil {
+			return nil
+		}
+		return b.Put(Keys.SuperSeeding, []byte(strconv.FormatBool(value)))
+	})
+}
+
 func (r *Resumer) Read(torrentID string) (spec *Spec, err error) {
 	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
 	defer func() {
@@ -215,6 +324,16 @@ func (r *Resumer) Read(torrentID string) (spec *Spec, err error) {
 			}
 		}
 
+		value = b.Get(Keys.Dest)
+		if value != nil {
+			spec.Dest = string(value)
+		}
+
+		value = b.Get(Keys.Archive)
+		if value != nil {
+			spec.Archive = string(value)
+		}
+
 		value = b.Get(Keys.Info)
 		if value != nil {
 			spec.Info = make([]byte, len(value))
@@ -275,6 +394,64 @@ func (r *Resumer) Read(torrentID string) (spec *Spec, err error) {
 			}
 		}
 
+		value = b.Get(Keys.SuperSeeding)
+		if value != nil {
+			spec.SuperSeeding, err = strconv.ParseBool(string(value))
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.PublicKey)
+		if value != nil {
+			spec.PublicKey = make([]byte, len(value))
+			copy(spec.PublicKey, value)
+		}
+
+		value = b.Get(Keys.Salt)
+		if value != nil {
+			spec.Salt = make([]byte, len(value))
+			copy(spec.Salt, value)
+		}
+
+		value = b.Get(Keys.Seq)
+		if value != nil {
+			spec.Seq, err = strconv.ParseInt(string(value), 10, 64)
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.Signatures)
+		if value != nil {
+			spec.Signatures = make([]byte, len(value))
+			copy(spec.Signatures, value)
+		}
+
+		value = b.Get(Keys.LastScrubAt)
+		if value != nil {
+			spec.LastScrubAt, err = time.Parse(time.RFC3339, string(value))
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.FileStats)
+		if value != nil {
+			err = json.Unmarshal(value, &spec.FileStats)
+			if err != nil {
+				return err
+			}
+		}
+
+		value = b.Get(Keys.FilePaths)
+		if value != nil {
+			err = json.Unmarshal(value, &spec.FilePaths)
+			if err != nil {
+				return err
+			}
+		}
+
 		return nil
 	})
 	return
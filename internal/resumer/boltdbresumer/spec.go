@@ -23,6 +23,32 @@ type Spec struct {
 	SeededFor         time.Duration
 	Started           bool
 	StopAfterDownload bool
+	SuperSeeding      bool
+	FileStats         []FileStat
+	LastScrubAt       time.Time
+	// Paths of files relative to Dest. Paths in Info are used if empty.
+	FilePaths []string
+	// Directory that files are saved in. Default directory in Config is used if empty.
+	// It is not included in JSON because the path is specific to the host.
+	Dest string
+	// Path of the tar or zip file that files are read from. Torrent is seeded from the archive if not empty.
+	// It is not included in JSON for the same reason with Dest.
+	Archive string
+	// ed25519 public key that new versions of the torrent are published with (BEP 46). Nil if torrent is not updatable.
+	PublicKey []byte
+	// Salt of the published item.
+	Salt []byte
+	// Sequence number of the published item that the info hash is taken from.
+	Seq int64
+	// Bencoded "signatures" dict of the torrent file (BEP 35). Nil if the torrent is not signed.
+	Signatures []byte
+}
+
+// FileStat is the state of a file on disk when the bitfield was saved.
+// It is used for detecting files that are modified while the torrent is stopped.
+type FileStat struct {
+	Size    int64
+	ModTime time.Time
 }
 
 type jsonSpec struct {
@@ -37,12 +63,20 @@ type jsonSpec struct {
 	BytesWasted       int64
 	Started           bool
 	StopAfterDownload bool
+	SuperSeeding      bool
+	FileStats         []FileStat
+	LastScrubAt       time.Time
+	FilePaths         []string
+	Seq               int64
 
 	// JSON safe types
-	InfoHash  string
-	Info      string
-	Bitfield  string
-	SeededFor int64
+	InfoHash   string
+	Info       string
+	Bitfield   string
+	SeededFor  int64
+	PublicKey  string
+	Salt       string
+	Signatures string
 }
 
 // MarshalJSON converts the Spec to a JSON string.
@@ -59,11 +93,19 @@ func (s Spec) MarshalJSON() ([]byte, error) {
 		BytesWasted:       s.BytesWasted,
 		Started:           s.Started,
 		StopAfterDownload: s.StopAfterDownload,
+		SuperSeeding:      s.SuperSeeding,
+		FileStats:         s.FileStats,
+		LastScrubAt:       s.LastScrubAt,
+		FilePaths:         s.FilePaths,
+		Seq:               s.Seq,
 
-		InfoHash:  base64.StdEncoding.EncodeToString(s.InfoHash),
-		Info:      base64.StdEncoding.EncodeToString(s.Info),
-		Bitfield:  base64.StdEncoding.EncodeToString(s.Bitfield),
-		SeededFor: int64(s.SeededFor),
+		InfoHash:   base64.StdEncoding.EncodeToString(s.InfoHash),
+		Info:       base64.StdEncoding.EncodeToString(s.Info),
+		Bitfield:   base64.StdEncoding.EncodeToString(s.Bitfield),
+		SeededFor:  int64(s.SeededFor),
+		PublicKey:  base64.StdEncoding.EncodeToString(s.PublicKey),
+		Salt:       base64.StdEncoding.EncodeToString(s.Salt),
+		Signatures: base64.StdEncoding.EncodeToString(s.Signatures),
 	}
 	return json.Marshal(j)
 }
@@ -87,6 +129,22 @@ func (s *Spec) UnmarshalJSON(b []byte) error {
 	if err != nil {
 		return err
 	}
+	if j.PublicKey != "" {
+		s.PublicKey, err = base64.StdEncoding.DecodeString(j.PublicKey)
+		if err != nil {
+			return err
+		}
+		s.Salt, err = base64.StdEncoding.DecodeString(j.Salt)
+		if err != nil {
+			return err
+		}
+	}
+	if j.Signatures != "" {
+		s.Signatures, err = base64.StdEncoding.DecodeString(j.Signatures)
+		if err != nil {
+			return err
+		}
+	}
 	s.SeededFor = time.Duration(j.SeededFor)
 	s.Port = j.Port
 	s.Name = j.Name
@@ -99,5 +157,10 @@ func (s *Spec) UnmarshalJSON(b []byte) error {
 	s.BytesWasted = j.BytesWasted
 	s.Started = j.Started
 	s.StopAfterDownload = j.StopAfterDownload
+	s.SuperSeeding = j.SuperSeeding
+	s.FileStats = j.FileStats
+	s.LastScrubAt = j.LastScrubAt
+	s.FilePaths = j.FilePaths
+	s.Seq = j.Seq
 	return nil
 }
@@ -7,8 +7,11 @@ import (
 
 func TestMarshalUnmarshalSpec(t *testing.T) {
 	s := Spec{
-		Info: []byte{1, 2, 3},
-		Name: "foo",
+		Info:      []byte{1, 2, 3},
+		Name:      "foo",
+		FilePaths: []string{"bar/baz"},
+		PublicKey: []byte{4, 5, 6},
+		Seq:       7,
 	}
 	b, err := s.MarshalJSON()
 	if err != nil {
@@ -25,4 +28,10 @@ func TestMarshalUnmarshalSpec(t *testing.T) {
 	if s.Name != s2.Name {
 		t.FailNow()
 	}
+	if len(s2.FilePaths) != 1 || s.FilePaths[0] != s2.FilePaths[0] {
+		t.FailNow()
+	}
+	if !bytes.Equal(s.PublicKey, s2.PublicKey) || s.Seq != s2.Seq {
+		t.FailNow()
+	}
 }
@@ -25,6 +25,7 @@ type Peer struct {
 	Snubbed            bool
 	EncryptedHandshake bool
 	EncryptedStream    bool
+	UploadOnly         bool
 	DownloadSpeed      int
 	UploadSpeed        int
 }
@@ -50,6 +51,15 @@ type Tracker struct {
 	NextAnnounce  Time
 }
 
+// CrossSeedFile is the result of reusing a file from another torrent.
+type CrossSeedFile struct {
+	Path          string
+	Source        string
+	SourceTorrent string
+	Method        string
+	Error         string
+}
+
 // SessionStats contains statistics about a Session.
 type SessionStats struct {
 	Uptime         int
@@ -64,6 +74,10 @@ type SessionStats struct {
 	ReadCacheSize        int64
 	ReadCacheUtilization int
 
+	FilePoolOpenFiles int
+	FilePoolHits      int
+	FilePoolMisses    int
+
 	ReadsPerSecond int
 	ReadsActive    int
 	ReadsPending   int
@@ -82,6 +96,38 @@ type SessionStats struct {
 	SpeedWrite    int
 }
 
+// DHTStats contains statistics about the routing tables of DHT node.
+type DHTStats struct {
+	IPv4 DHTTableStats
+	IPv6 *DHTTableStats
+}
+
+// DHTTableStats contains statistics about the routing table of an address family.
+type DHTTableStats struct {
+	NodeID         string
+	Nodes          int
+	ReachableNodes int
+	Buckets        []DHTBucket
+}
+
+// DHTBucket contains the number of nodes sharing the same number of leading bits with the node ID.
+type DHTBucket struct {
+	Prefix         int
+	Nodes          int
+	ReachableNodes int
+}
+
+// DHTCrawlStats contains statistics about the DHT crawl.
+type DHTCrawlStats struct {
+	Running         bool
+	NodesQueried    int
+	NodesResponded  int
+	InfoHashes      int
+	MetadataSaved   int
+	MetadataFailed  int
+	MetadataSkipped int
+}
+
 // Stats contains statistics about a Torrent.
 type Stats struct {
 	InfoHash string
@@ -103,6 +149,7 @@ type Stats struct {
 		Downloaded int64
 		Uploaded   int64
 		Wasted     int64
+		Moved      int64
 	}
 	Peers struct {
 		Total    int
@@ -131,15 +178,30 @@ type Stats struct {
 		Snubbed int
 		Running int
 	}
-	Name        string
-	Private     bool
-	PieceLength uint32
-	SeededFor   uint
-	Speed       struct {
+	Name         string
+	Private      bool
+	SuperSeeding bool
+	Signer       string
+	PieceLength  uint32
+	SeededFor    uint
+	Speed        struct {
 		Download int
 		Upload   int
 	}
-	ETA int
+	ETA   int
+	Scrub struct {
+		Running  bool
+		Checked  uint32
+		Failed   int
+		LastPass Time
+	}
+	Holepunch struct {
+		Requested int
+		Relayed   int
+		Succeeded int
+		Failed    int
+	}
+	ModifiedFiles []string
 }
 
 // GetMagnetRequest contains request arguments for Session.GetMagnet method.
@@ -176,6 +238,9 @@ type AddTorrentOptions struct {
 	ID                string
 	Stopped           bool
 	StopAfterDownload bool
+	DataDir           string
+	CrossSeed         bool
+	Archive           string
 }
 
 // AddTorrentRequest contains request arguments for Session.AddTorrent method.
@@ -202,11 +267,15 @@ type AddURIResponse struct {
 
 // RemoveTorrentRequest contains request arguments for Session.RemoveTorrent method.
 type RemoveTorrentRequest struct {
-	ID string
+	ID          string
+	KeepData    bool
+	MoveToTrash bool
 }
 
 // RemoveTorrentResponse contains response arguments for Session.RemoveTorrent method.
 type RemoveTorrentResponse struct {
+	// Set if the torrent is removed but its files cannot be deleted or moved to trash.
+	DataError string
 }
 
 // CleanDatabaseRequest contains request arguments for Session.CleanDatabase method.
@@ -226,6 +295,45 @@ type GetSessionStatsResponse struct {
 	Stats SessionStats
 }
 
+// GetDHTStatsRequest contains request arguments for Session.GetDHTStats method.
+type GetDHTStatsRequest struct {
+}
+
+// GetDHTStatsResponse contains response arguments for Session.GetDHTStats method.
+type GetDHTStatsResponse struct {
+	Stats DHTStats
+}
+
+// StartDHTCrawlRequest contains request arguments for Session.StartDHTCrawl method.
+type StartDHTCrawlRequest struct {
+	Rate        int
+	MetadataDir string
+}
+
+// StartDHTCrawlResponse contains response arguments for Session.StartDHTCrawl method.
+type StartDHTCrawlResponse struct {
+}
+
+// StopDHTCrawlRequest contains request arguments for Session.StopDHTCrawl method.
+type StopDHTCrawlRequest struct {
+}
+
+// StopDHTCrawlResponse contains response arguments for Session.StopDHTCrawl method.
+type StopDHTCrawlResponse struct {
+}
+
+// GetDHTCrawlResultsRequest contains request arguments for Session.GetDHTCrawlResults method.
+type GetDHTCrawlResultsRequest struct {
+	From int
+}
+
+// GetDHTCrawlResultsResponse contains response arguments for Session.GetDHTCrawlResults method.
+type GetDHTCrawlResultsResponse struct {
+	InfoHashes []string
+	Next       int
+	Stats      DHTCrawlStats
+}
+
 // GetTorrentStatsRequest contains request arguments for Session.GetTorrentStats method.
 type GetTorrentStatsRequest struct {
 	ID string
@@ -266,6 +374,16 @@ type GetTorrentWebseedsResponse struct {
 	Webseeds []Webseed
 }
 
+// GetTorrentCrossSeedResultsRequest contains request arguments for Session.GetTorrentCrossSeedResults method.
+type GetTorrentCrossSeedResultsRequest struct {
+	ID string
+}
+
+// GetTorrentCrossSeedResultsResponse contains response arguments for Session.GetTorrentCrossSeedResults method.
+type GetTorrentCrossSeedResultsResponse struct {
+	Files []CrossSeedFile
+}
+
 // StartTorrentRequest contains request arguments for Session.StartTorrent method.
 type StartTorrentRequest struct {
 	ID string
@@ -302,6 +420,16 @@ type VerifyTorrentRequest struct {
 type VerifyTorrentResponse struct {
 }
 
+// SetTorrentSuperSeedingRequest contains request arguments for Session.SetTorrentSuperSeeding method.
+type SetTorrentSuperSeedingRequest struct {
+	ID      string
+	Enabled bool
+}
+
+// SetTorrentSuperSeedingResponse contains response arguments for Session.SetTorrentSuperSeeding method.
+type SetTorrentSuperSeedingResponse struct {
+}
+
 // MoveTorrentRequest contains request arguments for Session.MoveTorrent method.
 type MoveTorrentRequest struct {
 	ID     string
@@ -312,6 +440,28 @@ type MoveTorrentRequest struct {
 type MoveTorrentResponse struct {
 }
 
+// SetTorrentLocationRequest contains request arguments for Session.SetTorrentLocation method.
+type SetTorrentLocationRequest struct {
+	ID       string
+	Path     string
+	MoveData bool
+}
+
+// SetTorrentLocationResponse contains response arguments for Session.SetTorrentLocation method.
+type SetTorrentLocationResponse struct {
+}
+
+// RenameTorrentPathRequest contains request arguments for Session.RenameTorrentPath method.
+type RenameTorrentPathRequest struct {
+	ID      string
+	OldPath string
+	NewPath string
+}
+
+// RenameTorrentPathResponse contains response arguments for Session.RenameTorrentPath method.
+type RenameTorrentPathResponse struct {
+}
+
 // AddPeerRequest contains request arguments for Session.AddPeer method.
 type AddPeerRequest struct {
 	ID   string
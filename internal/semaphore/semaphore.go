@@ -36,6 +36,20 @@ func (s *Semaphore) Wait() {
 	atomic.AddInt32(&s.active, 1)
 }
 
+// WaitCancel waits for the semaphore like Wait but gives up if cancelC is closed.
+// Returns true if the semaphore is acquired.
+func (s *Semaphore) WaitCancel(cancelC chan struct{}) bool {
+	atomic.AddInt32(&s.waiting, 1)
+	defer atomic.AddInt32(&s.waiting, -1)
+	select {
+	case s.c <- token{}:
+		atomic.AddInt32(&s.active, 1)
+		return true
+	case <-cancelC:
+		return false
+	}
+}
+
 // Signal the semaphore. A random waiting goroutine will be waken up.
 func (s *Semaphore) Signal() {
 	<-s.c
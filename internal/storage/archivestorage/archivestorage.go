@@ -0,0 +1,196 @@
+// Package archivestorage implements a read-only Storage interface for seeding the files in a tar or zip archive.
+package archivestorage
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/rain/internal/storage"
+)
+
+var errReadOnly = errors.New("archive storage is read-only")
+
+// member is the location of a file in the archive.
+type member struct {
+	offset  int64
+	size    int64
+	modTime time.Time
+}
+
+// ArchiveStorage reads the files of a torrent from an uncompressed tar file or a zip file with stored (uncompressed) members.
+// Names of the files in the torrent are matched with the names of archive members.
+type ArchiveStorage struct {
+	path    string
+	members map[string]member
+}
+
+// New returns a new ArchiveStorage by reading the index of the archive at path.
+// Archive format is detected from the file extension.
+func New(path string) (*ArchiveStorage, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var members map[string]member
+	if strings.EqualFold(filepath.Ext(path), ".zip") {
+		members, err = readZip(f)
+	} else {
+		members, err = readTar(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read archive index: %s", err)
+	}
+	return &ArchiveStorage{path: path, members: members}, nil
+}
+
+func readTar(f *os.File) (map[string]member, error) {
+	members := make(map[string]member)
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return members, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA { // nolint: staticcheck
+			continue
+		}
+		// Data of the member starts right after the header.
+		offset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		members[cleanName(hdr.Name)] = member{offset: offset, size: hdr.Size, modTime: hdr.ModTime}
+	}
+}
+
+func readZip(f *os.File) (map[string]member, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(f, fi.Size())
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[string]member)
+	for _, zf := range zr.File {
+		if zf.Method != zip.Store || zf.FileInfo().IsDir() {
+			continue
+		}
+		offset, err := zf.DataOffset()
+		if err != nil {
+			return nil, err
+		}
+		members[cleanName(zf.Name)] = member{offset: offset, size: int64(zf.UncompressedSize64), modTime: zf.Modified}
+	}
+	return members, nil
+}
+
+func cleanName(name string) string {
+	return strings.TrimPrefix(filepath.Clean(filepath.FromSlash(name)), string(filepath.Separator))
+}
+
+var _ storage.Storage = (*ArchiveStorage)(nil)
+
+// Open a member of the archive. An error is returned if there is no member with the name and size.
+func (s *ArchiveStorage) Open(name string, size int64) (storage.File, bool, error) {
+	m, ok := s.members[cleanName(name)]
+	if !ok {
+		return nil, false, fmt.Errorf("file not found in archive: %s", name)
+	}
+	if m.size != size {
+		return nil, false, fmt.Errorf("invalid file size in archive: %s", name)
+	}
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, false, err
+	}
+	return &File{file: f, offset: m.offset, size: m.size}, true, nil
+}
+
+// Stat returns the FileInfo of the member in the archive.
+func (s *ArchiveStorage) Stat(name string) (os.FileInfo, error) {
+	m, ok := s.members[cleanName(name)]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return fileInfo{name: filepath.Base(name), member: m}, nil
+}
+
+// RootDir returns the path of the archive.
+func (s *ArchiveStorage) RootDir() string {
+	return s.path
+}
+
+// Rename is not supported because the archive is not modified.
+func (s *ArchiveStorage) Rename(oldName, newName string) error {
+	return errReadOnly
+}
+
+// SetAttributes is ignored because the archive is not modified.
+func (s *ArchiveStorage) SetAttributes(name string, executable, hidden bool) error {
+	return nil
+}
+
+// File is a member in the archive.
+type File struct {
+	file   *os.File
+	offset int64
+	size   int64
+}
+
+// ReadAt implements io.ReaderAt interface.
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || off > f.size {
+		return 0, io.EOF
+	}
+	var err error
+	if off+int64(len(p)) > f.size {
+		p = p[:f.size-off]
+		err = io.EOF
+	}
+	n, rerr := f.file.ReadAt(p, f.offset+off)
+	if rerr != nil {
+		return n, rerr
+	}
+	return n, err
+}
+
+// WriteAt returns an error because the archive is read-only.
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	return 0, errReadOnly
+}
+
+// Close the archive file.
+func (f *File) Close() error {
+	return f.file.Close()
+}
+
+type fileInfo struct {
+	name string
+	member
+}
+
+var _ os.FileInfo = fileInfo{}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) Mode() os.FileMode  { return 0444 }
+func (fi fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi fileInfo) IsDir() bool        { return false }
+func (fi fileInfo) Sys() interface{}   { return nil }
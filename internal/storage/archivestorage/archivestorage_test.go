@@ -0,0 +1,124 @@
+package archivestorage
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testFiles = []struct {
+	name string
+	data []byte
+}{
+	{"torrent/a.txt", []byte("foo")},
+	{"torrent/dir/b.bin", bytes.Repeat([]byte("bar"), 1000)},
+}
+
+func writeTar(t *testing.T, path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	for _, tf := range testFiles {
+		err = tw.WriteHeader(&tar.Header{Name: tf.name, Mode: 0600, Size: int64(len(tf.data))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tw.Write(tf.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = tw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeZip(t *testing.T, path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, tf := range testFiles {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: tf.name, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = w.Write(tf.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchiveStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rain-archivestorage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tarPath := filepath.Join(dir, "test.tar")
+	zipPath := filepath.Join(dir, "test.zip")
+	writeTar(t, tarPath)
+	writeZip(t, zipPath)
+
+	for _, path := range []string{tarPath, zipPath} {
+		sto, err := New(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tf := range testFiles {
+			name := filepath.FromSlash(tf.name)
+			fi, err := sto.Stat(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Size() != int64(len(tf.data)) {
+				t.Fatalf("invalid size: %d", fi.Size())
+			}
+			f, exists, err := sto.Open(name, int64(len(tf.data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !exists {
+				t.Fatal("file must exist")
+			}
+			b := make([]byte, len(tf.data))
+			_, err = f.ReadAt(b, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, tf.data) {
+				t.Fatalf("invalid data in %s", path)
+			}
+			// Reads must not go past the member.
+			n, err := f.ReadAt(make([]byte, 10), int64(len(tf.data)-1))
+			if n != 1 || err != io.EOF {
+				t.Fatalf("read past member: %d, %v", n, err)
+			}
+			_, err = f.WriteAt([]byte("x"), 0)
+			if err == nil {
+				t.Fatal("archive must be read-only")
+			}
+			f.Close()
+		}
+		_, _, err = sto.Open("torrent/missing", 1)
+		if err == nil {
+			t.Fatal("missing file is opened")
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Package casstorage implements Storage interface that deduplicates identical files across torrents.
+package casstorage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/cenkalti/rain/internal/storage"
+	"github.com/cenkalti/rain/internal/storage/filestorage"
+)
+
+// CASStorage implements Storage interface for saving files on disk.
+// Files are written in place while downloading like FileStorage. After they are completed,
+// they are moved into the shared Store with Store.Seal.
+// Writing to a file that is shared with the Store makes a private copy of the file first.
+type CASStorage struct {
+	*filestorage.FileStorage
+	store *Store
+}
+
+// New returns a new CASStorage at the destination.
+func New(dest string, store *Store) (*CASStorage, error) {
+	fs, err := filestorage.New(dest)
+	if err != nil {
+		return nil, err
+	}
+	return &CASStorage{FileStorage: fs, store: store}, nil
+}
+
+var _ storage.Storage = (*CASStorage)(nil)
+
+// Store returns the shared Store that completed files are moved into.
+func (s *CASStorage) Store() *Store {
+	return s.store
+}
+
+// Open a file.
+func (s *CASStorage) Open(name string, size int64) (f storage.File, exists bool, err error) {
+	of, exists, err := s.FileStorage.Open(name, size)
+	if err != nil {
+		return
+	}
+	f = &File{
+		sto:  s.FileStorage,
+		name: name,
+		path: filepath.Join(s.RootDir(), filepath.Clean(name)),
+		size: size,
+		file: of,
+	}
+	return
+}
+
+// File is a file on disk that may be a link to an object in the Store.
+type File struct {
+	sto  *filestorage.FileStorage
+	name string
+	path string
+	size int64
+
+	m    sync.RWMutex
+	file storage.File
+}
+
+// ReadAt implements io.ReaderAt interface.
+// The content does not change when the file is sealed, so the open file is read even if it is replaced on disk.
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	f.m.RLock()
+	defer f.m.RUnlock()
+	return f.file.ReadAt(p, off)
+}
+
+// WriteAt implements io.WriterAt interface.
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	err := f.makePrivate()
+	if err != nil {
+		return 0, err
+	}
+	return f.file.WriteAt(p, off)
+}
+
+// makePrivate makes sure that the open file is the one at path and it is not linked from anywhere else.
+func (f *File) makePrivate() error {
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	n, err := linkCount(f.path, fi)
+	if err != nil {
+		return err
+	}
+	if n > 1 {
+		err = copyFile(f.path, f.path+".cas")
+		if err != nil {
+			return err
+		}
+		err = os.Rename(f.path+".cas", f.path)
+		if err != nil {
+			_ = os.Remove(f.path + ".cas")
+			return err
+		}
+		return f.reopen()
+	}
+	if of, ok := f.file.(*os.File); ok {
+		ofi, err := of.Stat()
+		if err != nil {
+			return err
+		}
+		if os.SameFile(fi, ofi) {
+			return nil
+		}
+	}
+	// File is replaced on disk after it is opened.
+	return f.reopen()
+}
+
+func (f *File) reopen() error {
+	of, _, err := f.sto.Open(f.name, f.size)
+	if err != nil {
+		return err
+	}
+	_ = f.file.Close()
+	f.file = of
+	return nil
+}
+
+// Close the file.
+func (f *File) Close() error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return f.file.Close()
+}
+
+func copyFile(src, dst string) error {
+	sf, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+	df, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(df, sf)
+	if err != nil {
+		_ = df.Close()
+		_ = os.Remove(dst)
+		return err
+	}
+	return df.Close()
+}
@@ -0,0 +1,162 @@
+package casstorage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeduplicate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rain-cas-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewStore(filepath.Join(dir, "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("hello world")
+	var files []*File
+	for _, name := range []string{"t1", "t2"} {
+		sto, err := New(filepath.Join(dir, name), store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, _, err := sto.Open("file", int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		_, err = f.WriteAt(data, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = store.Seal(filepath.Join(dir, name, "file"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f.(*File))
+	}
+	fi1, err := os.Stat(filepath.Join(dir, "t1", "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi2, err := os.Stat(filepath.Join(dir, "t2", "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(fi1, fi2) {
+		t.Fatal("files are not deduplicated")
+	}
+
+	// Open file is still readable after it is replaced.
+	b := make([]byte, len(data))
+	_, err = files[1].ReadAt(b, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != string(data) {
+		t.Fatalf("read: %q", b)
+	}
+
+	// Writing to a shared file must not change other torrents.
+	_, err = files[1].WriteAt([]byte("j"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = ioutil.ReadFile(filepath.Join(dir, "t1", "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != string(data) {
+		t.Fatalf("shared file is modified: %q", b)
+	}
+	b, err = ioutil.ReadFile(filepath.Join(dir, "t2", "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "jello world" {
+		t.Fatalf("write is lost: %q", b)
+	}
+
+	// Object is referenced by t1 only.
+	freed, err := store.GC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freed != 0 {
+		t.Fatalf("freed %d bytes", freed)
+	}
+	err = os.RemoveAll(filepath.Join(dir, "t1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	freed, err = store.GC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freed != int64(len(data)) {
+		t.Fatalf("freed %d bytes", freed)
+	}
+}
+
+func TestUnseal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rain-cas-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewStore(filepath.Join(dir, "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "file")
+	err = ioutil.WriteFile(path, []byte("hello world"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Seal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Content is corrupted after sealing.
+	err = ioutil.WriteFile(path, []byte("jello world"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Unseal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := linkCount(path, fi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("file has %d links", n)
+	}
+	// Same content is not linked to the corrupted object.
+	path2 := filepath.Join(dir, "file2")
+	err = ioutil.WriteFile(path2, []byte("hello world"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Seal(path2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello world" {
+		t.Fatalf("file is linked to corrupted object: %q", b)
+	}
+}
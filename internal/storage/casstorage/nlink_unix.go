@@ -0,0 +1,17 @@
+// +build !windows
+
+package casstorage
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+func linkCount(path string, fi os.FileInfo) (uint64, error) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, errors.New("cannot get link count of " + path)
+	}
+	return uint64(st.Nlink), nil
+}
@@ -0,0 +1,23 @@
+// +build windows
+
+package casstorage
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+func linkCount(path string, fi os.FileInfo) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var info windows.ByHandleFileInformation
+	err = windows.GetFileInformationByHandle(windows.Handle(f.Fd()), &info)
+	if err != nil {
+		return 0, os.NewSyscallError("GetFileInformationByHandle", err)
+	}
+	return uint64(info.NumberOfLinks), nil
+}
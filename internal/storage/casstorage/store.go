@@ -0,0 +1,153 @@
+package casstorage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Store keeps the content of completed files by their hash.
+// Files in torrents are hard links to the objects in the Store, so identical files take disk space only once.
+// The link count of an object is its reference count. Objects that are not linked from any torrent are removed by GC.
+// Store must be on the same filesystem with the torrent files.
+type Store struct {
+	dir string
+}
+
+// NewStore returns a new Store that saves objects in dir.
+func NewStore(dir string) (*Store, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(dir, os.ModeDir|0750)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Dir returns the directory that objects are saved in.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+func (s *Store) objectPath(sum []byte) string {
+	h := hex.EncodeToString(sum)
+	return filepath.Join(s.dir, h[:2], h)
+}
+
+// Seal moves the content of a completed file into the Store.
+// If the Store already has an object with the same content, file is replaced with a link to the object.
+// Files that are linked already are skipped without checking their content.
+func (s *Store) Seal(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	n, err := linkCount(path, fi)
+	if err != nil {
+		return err
+	}
+	if n > 1 {
+		return nil
+	}
+	sum, err := hashFile(path)
+	if err != nil {
+		return err
+	}
+	obj := s.objectPath(sum)
+	err = os.MkdirAll(filepath.Dir(obj), os.ModeDir|0750)
+	if err != nil {
+		return err
+	}
+	ofi, err := os.Stat(obj)
+	if os.IsNotExist(err) {
+		return os.Link(path, obj)
+	}
+	if err != nil {
+		return err
+	}
+	if os.SameFile(fi, ofi) {
+		return nil
+	}
+	tmp := path + ".cas"
+	err = os.Link(obj, tmp)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
+
+// Unseal removes the object that the file at path is linked to, so the content is not reused for new files.
+// It is used when the content of a sealed file is found to be corrupted. The file itself and other links to the object are kept.
+func (s *Store) Unseal(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	n, err := linkCount(path, fi)
+	if err != nil {
+		return err
+	}
+	if n < 2 {
+		return nil
+	}
+	// Content may be changed, so the object cannot be found by its hash.
+	return filepath.Walk(s.dir, func(obj string, ofi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if ofi.IsDir() || !os.SameFile(fi, ofi) {
+			return nil
+		}
+		return os.Remove(obj)
+	})
+}
+
+// GC removes the objects that are not linked from any torrent and returns the number of bytes reclaimed.
+func (s *Store) GC() (int64, error) {
+	var freed int64
+	err := filepath.Walk(s.dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		n, err := linkCount(path, fi)
+		if err != nil {
+			return err
+		}
+		if n > 1 {
+			return nil
+		}
+		err = os.Remove(path)
+		if err != nil {
+			return err
+		}
+		freed += fi.Size()
+		return nil
+	})
+	return freed, err
+}
+
+func hashFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
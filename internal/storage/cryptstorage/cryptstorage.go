@@ -0,0 +1,262 @@
+// Package cryptstorage implements Storage interface that encrypts file contents on disk.
+package cryptstorage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/cenkalti/rain/internal/storage"
+	"github.com/cenkalti/rain/internal/storage/filestorage"
+)
+
+// Files are split into chunks that are encrypted separately, so any part of a file can be read or written
+// without processing the whole file. Each chunk is saved with a random nonce and authentication tag:
+//
+//	| nonce (12 bytes) | encrypted data (up to ChunkSize bytes) | tag (16 bytes) |
+//
+// Chunks that are not written yet are read as zeros. When a file is created, an empty chunk is sealed at the
+// beginning of each chunk as an authenticated marker, so chunks that are zeroed on disk are not accepted:
+//
+//	| nonce (12 bytes) | tag (16 bytes) | zeros |
+const (
+	// ChunkSize is the size of plaintext in a chunk.
+	ChunkSize = 64 << 10
+
+	nonceSize = 12
+	tagSize   = 16
+	overhead  = nonceSize + tagSize
+)
+
+var errOutOfRange = errors.New("offset out of range")
+
+// CryptStorage implements Storage interface for saving files on disk encrypted with AES-GCM.
+// Operations other than opening files are same as FileStorage.
+type CryptStorage struct {
+	*filestorage.FileStorage
+	aead cipher.AEAD
+}
+
+// New returns a new CryptStorage at the destination. Key must be 32 bytes long.
+func New(dest string, key []byte) (*CryptStorage, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid key length: %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	fs, err := filestorage.New(dest)
+	if err != nil {
+		return nil, err
+	}
+	return &CryptStorage{FileStorage: fs, aead: aead}, nil
+}
+
+var _ storage.Storage = (*CryptStorage)(nil)
+
+// Open a file. Size of the file on disk is larger than size because of encryption overhead.
+func (s *CryptStorage) Open(name string, size int64) (f storage.File, exists bool, err error) {
+	of, exists, err := s.FileStorage.Open(name, diskSize(size))
+	if err != nil {
+		return
+	}
+	cf := &File{
+		file: of,
+		size: size,
+		aead: s.aead,
+	}
+	if !exists {
+		err = cf.writeMarkers(filepath.Join(s.RootDir(), filepath.Clean(name)))
+		if err != nil {
+			_ = of.Close()
+			return
+		}
+	}
+	f = cf
+	return
+}
+
+func diskSize(size int64) int64 {
+	chunks := (size + ChunkSize - 1) / ChunkSize
+	return size + chunks*overhead
+}
+
+// File is an encrypted file on disk.
+type File struct {
+	file storage.File
+	size int64
+	aead cipher.AEAD
+
+	// Writes to a part of a chunk needs to read the chunk first.
+	m sync.RWMutex
+}
+
+// chunkLength returns the length of plaintext in chunk i.
+func (f *File) chunkLength(i int64) int64 {
+	n := f.size - i*ChunkSize
+	if n > ChunkSize {
+		n = ChunkSize
+	}
+	return n
+}
+
+func (f *File) readChunk(i int64) ([]byte, error) {
+	buf := make([]byte, f.chunkLength(i)+overhead)
+	_, err := f.file.ReadAt(buf, i*(ChunkSize+overhead))
+	if err != nil {
+		return nil, err
+	}
+	if isZero(buf[overhead:]) {
+		if _, err = f.aead.Open(nil, buf[:nonceSize], buf[nonceSize:overhead], markerData(i)); err == nil {
+			return buf[overhead:], nil
+		}
+	}
+	plain, err := f.aead.Open(buf[nonceSize:nonceSize], buf[:nonceSize], buf[nonceSize:], chunkIndex(i))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt chunk %d: %s", i, err)
+	}
+	return plain, nil
+}
+
+func (f *File) writeChunk(i int64, plain []byte) error {
+	buf := make([]byte, nonceSize, len(plain)+overhead)
+	_, err := io.ReadFull(rand.Reader, buf)
+	if err != nil {
+		return err
+	}
+	buf = f.aead.Seal(buf, buf[:nonceSize], plain, chunkIndex(i))
+	_, err = f.file.WriteAt(buf, i*(ChunkSize+overhead))
+	return err
+}
+
+// writeMarkers marks all chunks of a new file at path as not written.
+// Files in FileStorage are opened with O_SYNC. Markers are written through a separate handle without it
+// and flushed to disk once at the end instead of waiting for the disk on each chunk.
+func (f *File) writeMarkers(path string) (err error) {
+	of, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		cerr := of.Close()
+		if err == nil {
+			err = cerr
+		}
+	}()
+	chunks := (f.size + ChunkSize - 1) / ChunkSize
+	for i := int64(0); i < chunks; i++ {
+		buf := make([]byte, nonceSize, overhead)
+		_, err := io.ReadFull(rand.Reader, buf)
+		if err != nil {
+			return err
+		}
+		buf = f.aead.Seal(buf, buf[:nonceSize], nil, markerData(i))
+		_, err = of.WriteAt(buf, i*(ChunkSize+overhead))
+		if err != nil {
+			return err
+		}
+	}
+	return of.Sync()
+}
+
+// markerData is authenticated with the marker of chunk i. It is different from the data of written chunks.
+func markerData(i int64) []byte {
+	return append(chunkIndex(i), 0xff)
+}
+
+// chunkIndex is authenticated with the chunk, so chunks cannot be swapped in the file.
+func chunkIndex(i int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(i))
+	return b
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadAt decrypts the chunks in range and implements io.ReaderAt interface.
+func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errOutOfRange
+	}
+	f.m.RLock()
+	defer f.m.RUnlock()
+	end := off + int64(len(p))
+	if end > f.size {
+		end = f.size
+		err = io.EOF
+	}
+	for pos := off; pos < end; {
+		i := pos / ChunkSize
+		chunk, rerr := f.readChunk(i)
+		if rerr != nil {
+			return n, rerr
+		}
+		m := copy(p[n:end-off], chunk[pos-i*ChunkSize:])
+		n += m
+		pos += int64(m)
+	}
+	return n, err
+}
+
+// WriteAt encrypts the chunks in range and implements io.WriterAt interface.
+// Chunks that are partially written are read and decrypted first.
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	end := off + int64(len(p))
+	if off < 0 || end > f.size {
+		return 0, errOutOfRange
+	}
+	f.m.Lock()
+	defer f.m.Unlock()
+	var n int
+	for pos := off; pos < end; {
+		i := pos / ChunkSize
+		begin := pos - i*ChunkSize
+		length := f.chunkLength(i)
+		var chunk []byte
+		if begin == 0 && end-pos >= length {
+			chunk = p[n : n+int(length)]
+		} else {
+			var err error
+			chunk, err = f.readChunk(i)
+			if err != nil {
+				return n, err
+			}
+			copy(chunk[begin:], p[n:])
+		}
+		err := f.writeChunk(i, chunk)
+		if err != nil {
+			return n, err
+		}
+		m := int(length - begin)
+		if int64(m) > end-pos {
+			m = int(end - pos)
+		}
+		n += m
+		pos += int64(m)
+	}
+	return n, nil
+}
+
+// Close the file.
+func (f *File) Close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,132 @@
+package cryptstorage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rain-cryptstorage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key := bytes.Repeat([]byte{1}, 32)
+	sto, err := New(dir, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const size = 3*ChunkSize + 1000
+	f, exists, err := sto.Open("file", size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("file must not exist")
+	}
+
+	// Unwritten parts are read as zeros.
+	expected := make([]byte, size)
+	b := make([]byte, size)
+	_, err = f.ReadAt(b, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, expected) {
+		t.Fatal("unwritten file is not zero")
+	}
+
+	rnd := rand.New(rand.NewSource(0))
+	for i := 0; i < 100; i++ {
+		off := rnd.Int63n(size)
+		data := make([]byte, rnd.Int63n(size-off)+1)
+		rnd.Read(data)
+		_, err = f.WriteAt(data, off)
+		if err != nil {
+			t.Fatal(err)
+		}
+		copy(expected[off:], data)
+
+		off = rnd.Int63n(size)
+		b = make([]byte, rnd.Int63n(size-off)+1)
+		_, err = f.ReadAt(b, off)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, expected[off:off+int64(len(b))]) {
+			t.Fatalf("invalid read at %d", off)
+		}
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := ioutil.ReadFile(filepath.Join(dir, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(raw)) != diskSize(size) {
+		t.Fatalf("invalid size on disk: %d", len(raw))
+	}
+	if bytes.Contains(raw, expected[:100]) {
+		t.Fatal("data is not encrypted")
+	}
+
+	// Data can be read with the same key after reopening.
+	f, exists, err = sto.Open("file", size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("file must exist")
+	}
+	b = make([]byte, size)
+	_, err = f.ReadAt(b, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, expected) {
+		t.Fatal("invalid read after reopening")
+	}
+	f.Close()
+
+	// Modified data cannot be read.
+	raw[nonceSize] ^= 0xff
+	err = ioutil.WriteFile(filepath.Join(dir, "file"), raw, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, _, err = sto.Open("file", size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.ReadAt(b[:1], 0)
+	if err == nil {
+		t.Fatal("modified chunk is read")
+	}
+	f.Close()
+
+	// Zeroed chunk is not read as an unwritten chunk.
+	chunk := raw[ChunkSize+overhead : 2*(ChunkSize+overhead)]
+	for i := range chunk {
+		chunk[i] = 0
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "file"), raw, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, _, err = sto.Open("file", size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, err = f.ReadAt(b[:1], ChunkSize)
+	if err == nil {
+		t.Fatal("zeroed chunk is read")
+	}
+}
@@ -4,6 +4,7 @@ package filestorage
 import (
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/cenkalti/rain/internal/storage"
 )
@@ -25,6 +26,72 @@ func New(dest string) (*FileStorage, error) {
 
 var _ storage.Storage = (*FileStorage)(nil)
 
+// RootDir is the absolute path of the destination directory.
+func (s *FileStorage) RootDir() string {
+	return s.dest
+}
+
+// Stat returns the FileInfo of the file on disk.
+func (s *FileStorage) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(filepath.Join(s.dest, filepath.Clean(name)))
+}
+
+// Rename moves the file to a new name under the same root.
+// Directories left empty after renaming are removed.
+// Files can be renamed while they are open on platforms that allow it.
+func (s *FileStorage) Rename(oldName, newName string) error {
+	oldName = filepath.Join(s.dest, filepath.Clean(oldName))
+	newName = filepath.Join(s.dest, filepath.Clean(newName))
+	_, err := os.Lstat(oldName)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = os.Lstat(newName)
+	if err == nil {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: os.ErrExist}
+	}
+	err = os.MkdirAll(filepath.Dir(newName), os.ModeDir|0750)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(oldName, newName)
+	if err != nil {
+		return err
+	}
+	for dir := filepath.Dir(oldName); dir != s.dest && strings.HasPrefix(dir, s.dest); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			// Directory is not empty.
+			break
+		}
+	}
+	return nil
+}
+
+// SetAttributes makes the file executable and/or hidden.
+// Hidden attribute is only applied on Windows. On other platforms, files starting with a dot are already hidden.
+func (s *FileStorage) SetAttributes(name string, executable, hidden bool) error {
+	name = filepath.Join(s.dest, filepath.Clean(name))
+	if executable {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		// Add execute permission to whom the file is readable.
+		mode := fi.Mode().Perm()
+		err = os.Chmod(name, mode|(mode&0444)>>2)
+		if err != nil {
+			return err
+		}
+	}
+	if hidden {
+		return setHidden(name)
+	}
+	return nil
+}
+
 // Open a file.
 func (s *FileStorage) Open(name string, size int64) (f storage.File, exists bool, err error) {
 	name = filepath.Clean(name)
@@ -0,0 +1,7 @@
+// +build !windows
+
+package filestorage
+
+func setHidden(name string) error {
+	return nil
+}
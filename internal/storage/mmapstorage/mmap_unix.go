@@ -0,0 +1,38 @@
+// +build !windows
+
+package mmapstorage
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+type mapping struct {
+	data []byte
+}
+
+func mmap(f *os.File, size int) (*mapping, error) {
+	data, err := unix.Mmap(int(f.Fd()), 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return nil, &os.PathError{Op: "mmap", Path: f.Name(), Err: err}
+	}
+	return &mapping{data: data}, nil
+}
+
+func (m *mapping) bytes() []byte {
+	if m == nil {
+		return nil
+	}
+	return m.data
+}
+
+func (m *mapping) sync(off, length int) error {
+	// Address passed to msync must be aligned to page boundary.
+	begin := off &^ (os.Getpagesize() - 1)
+	return unix.Msync(m.data[begin:off+length], unix.MS_SYNC)
+}
+
+func (m *mapping) unmap() error {
+	return unix.Munmap(m.data)
+}
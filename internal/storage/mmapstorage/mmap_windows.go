@@ -0,0 +1,60 @@
+// +build windows
+
+package mmapstorage
+
+import (
+	"os"
+	"reflect"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+type mapping struct {
+	file   *os.File
+	handle windows.Handle
+	addr   uintptr
+	data   []byte
+}
+
+func mmap(f *os.File, size int) (*mapping, error) {
+	h, err := windows.CreateFileMapping(windows.Handle(f.Fd()), nil, windows.PAGE_READWRITE, uint32(uint64(size)>>32), uint32(size), nil)
+	if err != nil {
+		return nil, os.NewSyscallError("CreateFileMapping", err)
+	}
+	addr, err := windows.MapViewOfFile(h, windows.FILE_MAP_WRITE, 0, 0, uintptr(size))
+	if err != nil {
+		_ = windows.CloseHandle(h)
+		return nil, os.NewSyscallError("MapViewOfFile", err)
+	}
+	m := &mapping{file: f, handle: h, addr: addr}
+	sh := (*reflect.SliceHeader)(unsafe.Pointer(&m.data))
+	sh.Data = addr
+	sh.Len = size
+	sh.Cap = size
+	return m, nil
+}
+
+func (m *mapping) bytes() []byte {
+	if m == nil {
+		return nil
+	}
+	return m.data
+}
+
+func (m *mapping) sync(off, length int) error {
+	err := windows.FlushViewOfFile(m.addr+uintptr(off), uintptr(length))
+	if err != nil {
+		return os.NewSyscallError("FlushViewOfFile", err)
+	}
+	return m.file.Sync()
+}
+
+func (m *mapping) unmap() error {
+	err := windows.UnmapViewOfFile(m.addr)
+	err2 := windows.CloseHandle(m.handle)
+	if err != nil {
+		return os.NewSyscallError("UnmapViewOfFile", err)
+	}
+	return err2
+}
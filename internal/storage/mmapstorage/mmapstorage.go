@@ -0,0 +1,160 @@
+// Package mmapstorage implements Storage interface that maps files on disk into memory.
+package mmapstorage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/cenkalti/rain/internal/storage"
+	"github.com/cenkalti/rain/internal/storage/filestorage"
+)
+
+// MmapStorage implements Storage interface for saving files on disk.
+// Files are accessed by copying to and from a shared memory mapping instead of read/write system calls.
+// Operations other than opening files are same as FileStorage.
+type MmapStorage struct {
+	*filestorage.FileStorage
+}
+
+// New returns a new MmapStorage at the destination.
+func New(dest string) (*MmapStorage, error) {
+	fs, err := filestorage.New(dest)
+	if err != nil {
+		return nil, err
+	}
+	return &MmapStorage{FileStorage: fs}, nil
+}
+
+var _ storage.Storage = (*MmapStorage)(nil)
+
+// Open a file and map it into memory.
+func (s *MmapStorage) Open(name string, size int64) (f storage.File, exists bool, err error) {
+	if int64(int(size)) != size {
+		err = fmt.Errorf("file is too large to map into memory: %d bytes", size)
+		return
+	}
+	name = filepath.Join(s.RootDir(), filepath.Clean(name))
+
+	// Create containing dir if not exists.
+	err = os.MkdirAll(filepath.Dir(name), os.ModeDir|0750)
+	if err != nil {
+		return
+	}
+
+	const mode = 0640
+	of, err := os.OpenFile(name, os.O_RDWR, mode)
+	if os.IsNotExist(err) {
+		of, err = os.OpenFile(name, os.O_RDWR|os.O_CREATE, mode)
+	} else if err == nil {
+		exists = true
+	}
+	if err != nil {
+		return
+	}
+	// Make sure OS file is closed in case of any error.
+	defer func() {
+		if err != nil {
+			_ = of.Close()
+		}
+	}()
+	fi, err := of.Stat()
+	if err != nil {
+		return
+	}
+	if fi.Size() != size {
+		err = of.Truncate(size)
+		if err != nil {
+			return
+		}
+	}
+	mf := &File{file: of}
+	if size > 0 {
+		mf.mapping, err = mmap(of, int(size))
+		if err != nil {
+			return
+		}
+	}
+	f = mf
+	return
+}
+
+// File is a file on disk that is mapped into memory.
+type File struct {
+	file    *os.File
+	mapping *mapping
+}
+
+var errOutOfRange = errors.New("offset out of range")
+
+// ReadAt copies the bytes from the mapping.
+// Reading from a file that is truncated by another process returns an error instead of crashing the program.
+func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
+	data := f.mapping.bytes()
+	if off < 0 || off > int64(len(data)) {
+		return 0, errOutOfRange
+	}
+	defer recoverFault(&err)
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	n = copy(p, data[off:])
+	if n < len(p) {
+		err = io.EOF
+	}
+	return
+}
+
+// WriteAt copies the bytes into the mapping. The data is flushed to disk when SyncRange is called.
+func (f *File) WriteAt(p []byte, off int64) (n int, err error) {
+	data := f.mapping.bytes()
+	if off < 0 || off+int64(len(p)) > int64(len(data)) {
+		return 0, errOutOfRange
+	}
+	defer recoverFault(&err)
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	n = copy(data[off:], p)
+	return
+}
+
+// SyncRange flushes the modified pages in the range to disk.
+func (f *File) SyncRange(off, length int64) error {
+	data := f.mapping.bytes()
+	if off < 0 || length < 0 || off+length > int64(len(data)) {
+		return errOutOfRange
+	}
+	if length == 0 {
+		return nil
+	}
+	return f.mapping.sync(int(off), int(length))
+}
+
+// Close unmaps the file from memory and closes the file.
+func (f *File) Close() error {
+	var err error
+	if f.mapping != nil {
+		err = f.mapping.unmap()
+		f.mapping = nil
+	}
+	err2 := f.file.Close()
+	if err == nil {
+		err = err2
+	}
+	return err
+}
+
+// recoverFault converts the panic caused by an invalid memory access to an error.
+// Accessing the pages beyond the end of the file causes SIGBUS if the file is truncated after it is mapped.
+func recoverFault(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if _, ok := r.(runtime.Error); ok {
+		*err = fmt.Errorf("cannot access mapped file: %s", r)
+		return
+	}
+	panic(r)
+}
@@ -0,0 +1,175 @@
+package mmapstorage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cenkalti/rain/internal/filesection"
+	"github.com/cenkalti/rain/internal/storage"
+	"github.com/cenkalti/rain/internal/storage/filestorage"
+)
+
+func tempdir(t testing.TB) (string, func()) {
+	dir, err := ioutil.TempDir("", "rain-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestReadWrite(t *testing.T) {
+	dir, cleanup := tempdir(t)
+	defer cleanup()
+	s, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, exists, err := s.Open(filepath.Join("foo", "bar"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("new file exists")
+	}
+	p := filesection.Piece{{File: f, Offset: 2, Length: 5}}
+	_, err = p.Write([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteAt([]byte("x"), 10)
+	if err == nil {
+		t.Fatal("write beyond end of file")
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "foo", "bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, []byte("\x00\x00hello\x00\x00\x00")) {
+		t.Fatalf("invalid file content: %q", b)
+	}
+
+	f, exists, err = s.Open(filepath.Join("foo", "bar"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if !exists {
+		t.Fatal("file does not exist")
+	}
+	buf := make([]byte, 5)
+	_, err = f.ReadAt(buf, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Fatalf("invalid read: %q", buf)
+	}
+}
+
+func TestTruncatedFile(t *testing.T) {
+	dir, cleanup := tempdir(t)
+	defer cleanup()
+	s, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := int64(4 * os.Getpagesize())
+	f, _, err := s.Open("foo", size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// Another process truncates the file while it is mapped.
+	err = os.Truncate(filepath.Join(dir, "foo"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	_, err = f.ReadAt(buf, size-100)
+	if err == nil {
+		t.Fatal("no error reading truncated file")
+	}
+	_, err = f.WriteAt(buf, size-100)
+	if err == nil {
+		t.Fatal("no error writing truncated file")
+	}
+}
+
+const (
+	benchFileSize   = 64 << 20
+	benchPieceSize  = 256 << 10
+	benchReadLength = 16 << 10
+)
+
+func benchmarkStorages(b *testing.B, fn func(b *testing.B, f storage.File)) {
+	newStorages := map[string]func(dest string) (storage.Storage, error){
+		"file": func(dest string) (storage.Storage, error) { return filestorage.New(dest) },
+		"mmap": func(dest string) (storage.Storage, error) { return New(dest) },
+	}
+	for _, name := range []string{"file", "mmap"} {
+		b.Run(name, func(b *testing.B) {
+			dir, cleanup := tempdir(b)
+			defer cleanup()
+			s, err := newStorages[name](dir)
+			if err != nil {
+				b.Fatal(err)
+			}
+			f, _, err := s.Open("bench", benchFileSize)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer f.Close()
+			// Fill the file, so benchmarks do not measure allocation of sparse file blocks.
+			buf := bytes.Repeat([]byte{1}, benchPieceSize)
+			for off := int64(0); off < benchFileSize; off += benchPieceSize {
+				_, err = f.WriteAt(buf, off)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			fn(b, f)
+		})
+	}
+}
+
+// BenchmarkWritePiece measures writing downloaded pieces, including flushing them to disk.
+func BenchmarkWritePiece(b *testing.B) {
+	benchmarkStorages(b, func(b *testing.B, f storage.File) {
+		buf := bytes.Repeat([]byte{1}, benchPieceSize)
+		b.SetBytes(benchPieceSize)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			off := int64(i*benchPieceSize) % benchFileSize
+			p := filesection.Piece{{File: f, Offset: off, Length: benchPieceSize}}
+			_, err := p.Write(buf)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkReadBlock measures reading blocks requested by peers.
+func BenchmarkReadBlock(b *testing.B) {
+	benchmarkStorages(b, func(b *testing.B, f storage.File) {
+		buf := make([]byte, benchReadLength)
+		b.SetBytes(benchReadLength)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			// Jump between pieces like peers requesting different pieces.
+			off := int64(i*7*benchPieceSize+(i%16)*benchReadLength) % benchFileSize
+			_, err := f.ReadAt(buf, off)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -1,11 +1,22 @@
 // Package storage contains an interface for reading and writing files in a torrent.
 package storage
 
-import "io"
+import (
+	"io"
+	"os"
+)
 
 // Storage is an interface for reading/writing torrent files.
 type Storage interface {
 	Open(name string, size int64) (f File, exists bool, err error)
+	// Stat returns the FileInfo of the file without opening it.
+	Stat(name string) (os.FileInfo, error)
+	// RootDir is the directory that files are saved under.
+	RootDir() string
+	// Rename changes the name of a file. It is not an error if the file does not exist.
+	Rename(oldName, newName string) error
+	// SetAttributes applies the attributes defined in torrent to the file.
+	SetAttributes(name string, executable, hidden bool) error
 }
 
 // File interface for reading/writing torrent data.
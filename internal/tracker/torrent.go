@@ -8,4 +8,6 @@ type Torrent struct {
 	InfoHash        [20]byte
 	PeerID          [20]byte
 	Port            int
+	// PartialSeed is true if we are not going to download the remaining bytes.
+	PartialSeed bool
 }
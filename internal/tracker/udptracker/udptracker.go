@@ -55,6 +55,10 @@ func (t *UDPTracker) Announce(ctx context.Context, req tracker.AnnounceRequest)
 		NumWant:    int32(req.NumWant),
 		Port:       uint16(req.Torrent.Port),
 	}
+	if request.Event == tracker.EventPaused {
+		// UDP trackers don't know about paused event. It is sent as a regular announce.
+		request.Event = tracker.EventNone
+	}
 	binary.BigEndian.PutUint32(request.PeerID[16:20], request.Key)
 	request.SetAction(actionAnnounce)
 
@@ -8,6 +8,7 @@ type downloadJob struct {
 	Filename   string
 	RangeBegin int64
 	Length     int64
+	Padding    bool
 }
 
 func createJobs(pieces []piece.Piece, begin, end uint32) []downloadJob {
@@ -24,6 +25,7 @@ func createJobs(pieces []piece.Piece, begin, end uint32) []downloadJob {
 					Filename:   sec.Name,
 					RangeBegin: sec.Offset,
 					Length:     sec.Length,
+					Padding:    sec.Padding,
 				}
 				continue
 			}
@@ -38,6 +40,7 @@ func createJobs(pieces []piece.Piece, begin, end uint32) []downloadJob {
 				Filename:   sec.Name,
 				RangeBegin: sec.Offset,
 				Length:     sec.Length,
+				Padding:    sec.Padding,
 			}
 		}
 	}
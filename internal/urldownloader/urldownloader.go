@@ -71,7 +71,8 @@ func (d *URLDownloader) ReadCurrent() uint32 {
 }
 
 // Run the URLDownloader and download pieces.
-func (d *URLDownloader) Run(client *http.Client, pieces []piece.Piece, multifile bool, resultC chan interface{}, pool *bufferpool.Pool, readTimeout time.Duration) {
+// paths maps the file paths in torrent to the paths requested from the source. Files that are not in paths are requested with their paths in torrent.
+func (d *URLDownloader) Run(client *http.Client, pieces []piece.Piece, multifile bool, paths map[string]string, resultC chan interface{}, pool *bufferpool.Pool, readTimeout time.Duration) {
 	defer close(d.doneC)
 	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
@@ -87,32 +88,12 @@ func (d *URLDownloader) Run(client *http.Client, pieces []piece.Piece, multifile
 	var n int // position in piece
 	buf := pool.Get(int(pieces[d.current].Length))
 
-	processJob := func(job downloadJob) bool {
-		u := d.getURL(job.Filename, multifile)
-		req, err := http.NewRequest(http.MethodGet, u, nil)
-		if err != nil {
-			d.sendResult(resultC, &PieceResult{Downloader: d, Error: err})
-			return false
-		}
-		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", job.RangeBegin, job.RangeBegin+job.Length-1))
-		req = req.WithContext(ctx)
-		resp, err := client.Do(req)
-		if err != nil {
-			d.sendResult(resultC, &PieceResult{Downloader: d, Error: err})
-			return false
-		}
-		defer resp.Body.Close()
-		err = checkStatus(resp)
-		if err != nil {
-			d.sendResult(resultC, &PieceResult{Downloader: d, Error: err})
-			return false
-		}
-		timer := time.AfterFunc(readTimeout, cancel)
-		defer timer.Stop()
+	// Returns false if the downloader needs to stop.
+	readJob := func(job downloadJob, body io.Reader, timer *time.Timer) bool {
 		var m int64 // position in response
 		for m < job.Length {
 			readSize := calcReadSize(buf, n, job, m)
-			o, err := readFull(resp.Body, buf.Data[n:int64(n)+readSize], timer, readTimeout)
+			o, err := readFull(body, buf.Data[n:int64(n)+readSize], timer, readTimeout)
 			if err != nil {
 				d.sendResult(resultC, &PieceResult{Downloader: d, Error: err})
 				return false
@@ -134,6 +115,41 @@ func (d *URLDownloader) Run(client *http.Client, pieces []piece.Piece, multifile
 		}
 		return true
 	}
+
+	processJob := func(job downloadJob) bool {
+		if job.Padding {
+			// Data of padding files are known to be zeros. No need to request them.
+			timer := time.NewTimer(readTimeout)
+			defer timer.Stop()
+			return readJob(job, zeroReader{}, timer)
+		}
+		filename := job.Filename
+		if p, ok := paths[filename]; ok {
+			filename = p
+		}
+		u := d.getURL(filename, multifile)
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			d.sendResult(resultC, &PieceResult{Downloader: d, Error: err})
+			return false
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", job.RangeBegin, job.RangeBegin+job.Length-1))
+		req = req.WithContext(ctx)
+		resp, err := client.Do(req)
+		if err != nil {
+			d.sendResult(resultC, &PieceResult{Downloader: d, Error: err})
+			return false
+		}
+		defer resp.Body.Close()
+		err = checkStatus(resp)
+		if err != nil {
+			d.sendResult(resultC, &PieceResult{Downloader: d, Error: err})
+			return false
+		}
+		timer := time.AfterFunc(readTimeout, cancel)
+		defer timer.Stop()
+		return readJob(job, resp.Body, timer)
+	}
 	for _, job := range jobs {
 		ok := processJob(job)
 		if !ok {
@@ -143,6 +159,15 @@ func (d *URLDownloader) Run(client *http.Client, pieces []piece.Piece, multifile
 	}
 }
 
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
 func calcReadSize(buf bufferpool.Buffer, bufPos int, job downloadJob, jobPos int64) int64 {
 	toPieceEnd := int64(len(buf.Data) - bufPos)
 	toResponseEnd := job.Length - jobPos
@@ -0,0 +1,42 @@
+package urldownloader
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/rain/internal/bufferpool"
+	"github.com/cenkalti/rain/internal/filesection"
+	"github.com/cenkalti/rain/internal/piece"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadRenamedFile(t *testing.T) {
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.EscapedPath())
+		w.Header().Set("Content-Range", "bytes 0-3/4")
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer srv.Close()
+
+	pieces := []piece.Piece{{
+		Length: 8,
+		Data: []filesection.FileSection{
+			{Name: "file1", Length: 4},
+			{Name: "file2", Length: 4},
+		},
+	}}
+	d := New(srv.URL, 0, 1)
+	resultC := make(chan interface{}, 1)
+	d.Run(srv.Client(), pieces, true, map[string]string{"file2": "renamed"}, resultC, bufferpool.New(8), time.Second)
+
+	res := (<-resultC).(*PieceResult)
+	if res.Error != nil {
+		t.Fatal(res.Error)
+	}
+	assert.Equal(t, "datadata", string(res.Buffer.Data))
+	assert.Equal(t, []string{"/file1", "/renamed"}, requested)
+}
@@ -2,9 +2,13 @@ package verifier
 
 import (
 	"crypto/sha1"
+	"sync"
+	"time"
 
 	"github.com/cenkalti/rain/internal/bitfield"
 	"github.com/cenkalti/rain/internal/piece"
+	"github.com/cenkalti/rain/internal/semaphore"
+	"github.com/juju/ratelimit"
 )
 
 // Verifier verifies the pieces on disk.
@@ -18,7 +22,23 @@ type Verifier struct {
 
 // Progress information about the verification.
 type Progress struct {
+	// Number of pieces checked so far.
 	Checked uint32
+	// Index of the last checked piece.
+	Index uint32
+	// True if the last checked piece has passed the hash check.
+	OK bool
+}
+
+type job struct {
+	piece *piece.Piece
+	buf   []byte
+}
+
+type result struct {
+	index uint32
+	ok    bool
+	err   error
 }
 
 // New returns a new Verifier.
@@ -35,8 +55,12 @@ func (v *Verifier) Close() {
 	<-v.doneC
 }
 
-// Run and verify all pieces of the torrent.
-func (v *Verifier) Run(pieces []piece.Piece, progressC chan Progress, resultC chan *Verifier) {
+// Run and verify given pieces of the torrent.
+// Pieces may be a subset of all pieces in the torrent. Bitfield is sized to contain the last given piece.
+// Pieces are read from disk in order and hashed by numWorkers goroutines in parallel.
+// Verification does not start until the semaphore is acquired. Semaphore may be nil for no limit.
+// Reading from disk is throttled by the bucket. Bucket may be nil for unlimited speed.
+func (v *Verifier) Run(pieces []piece.Piece, numWorkers int, sem *semaphore.Semaphore, bucket *ratelimit.Bucket, progressC chan Progress, resultC chan *Verifier) {
 	defer close(v.doneC)
 
 	defer func() {
@@ -46,26 +70,107 @@ func (v *Verifier) Run(pieces []piece.Piece, progressC chan Progress, resultC ch
 		}
 	}()
 
-	v.Bitfield = bitfield.New(uint32(len(pieces)))
-	buf := make([]byte, pieces[0].Length)
-	hash := sha1.New()
-	var numOK uint32
-	for _, p := range pieces {
-		buf = buf[:p.Length]
-		_, v.Error = p.Data.ReadAt(buf, 0)
-		if v.Error != nil {
+	if sem != nil {
+		if !sem.WaitCancel(v.closeC) {
 			return
 		}
-		ok := p.VerifyHash(buf, hash)
-		if ok {
-			v.Bitfield.Set(p.Index)
-			numOK++
-		}
+		defer sem.Signal()
+	}
+
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+	v.Bitfield = bitfield.New(pieces[len(pieces)-1].Index + 1)
+
+	// Buffers are reused after the piece is hashed. Their count limits the memory used by the reader.
+	bufC := make(chan []byte, 2*numWorkers)
+	for i := 0; i < cap(bufC); i++ {
+		bufC <- make([]byte, pieces[0].Length)
+	}
+	jobC := make(chan job)
+	resC := make(chan result)
+	stopC := make(chan struct{})
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer close(stopC)
+
+	wg.Add(1)
+	go v.read(pieces, bucket, bufC, jobC, resC, stopC, &wg)
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go v.hash(bufC, jobC, resC, stopC, &wg)
+	}
+
+	for checked := uint32(0); checked < uint32(len(pieces)); {
 		select {
-		case progressC <- Progress{Checked: p.Index + 1}:
+		case res := <-resC:
+			if res.err != nil {
+				v.Error = res.err
+				return
+			}
+			if res.ok {
+				v.Bitfield.Set(res.index)
+			}
+			checked++
+			select {
+			case progressC <- Progress{Checked: checked, Index: res.index, OK: res.ok}:
+			case <-v.closeC:
+				return
+			}
 		case <-v.closeC:
 			return
 		}
+	}
+}
+
+// read pieces from disk sequentially and pass them to the hash workers.
+func (v *Verifier) read(pieces []piece.Piece, bucket *ratelimit.Bucket, bufC chan []byte, jobC chan job, resC chan result, stopC chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer close(jobC)
+	for i := range pieces {
+		p := &pieces[i]
+		if bucket != nil {
+			select {
+			case <-time.After(bucket.Take(int64(p.Length))):
+			case <-stopC:
+				return
+			}
+		}
+		var buf []byte
+		select {
+		case buf = <-bufC:
+		case <-stopC:
+			return
+		}
+		buf = buf[:p.Length]
+		_, err := p.Data.ReadAt(buf, 0)
+		if err != nil {
+			select {
+			case resC <- result{index: p.Index, err: err}:
+			case <-stopC:
+			}
+			return
+		}
+		select {
+		case jobC <- job{piece: p, buf: buf}:
+		case <-stopC:
+			return
+		}
+	}
+}
+
+func (v *Verifier) hash(bufC chan []byte, jobC chan job, resC chan result, stopC chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	hash := sha1.New()
+	for j := range jobC {
+		ok := j.piece.VerifyHash(j.buf, hash)
 		hash.Reset()
+		bufC <- j.buf
+		select {
+		case resC <- result{index: j.piece.Index, ok: ok}:
+		case <-stopC:
+			return
+		}
 	}
 }
@@ -0,0 +1,146 @@
+package verifier
+
+import (
+	"crypto/sha1"
+	"errors"
+	"testing"
+
+	"github.com/cenkalti/rain/internal/filesection"
+	"github.com/cenkalti/rain/internal/piece"
+	"github.com/cenkalti/rain/internal/semaphore"
+)
+
+type memFile []byte
+
+func (f memFile) ReadAt(p []byte, off int64) (int, error) {
+	return copy(p, f[off:]), nil
+}
+
+func (f memFile) WriteAt(p []byte, off int64) (int, error) {
+	return copy(f[off:], p), nil
+}
+
+var errRead = errors.New("read error")
+
+type errFile struct{ memFile }
+
+func (f errFile) ReadAt(p []byte, off int64) (int, error) {
+	return 0, errRead
+}
+
+const pieceLength = 1000
+
+// newPieces returns the pieces of a file with the given length. Pieces in corrupted fail the hash check.
+func newPieces(length int, corrupted ...uint32) []piece.Piece {
+	f := make(memFile, length)
+	for i := range f {
+		f[i] = byte(i)
+	}
+	var pieces []piece.Piece
+	for i := uint32(0); int(i)*pieceLength < length; i++ {
+		off := int(i) * pieceLength
+		n := pieceLength
+		if off+n > length {
+			n = length - off
+		}
+		sum := sha1.Sum(f[off : off+n])
+		pieces = append(pieces, piece.Piece{
+			Index:  i,
+			Length: uint32(n),
+			Data:   filesection.Piece{{File: f, Offset: int64(off), Length: int64(n)}},
+			Hash:   sum[:],
+		})
+	}
+	for _, i := range corrupted {
+		pieces[i].Hash = make([]byte, sha1.Size)
+	}
+	return pieces
+}
+
+func run(pieces []piece.Piece, numWorkers int, sem *semaphore.Semaphore) (*Verifier, []Progress) {
+	v := New()
+	progressC := make(chan Progress)
+	resultC := make(chan *Verifier)
+	go v.Run(pieces, numWorkers, sem, nil, progressC, resultC)
+	var progress []Progress
+	for {
+		select {
+		case p := <-progressC:
+			progress = append(progress, p)
+		case <-resultC:
+			return v, progress
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	pieces := newPieces(10*pieceLength+500, 3, 7)
+	v, progress := run(pieces, 4, semaphore.New(1))
+	if v.Error != nil {
+		t.Fatal(v.Error)
+	}
+	if v.Bitfield.Len() != uint32(len(pieces)) {
+		t.Fatalf("bitfield length: %d", v.Bitfield.Len())
+	}
+	for _, p := range pieces {
+		ok := p.Index != 3 && p.Index != 7
+		if v.Bitfield.Test(p.Index) != ok {
+			t.Errorf("piece #%d: expected %v", p.Index, ok)
+		}
+	}
+	if len(progress) != len(pieces) {
+		t.Fatalf("progress is reported %d times", len(progress))
+	}
+	seen := make(map[uint32]bool)
+	for i, p := range progress {
+		if p.Checked != uint32(i)+1 {
+			t.Errorf("progress #%d: checked %d", i, p.Checked)
+		}
+		if p.OK != v.Bitfield.Test(p.Index) {
+			t.Errorf("progress of piece #%d does not match bitfield", p.Index)
+		}
+		seen[p.Index] = true
+	}
+	if len(seen) != len(pieces) {
+		t.Fatalf("%d pieces are reported", len(seen))
+	}
+}
+
+func TestVerifySubset(t *testing.T) {
+	pieces := newPieces(10 * pieceLength)
+	subset := []piece.Piece{pieces[2], pieces[5]}
+	v, _ := run(subset, 2, nil)
+	if v.Error != nil {
+		t.Fatal(v.Error)
+	}
+	if v.Bitfield.Len() != 6 {
+		t.Fatalf("bitfield length: %d", v.Bitfield.Len())
+	}
+	if v.Bitfield.Count() != 2 || !v.Bitfield.Test(2) || !v.Bitfield.Test(5) {
+		t.Fatalf("unexpected bitfield: %v", v.Bitfield.Bytes())
+	}
+}
+
+func TestVerifyReadError(t *testing.T) {
+	pieces := newPieces(10 * pieceLength)
+	pieces[4].Data[0].File = errFile{}
+	v, progress := run(pieces, 4, nil)
+	if v.Error != errRead {
+		t.Fatalf("unexpected error: %v", v.Error)
+	}
+	if len(progress) > 4 {
+		t.Fatalf("pieces after read error are reported: %d", len(progress))
+	}
+}
+
+func TestCloseWhileWaiting(t *testing.T) {
+	sem := semaphore.New(1)
+	sem.Wait()
+	defer sem.Signal()
+	v := New()
+	go v.Run(newPieces(pieceLength), 1, sem, nil, make(chan Progress), make(chan *Verifier))
+	v.Close()
+	if v.Bitfield != nil {
+		t.Fatal("verification started without acquiring the semaphore")
+	}
+}
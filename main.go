@@ -1,8 +1,12 @@
 package main
 
 import (
+	"crypto"
 	"crypto/sha1"
+	"crypto/x509"
 	"encoding/hex"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -163,6 +167,18 @@ func main() {
 							Name:  "id",
 							Usage: "if id is not given, a unique id is automatically generated",
 						},
+						cli.StringFlag{
+							Name:  "data-dir",
+							Usage: "directory to save torrent files, existing files are verified and seeded in place",
+						},
+						cli.BoolFlag{
+							Name:  "cross-seed",
+							Usage: "reuse files with same content from other torrents instead of downloading",
+						},
+						cli.StringFlag{
+							Name:  "archive",
+							Usage: "seed files from uncompressed tar or zip archive without extracting",
+						},
 					},
 				},
 				{
@@ -175,6 +191,14 @@ func main() {
 							Name:     "id",
 							Required: true,
 						},
+						cli.BoolFlag{
+							Name:  "keep-data",
+							Usage: "do not delete torrent files",
+						},
+						cli.BoolFlag{
+							Name:  "trash",
+							Usage: "move torrent files to trash directory instead of deleting them",
+						},
 					},
 				},
 				{
@@ -211,6 +235,18 @@ func main() {
 						},
 					},
 				},
+				{
+					Name:     "dht-stats",
+					Usage:    "get routing table stats of DHT node",
+					Category: "Getters",
+					Action:   handleDHTStats,
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "json",
+							Usage: "print raw stats as JSON",
+						},
+					},
+				},
 				{
 					Name:     "trackers",
 					Usage:    "get trackers of torrent",
@@ -235,6 +271,18 @@ func main() {
 						},
 					},
 				},
+				{
+					Name:     "cross-seed",
+					Usage:    "get files reused from other torrents when torrent is added",
+					Category: "Getters",
+					Action:   handleCrossSeedResults,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+					},
+				},
 				{
 					Name:     "peers",
 					Usage:    "get peers of torrent",
@@ -305,6 +353,22 @@ func main() {
 						},
 					},
 				},
+				{
+					Name:     "super-seed",
+					Usage:    "enable super-seeding mode",
+					Category: "Actions",
+					Action:   handleSuperSeed,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+						cli.BoolFlag{
+							Name:  "disable",
+							Usage: "disable super-seeding mode",
+						},
+					},
+				},
 				{
 					Name:     "start",
 					Usage:    "start torrent",
@@ -341,6 +405,30 @@ func main() {
 					Category: "Actions",
 					Action:   handleStopAll,
 				},
+				{
+					Name:     "crawl-dht",
+					Usage:    "discover info hashes in DHT and print them",
+					Category: "Actions",
+					Action:   handleCrawlDHT,
+					Flags: []cli.Flag{
+						cli.IntFlag{
+							Name:  "rate",
+							Usage: "number of queries sent per second. default value is taken from server config.",
+						},
+						cli.StringFlag{
+							Name:  "metadata-dir",
+							Usage: "download metadata of discovered torrents and save as .torrent files into this directory on server",
+						},
+						cli.IntFlag{
+							Name:  "count,n",
+							Usage: "stop after discovering this number of info hashes",
+						},
+						cli.DurationFlag{
+							Name:  "duration",
+							Usage: "stop after this duration",
+						},
+					},
+				},
 				{
 					Name:     "move",
 					Usage:    "move torrent to another server",
@@ -358,6 +446,49 @@ func main() {
 						},
 					},
 				},
+				{
+					Name:     "set-location",
+					Usage:    "change the directory of torrent files",
+					Category: "Actions",
+					Action:   handleSetLocation,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+						cli.StringFlag{
+							Name:     "path",
+							Required: true,
+							Usage:    "new directory for torrent files",
+						},
+						cli.BoolFlag{
+							Name:  "move",
+							Usage: "move files to the new directory, otherwise verify the files in the new directory",
+						},
+					},
+				},
+				{
+					Name:     "rename",
+					Usage:    "rename a file or directory of torrent",
+					Category: "Actions",
+					Action:   handleRename,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "id",
+							Required: true,
+						},
+						cli.StringFlag{
+							Name:     "old",
+							Required: true,
+							Usage:    "current path relative to the torrent directory",
+						},
+						cli.StringFlag{
+							Name:     "new",
+							Required: true,
+							Usage:    "new path relative to the torrent directory",
+						},
+					},
+				},
 				{
 					Name:     "torrent",
 					Usage:    "save torrent file",
@@ -486,6 +617,22 @@ func main() {
 							Name:  "webseed,w",
 							Usage: "add webseed `URL`",
 						},
+						cli.BoolFlag{
+							Name:  "align,a",
+							Usage: "insert padding files to align each file to a piece boundary (BEP 47)",
+						},
+						cli.StringFlag{
+							Name:  "sign-key",
+							Usage: "sign torrent with the private key in PEM `FILE` (BEP 35). requires --cert.",
+						},
+						cli.StringFlag{
+							Name:  "cert",
+							Usage: "include the certificate in PEM `FILE` in the signature",
+						},
+						cli.StringFlag{
+							Name:  "sign-identity",
+							Usage: "identity of the signer. common name in the certificate is used by default.",
+						},
 					},
 				},
 			},
@@ -771,8 +918,11 @@ func handleAdd(c *cli.Context) error {
 	var marshalErr error
 	arg := c.String("torrent")
 	addOpt := &rainrpc.AddTorrentOptions{
-		Stopped: c.Bool("stopped"),
-		ID:      c.String("id"),
+		Stopped:   c.Bool("stopped"),
+		ID:        c.String("id"),
+		DataDir:   c.String("data-dir"),
+		CrossSeed: c.Bool("cross-seed"),
+		Archive:   c.String("archive"),
 	}
 	if isURI(arg) {
 		resp, err := clt.AddURI(arg, addOpt)
@@ -801,7 +951,18 @@ func handleAdd(c *cli.Context) error {
 }
 
 func handleRemove(c *cli.Context) error {
-	return clt.RemoveTorrent(c.String("id"))
+	opt := &rainrpc.RemoveTorrentOptions{
+		KeepData:    c.Bool("keep-data"),
+		MoveToTrash: c.Bool("trash"),
+	}
+	resp, err := clt.RemoveTorrentWithOptions(c.String("id"), opt)
+	if err != nil {
+		return err
+	}
+	if resp.DataError != "" {
+		return fmt.Errorf("torrent is removed but its files are not: %s", resp.DataError)
+	}
+	return nil
 }
 
 func handleCleanDatabase(c *cli.Context) error {
@@ -844,6 +1005,74 @@ func handleSessionStats(c *cli.Context) error {
 	return nil
 }
 
+func handleDHTStats(c *cli.Context) error {
+	s, err := clt.GetDHTStats()
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		b, err := prettyjson.Marshal(s)
+		if err != nil {
+			return err
+		}
+		_, _ = os.Stdout.Write(b)
+		_, _ = os.Stdout.WriteString("\n")
+		return nil
+	}
+	console.FormatDHTStats(s, os.Stdout)
+	return nil
+}
+
+func handleCrawlDHT(c *cli.Context) error {
+	err := clt.StartDHTCrawl(c.Int("rate"), c.String("metadata-dir"))
+	if err != nil {
+		return err
+	}
+	var next, count int
+	defer func() {
+		_ = clt.StopDHTCrawl()
+		resp, err := clt.GetDHTCrawlResults(next)
+		if err == nil {
+			s := resp.Stats
+			fmt.Fprintf(os.Stderr, "queried: %d, responded: %d, info hashes: %d, metadata saved: %d, failed: %d, skipped: %d\n",
+				s.NodesQueried, s.NodesResponded, s.InfoHashes, s.MetadataSaved, s.MetadataFailed, s.MetadataSkipped)
+		}
+	}()
+	var timeoutC <-chan time.Time
+	if d := c.Duration("duration"); d > 0 {
+		timeoutC = time.After(d)
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			resp, err := clt.GetDHTCrawlResults(next)
+			if err != nil {
+				return err
+			}
+			for _, ih := range resp.InfoHashes {
+				_, _ = os.Stdout.WriteString(ih)
+				_, _ = os.Stdout.WriteString("\n")
+				count++
+				if n := c.Int("count"); n > 0 && count >= n {
+					return nil
+				}
+			}
+			next = resp.Next
+			if !resp.Stats.Running {
+				return nil
+			}
+		case <-timeoutC:
+			return nil
+		case <-ch:
+			return nil
+		}
+	}
+}
+
 func handleTrackers(c *cli.Context) error {
 	resp, err := clt.GetTorrentTrackers(c.String("id"))
 	if err != nil {
@@ -872,6 +1101,20 @@ func handleWebseeds(c *cli.Context) error {
 	return nil
 }
 
+func handleCrossSeedResults(c *cli.Context) error {
+	resp, err := clt.GetTorrentCrossSeedResults(c.String("id"))
+	if err != nil {
+		return err
+	}
+	b, err := prettyjson.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	_, _ = os.Stdout.Write(b)
+	_, _ = os.Stdout.WriteString("\n")
+	return nil
+}
+
 func handlePeers(c *cli.Context) error {
 	resp, err := clt.GetTorrentPeers(c.String("id"))
 	if err != nil {
@@ -902,6 +1145,10 @@ func handleVerify(c *cli.Context) error {
 	return clt.VerifyTorrent(c.String("id"))
 }
 
+func handleSuperSeed(c *cli.Context) error {
+	return clt.SetTorrentSuperSeeding(c.String("id"), !c.Bool("disable"))
+}
+
 func handleStart(c *cli.Context) error {
 	return clt.StartTorrent(c.String("id"))
 }
@@ -922,6 +1169,14 @@ func handleMove(c *cli.Context) error {
 	return clt.MoveTorrent(c.String("id"), c.String("target"))
 }
 
+func handleSetLocation(c *cli.Context) error {
+	return clt.SetTorrentLocation(c.String("id"), c.String("path"), c.Bool("move"))
+}
+
+func handleRename(c *cli.Context) error {
+	return clt.RenameTorrentPath(c.String("id"), c.String("old"), c.String("new"))
+}
+
 func handleConsole(c *cli.Context) error {
 	columns := strings.Split(c.String("columns"), " ")
 
@@ -946,6 +1201,17 @@ func handleTorrentShow(c *cli.Context) error {
 			info["pieces"] = fmt.Sprintf("<<< %d bytes of data >>>", len(pieces))
 		}
 	}
+	if sigs, ok := val["signatures"].(map[string]interface{}); ok {
+		for _, sig := range sigs {
+			if sig, ok := sig.(map[string]interface{}); ok {
+				for _, key := range []string{"certificate", "signature"} {
+					if b, ok := sig[key].(string); ok {
+						sig[key] = fmt.Sprintf("<<< %d bytes of data >>>", len(b))
+					}
+				}
+			}
+		}
+	}
 	b, err := prettyjson.Marshal(val)
 	if err != nil {
 		return err
@@ -984,6 +1250,10 @@ func handleTorrentCreate(c *cli.Context) error {
 	comment := c.String("comment")
 	trackers := c.StringSlice("tracker")
 	webseeds := c.StringSlice("webseed")
+	align := c.Bool("align")
+	signKey := c.String("sign-key")
+	certFile := c.String("cert")
+	signIdentity := c.String("sign-identity")
 
 	var err error
 	out, err = homedir.Expand(out)
@@ -1002,11 +1272,22 @@ func handleTorrentCreate(c *cli.Context) error {
 		tiers[i] = []string{tr}
 	}
 
-	info, err := metainfo.NewInfoBytes(root, paths, private, uint32(pieceLength<<10), name, log)
+	info, err := metainfo.NewInfoBytes(root, paths, private, uint32(pieceLength<<10), name, align, log)
 	if err != nil {
 		return err
 	}
-	mi, err := metainfo.NewBytes(info, tiers, webseeds, comment)
+	var sigs []metainfo.Signature
+	if signKey != "" {
+		if certFile == "" {
+			return errors.New("--cert is required for signing")
+		}
+		sig, err2 := signInfo(info, signKey, certFile, signIdentity)
+		if err2 != nil {
+			return err2
+		}
+		sigs = append(sigs, *sig)
+	}
+	mi, err := metainfo.NewBytes(info, tiers, webseeds, comment, sigs)
 	if err != nil {
 		return err
 	}
@@ -1022,6 +1303,60 @@ func handleTorrentCreate(c *cli.Context) error {
 	return f.Close()
 }
 
+func signInfo(info []byte, keyFile, certFile, identity string) (*metainfo.Signature, error) {
+	keyFile, err := homedir.Expand(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	certFile, err = homedir.Expand(certFile)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no certificate found in " + certFile)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	b, err = ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ = pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no private key found in " + keyFile)
+	}
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key type")
+	}
+	if identity == "" {
+		identity = cert.Subject.CommonName
+	}
+	if identity == "" {
+		return nil, errors.New("certificate has no common name, --sign-identity is required")
+	}
+	return metainfo.Sign(info, identity, signer, cert)
+}
+
 func handleSaveTorrent(c *cli.Context) error {
 	torrent, err := clt.GetTorrent(c.String("id"))
 	if err != nil {
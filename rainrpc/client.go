@@ -62,6 +62,9 @@ type AddTorrentOptions struct {
 	ID                string
 	Stopped           bool
 	StopAfterDownload bool
+	DataDir           string
+	CrossSeed         bool
+	Archive           string
 }
 
 // AddTorrent adds a new torrent by reading .torrent file.
@@ -75,6 +78,9 @@ func (c *Client) AddTorrent(f io.Reader, options *AddTorrentOptions) (*rpctypes.
 		args.AddTorrentOptions.ID = options.ID
 		args.AddTorrentOptions.Stopped = options.Stopped
 		args.AddTorrentOptions.StopAfterDownload = options.StopAfterDownload
+		args.AddTorrentOptions.DataDir = options.DataDir
+		args.AddTorrentOptions.CrossSeed = options.CrossSeed
+		args.AddTorrentOptions.Archive = options.Archive
 	}
 	var reply rpctypes.AddTorrentResponse
 	return &reply.Torrent, c.client.Call("Session.AddTorrent", args, &reply)
@@ -87,6 +93,9 @@ func (c *Client) AddURI(uri string, options *AddTorrentOptions) (*rpctypes.Torre
 		args.AddTorrentOptions.ID = options.ID
 		args.AddTorrentOptions.Stopped = options.Stopped
 		args.AddTorrentOptions.StopAfterDownload = options.StopAfterDownload
+		args.AddTorrentOptions.DataDir = options.DataDir
+		args.AddTorrentOptions.CrossSeed = options.CrossSeed
+		args.AddTorrentOptions.Archive = options.Archive
 	}
 	var reply rpctypes.AddURIResponse
 	return &reply.Torrent, c.client.Call("Session.AddURI", args, &reply)
@@ -94,9 +103,31 @@ func (c *Client) AddURI(uri string, options *AddTorrentOptions) (*rpctypes.Torre
 
 // RemoveTorrent removes a torrent from remote Session and deletes its data.
 func (c *Client) RemoveTorrent(id string) error {
-	args := rpctypes.RemoveTorrentRequest{ID: id}
+	_, err := c.RemoveTorrentWithOptions(id, nil)
+	return err
+}
+
+// RemoveTorrentOptions contains options for removing a torrent.
+type RemoveTorrentOptions struct {
+	// Keep the files of the torrent on disk.
+	KeepData bool
+	// Move the files of the torrent into trash directory instead of deleting them.
+	MoveToTrash bool
+}
+
+// RemoveTorrentWithOptions removes a torrent from remote Session.
+// If the torrent is removed but its files cannot be deleted or moved, the reason is set in DataError field of the response.
+func (c *Client) RemoveTorrentWithOptions(id string, opt *RemoveTorrentOptions) (*rpctypes.RemoveTorrentResponse, error) {
+	if opt == nil {
+		opt = &RemoveTorrentOptions{}
+	}
+	args := rpctypes.RemoveTorrentRequest{
+		ID:          id,
+		KeepData:    opt.KeepData,
+		MoveToTrash: opt.MoveToTrash,
+	}
 	var reply rpctypes.RemoveTorrentResponse
-	return c.client.Call("Session.RemoveTorrent", args, &reply)
+	return &reply, c.client.Call("Session.RemoveTorrent", args, &reply)
 }
 
 // CleanDatabase removes invalid records in session database.
@@ -120,6 +151,35 @@ func (c *Client) GetSessionStats() (*rpctypes.SessionStats, error) {
 	return &reply.Stats, c.client.Call("Session.GetSessionStats", args, &reply)
 }
 
+// GetDHTStats returns statistics about the routing table of DHT node in remote Session.
+func (c *Client) GetDHTStats() (*rpctypes.DHTStats, error) {
+	args := rpctypes.GetDHTStatsRequest{}
+	var reply rpctypes.GetDHTStatsResponse
+	return &reply.Stats, c.client.Call("Session.GetDHTStats", args, &reply)
+}
+
+// StartDHTCrawl starts discovering info hashes in DHT network with sample_infohashes queries.
+// If metadataDir is not empty, metadata of discovered torrents are saved into this directory on the remote server.
+func (c *Client) StartDHTCrawl(rate int, metadataDir string) error {
+	args := rpctypes.StartDHTCrawlRequest{Rate: rate, MetadataDir: metadataDir}
+	var reply rpctypes.StartDHTCrawlResponse
+	return c.client.Call("Session.StartDHTCrawl", args, &reply)
+}
+
+// StopDHTCrawl stops the DHT crawl in remote Session.
+func (c *Client) StopDHTCrawl() error {
+	args := rpctypes.StopDHTCrawlRequest{}
+	var reply rpctypes.StopDHTCrawlResponse
+	return c.client.Call("Session.StopDHTCrawl", args, &reply)
+}
+
+// GetDHTCrawlResults returns the info hashes discovered by the DHT crawl, starting from the index.
+func (c *Client) GetDHTCrawlResults(from int) (*rpctypes.GetDHTCrawlResultsResponse, error) {
+	args := rpctypes.GetDHTCrawlResultsRequest{From: from}
+	var reply rpctypes.GetDHTCrawlResultsResponse
+	return &reply, c.client.Call("Session.GetDHTCrawlResults", args, &reply)
+}
+
 // GetMagnet returns the torrent as a magnet link.
 func (c *Client) GetMagnet(id string) (string, error) {
 	args := rpctypes.GetMagnetRequest{ID: id}
@@ -160,6 +220,13 @@ func (c *Client) GetTorrentWebseeds(id string) ([]rpctypes.Webseed, error) {
 	return reply.Webseeds, c.client.Call("Session.GetTorrentWebseeds", args, &reply)
 }
 
+// GetTorrentCrossSeedResults returns the files reused from other torrents when the torrent is added.
+func (c *Client) GetTorrentCrossSeedResults(id string) ([]rpctypes.CrossSeedFile, error) {
+	args := rpctypes.GetTorrentCrossSeedResultsRequest{ID: id}
+	var reply rpctypes.GetTorrentCrossSeedResultsResponse
+	return reply.Files, c.client.Call("Session.GetTorrentCrossSeedResults", args, &reply)
+}
+
 // StartTorrent starts the torrent.
 func (c *Client) StartTorrent(id string) error {
 	args := rpctypes.StartTorrentRequest{ID: id}
@@ -189,6 +256,13 @@ func (c *Client) VerifyTorrent(id string) error {
 	return c.client.Call("Session.VerifyTorrent", args, &reply)
 }
 
+// SetTorrentSuperSeeding enables or disables super-seeding mode of the torrent.
+func (c *Client) SetTorrentSuperSeeding(id string, enabled bool) error {
+	args := rpctypes.SetTorrentSuperSeedingRequest{ID: id, Enabled: enabled}
+	var reply rpctypes.SetTorrentSuperSeedingResponse
+	return c.client.Call("Session.SetTorrentSuperSeeding", args, &reply)
+}
+
 // MoveTorrent moves the torrent to another Session.
 func (c *Client) MoveTorrent(id, target string) error {
 	args := rpctypes.MoveTorrentRequest{ID: id, Target: target}
@@ -196,6 +270,22 @@ func (c *Client) MoveTorrent(id, target string) error {
 	return c.client.Call("Session.MoveTorrent", args, &reply)
 }
 
+// SetTorrentLocation changes the directory that the files of the torrent are saved in.
+// If moveData is true, files are moved to the new directory. Otherwise, files at the new directory are verified.
+func (c *Client) SetTorrentLocation(id, path string, moveData bool) error {
+	args := rpctypes.SetTorrentLocationRequest{ID: id, Path: path, MoveData: moveData}
+	var reply rpctypes.SetTorrentLocationResponse
+	return c.client.Call("Session.SetTorrentLocation", args, &reply)
+}
+
+// RenameTorrentPath changes the path of a file or directory in the torrent.
+// Paths are relative to the directory that the files of the torrent are saved in.
+func (c *Client) RenameTorrentPath(id, oldPath, newPath string) error {
+	args := rpctypes.RenameTorrentPathRequest{ID: id, OldPath: oldPath, NewPath: newPath}
+	var reply rpctypes.RenameTorrentPathResponse
+	return c.client.Call("Session.RenameTorrentPath", args, &reply)
+}
+
 // StartAllTorrents starts all torrents in the Session.
 func (c *Client) StartAllTorrents() error {
 	args := rpctypes.StartAllTorrentsRequest{}
@@ -1,6 +1,7 @@
 package torrent
 
 import (
+	"runtime"
 	"time"
 
 	"github.com/cenkalti/rain/internal/metainfo"
@@ -25,12 +26,25 @@ type Config struct {
 	// If true, torrent files are saved into <data_dir>/<torrent_id>/<torrent_name>.
 	// Useful if downloading the same torrent from multiple sources.
 	DataDirIncludesTorrentID bool
+	// Files of removed torrents are moved into this directory if requested.
+	TrashDir string
+	// Files in TrashDir are deleted after this duration.
+	TrashRetention time.Duration
 	// New torrents will be listened at selected port in this range.
 	PortBegin, PortEnd uint16
 	// At start, client will set max open files limit to this number. (like "ulimit -n" command)
 	MaxOpenFiles uint64
+	// Maximum number of data files kept open by all torrents in the session.
+	// Files are reopened when they are accessed again. Zero means no limit.
+	// Files that are being read or written are not closed, so the limit may be exceeded temporarily.
+	MaxOpenDataFiles int
+	// Data files are closed after not being accessed for this duration.
+	DataFileIdleTimeout time.Duration
 	// Enable peer exchange protocol.
 	PEXEnabled bool
+	// Enable tracker exchange protocol. Trackers received from peers are not saved, so they are lost when the session is restarted.
+	// Trackers of private torrents are never exchanged.
+	TEXEnabled bool
 	// Resume data (bitfield & stats) are saved to disk at interval to keep IO lower.
 	ResumeWriteInterval time.Duration
 	// Peer id is prefixed with this string. See BEP 20. Remaining bytes of peer id will be randomized.
@@ -61,6 +75,12 @@ type Config struct {
 	MaxTorrentSize uint
 	// Maximum allowed number of pieces in a torrent.
 	MaxPieces uint32
+	// Paths of PEM files containing the certificates of trusted torrent signers (BEP 35).
+	// A signature is trusted if its certificate is one of these or issued by one of these.
+	TrustedSigners []string
+	// Reject adding torrents that are not signed by a trusted signer.
+	// Magnet links cannot be added because they do not contain signatures.
+	RequireTrustedSigner bool
 	// Time to wait when resolving host names for trackers and peers.
 	DNSResolveTimeout time.Duration
 	// Global download speed limit in KB/s.
@@ -85,12 +105,33 @@ type Config struct {
 	DHTHost string
 	// DHT node will listen on this UDP port.
 	DHTPort uint16
+	// Run a separate IPv6 DHT node on the same port (BEP 32).
+	DHTIPv6Enabled bool
+	// IPv6 DHT node will listen on this IP.
+	DHTHost6 string
+	// Ignore DHT nodes with IDs not derived from their IP addresses (BEP 42).
+	DHTEnforceNodeID bool
 	// DHT announce interval
 	DHTAnnounceInterval time.Duration
 	// Minimum announce interval when announcing to DHT.
 	DHTMinAnnounceInterval time.Duration
 	// Known routers to bootstrap local DHT node.
 	DHTBootstrapNodes []string
+	// Known good DHT nodes are saved to the database at this interval.
+	// Saved nodes are also used for bootstrapping, so DHT node can join the network even if bootstrap nodes are unreachable.
+	DHTNodesSaveInterval time.Duration
+	// Time to wait for responses from DHT nodes when getting or putting items (BEP 44).
+	DHTItemTimeout time.Duration
+	// New versions of torrents added with "xs=urn:btpk:" magnet links are checked in DHT at this interval (BEP 46).
+	DHTUpdateCheckInterval time.Duration
+	// Number of sample_infohashes queries sent per second when crawling DHT (BEP 51).
+	DHTCrawlRate int
+	// Number of most recent info hashes kept in the results of a DHT crawl.
+	DHTCrawlMaxResults int
+	// Number of torrents that metadata is downloaded concurrently while crawling DHT.
+	DHTCrawlMaxMetadataFetches int
+	// Give up downloading the metadata of a torrent discovered by crawling DHT after this duration.
+	DHTCrawlMetadataTimeout time.Duration
 
 	// Number of peer addresses to request in announce request.
 	TrackerNumWant int
@@ -142,6 +183,8 @@ type Config struct {
 	MaxPeerAddresses int
 	// Number of allowed-fast messages to send after handshake.
 	AllowedFastSet int
+	// Maximum number of pieces in read cache that are suggested to an interested peer at once. Set to zero to disable.
+	SuggestPieces int
 
 	// Number of bytes to read when a piece is requested by a peer.
 	ReadCacheBlockSize int64
@@ -153,8 +196,37 @@ type Config struct {
 	ParallelReads uint
 	// Number of write operations to do in parallel.
 	ParallelWrites uint
+	// Storage implementation for torrent data. Must be "file", "mmap", "cas" or "encrypted".
+	// "mmap" maps files into memory and copies data to and from the mapping instead of doing a system call for each read and write.
+	// Pieces are flushed to disk after they are written.
+	// "cas" saves identical files of different torrents only once. Completed files are moved into CASDir and
+	// hard linked from the data directory of the torrent. CASDir must be on the same filesystem with the torrent data.
+	StorageType string
+	// Directory of content-addressed storage. Used when StorageType is "cas".
+	// Files that are not linked from any torrent are deleted when a torrent is removed.
+	CASDir string
+	// Master key for encrypting files when StorageType is "encrypted". Must be 32 bytes encoded in hex.
+	// Each torrent is encrypted with a different key derived from the master key and torrent ID.
+	// If empty, the value of RAIN_ENCRYPTION_KEY environment variable is used.
+	EncryptionKey string
+	// Number of torrents that can be verified at the same time.
+	ParallelVerifications uint
+	// Number of goroutines that calculate piece hashes while verifying a torrent.
+	VerificationWorkers uint
 	// Number of bytes allocated in memory for downloading piece data.
 	WriteCacheSize int64
+	// Downloading is paused when free disk space falls below this number of bytes.
+	// Completed pieces are still seeded while paused. Downloading resumes automatically after space is freed.
+	DiskSpaceLowWaterMark int64
+	// Interval for checking free disk space while downloading.
+	DiskSpaceCheckInterval time.Duration
+	// Check hashes of pieces in background while seeding to detect corrupted data on disk.
+	// Pieces that fail the check are downloaded again.
+	ScrubEnabled bool
+	// Max number of bytes per second read from disk by the scrubber. Shared by all torrents. Zero means unlimited.
+	ScrubSpeedLimit int64
+	// Minimum duration between two full scrub passes of a torrent.
+	ScrubInterval time.Duration
 
 	// When the client want to connect a peer, first it tries to do encrypted handshake.
 	// If it does not work, it connects to same peer again and does unencrypted handshake.
@@ -189,10 +261,15 @@ var DefaultConfig = Config{
 	Database:                               "~/rain/session.db",
 	DataDir:                                "~/rain/data",
 	DataDirIncludesTorrentID:               true,
+	TrashDir:                               "~/rain/trash",
+	TrashRetention:                         7 * 24 * time.Hour,
 	PortBegin:                              50000,
 	PortEnd:                                60000,
 	MaxOpenFiles:                           10240,
+	MaxOpenDataFiles:                       1000,
+	DataFileIdleTimeout:                    5 * time.Minute,
 	PEXEnabled:                             true,
+	TEXEnabled:                             true,
 	ResumeWriteInterval:                    30 * time.Second,
 	PrivatePeerIDPrefix:                    "-RN" + Version + "-",
 	PrivateExtensionHandshakeClientVersion: "Rain " + Version,
@@ -228,6 +305,9 @@ var DefaultConfig = Config{
 	DHTEnabled:             true,
 	DHTHost:                "0.0.0.0",
 	DHTPort:                7246,
+	DHTIPv6Enabled:         true,
+	DHTHost6:               "::",
+	DHTEnforceNodeID:       true,
 	DHTAnnounceInterval:    30 * time.Minute,
 	DHTMinAnnounceInterval: time.Minute,
 	DHTBootstrapNodes: []string{
@@ -237,6 +317,13 @@ var DefaultConfig = Config{
 		"dht.libtorrent.org:25401",
 		"dht.aelitis.com:6881",
 	},
+	DHTNodesSaveInterval:       5 * time.Minute,
+	DHTItemTimeout:             10 * time.Second,
+	DHTUpdateCheckInterval:     time.Hour,
+	DHTCrawlRate:               10,
+	DHTCrawlMaxResults:         100000,
+	DHTCrawlMaxMetadataFetches: 10,
+	DHTCrawlMetadataTimeout:    2 * time.Minute,
 
 	// Peer
 	UnchokedPeers:                3,
@@ -254,6 +341,7 @@ var DefaultConfig = Config{
 	PieceReadTimeout:             30 * time.Second,
 	MaxPeerAddresses:             2000,
 	AllowedFastSet:               10,
+	SuggestPieces:                4,
 
 	// IO
 	ReadCacheBlockSize: 128 << 10,
@@ -262,6 +350,17 @@ var DefaultConfig = Config{
 	ParallelReads:      1,
 	ParallelWrites:     1,
 	WriteCacheSize:     1 << 30,
+	StorageType:        "file",
+	CASDir:             "~/rain/cas",
+
+	ParallelVerifications: 2,
+	VerificationWorkers:   uint(runtime.NumCPU()),
+
+	DiskSpaceLowWaterMark:  100 << 20,
+	DiskSpaceCheckInterval: 10 * time.Second,
+
+	ScrubSpeedLimit: 1 << 20,
+	ScrubInterval:   30 * 24 * time.Hour,
 
 	// Webseed settings
 	WebseedDialTimeout:             10 * time.Second,
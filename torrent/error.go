@@ -4,7 +4,7 @@ import (
 	"github.com/cenkalti/rain/internal/announcer"
 )
 
-// InputError is returned from Session.AddTorrent and Session.AddURI methods when there is problem with the input.
+// InputError is returned from Session.AddTorrent, Session.AddURI and Session.RemoveTorrentWithOptions methods when there is problem with the input.
 type InputError struct {
 	err error
 }
@@ -25,6 +25,28 @@ func (e *InputError) Unwrap() error {
 	return e.err
 }
 
+// DataError is returned from Session.RemoveTorrentWithOptions when the torrent is removed from the session
+// but its files cannot be deleted or moved to trash.
+type DataError struct {
+	err error
+}
+
+func newDataError(err error) *DataError {
+	return &DataError{
+		err: err,
+	}
+}
+
+// Error implements error interface.
+func (e *DataError) Error() string {
+	return "data error: " + e.err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *DataError) Unwrap() error {
+	return e.err
+}
+
 // AnnounceError is the error returned from announce response to a tracker.
 type AnnounceError struct {
 	err *announcer.AnnounceError
@@ -0,0 +1,27 @@
+package torrent
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflink clones src to target that shares the same blocks on disk on copy-on-write filesystems.
+func reflink(src, target string) error {
+	sf, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+	tf, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		return err
+	}
+	err = unix.IoctlFileClone(int(tf.Fd()), int(sf.Fd()))
+	if err != nil {
+		tf.Close()
+		os.Remove(target)
+		return err
+	}
+	return tf.Close()
+}
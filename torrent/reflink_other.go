@@ -0,0 +1,7 @@
+// +build !linux
+
+package torrent
+
+func reflink(src, target string) error {
+	return errReflink
+}
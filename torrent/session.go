@@ -4,6 +4,7 @@ package torrent
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"net"
 	"net/http"
@@ -15,17 +16,24 @@ import (
 
 	"github.com/cenkalti/rain/internal/bitfield"
 	"github.com/cenkalti/rain/internal/blocklist"
+	"github.com/cenkalti/rain/internal/dht"
+	"github.com/cenkalti/rain/internal/filepool"
 	"github.com/cenkalti/rain/internal/logger"
 	"github.com/cenkalti/rain/internal/piececache"
 	"github.com/cenkalti/rain/internal/resolver"
 	"github.com/cenkalti/rain/internal/resourcemanager"
 	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
 	"github.com/cenkalti/rain/internal/semaphore"
+	"github.com/cenkalti/rain/internal/storage"
+	"github.com/cenkalti/rain/internal/storage/archivestorage"
+	"github.com/cenkalti/rain/internal/storage/casstorage"
+	"github.com/cenkalti/rain/internal/storage/cryptstorage"
+	"github.com/cenkalti/rain/internal/storage/filestorage"
+	"github.com/cenkalti/rain/internal/storage/mmapstorage"
 	"github.com/cenkalti/rain/internal/tracker"
 	"github.com/cenkalti/rain/internal/trackermanager"
 	"github.com/juju/ratelimit"
 	"github.com/mitchellh/go-homedir"
-	"github.com/nictuku/dht"
 	"go.etcd.io/bbolt"
 )
 
@@ -35,6 +43,9 @@ var (
 	blocklistKey          = []byte("blocklist")
 	blocklistTimestampKey = []byte("blocklist-timestamp")
 	blocklistURLHashKey   = []byte("blocklist-url-hash")
+	dhtNodeIDKey          = []byte("dht-node-id")
+	dhtNodeID6Key         = []byte("dht-node-id6")
+	dhtNodesKey           = []byte("dht-nodes")
 )
 
 // Session contains torrents, DHT node, caches and other data structures shared by multiple torrents.
@@ -49,12 +60,18 @@ type Session struct {
 	trackerManager *trackermanager.TrackerManager
 	ram            *resourcemanager.ResourceManager
 	pieceCache     *piececache.Cache
+	filePool       *filepool.Pool
+	casStore       *casstorage.Store
+	encryptionKey  []byte
+	trustedSigners *x509.CertPool
 	webseedClient  http.Client
 	createdAt      time.Time
 	semWrite       *semaphore.Semaphore
+	semVerify      *semaphore.Semaphore
 	metrics        *sessionMetrics
 	bucketDownload *ratelimit.Bucket
 	bucketUpload   *ratelimit.Bucket
+	bucketScrub    *ratelimit.Bucket
 	closeC         chan struct{}
 
 	mPeerRequests   sync.Mutex
@@ -65,6 +82,12 @@ type Session struct {
 	torrentsByInfoHash map[dht.InfoHash][]*Torrent
 	invalidTorrentIDs  []string
 
+	mDHTCrawl sync.Mutex
+	dhtCrawl  *dhtCrawl
+
+	mMetadataFetches sync.Mutex
+	metadataFetches  map[dht.InfoHash][]*metadataFetch
+
 	mPorts         sync.RWMutex
 	availablePorts map[int]struct{}
 
@@ -79,6 +102,17 @@ func NewSession(cfg Config) (*Session, error) {
 	if cfg.PortBegin >= cfg.PortEnd {
 		return nil, errors.New("invalid port range")
 	}
+	switch cfg.StorageType {
+	case "file", "mmap", "cas", "encrypted":
+	default:
+		return nil, errors.New("invalid storage type: " + cfg.StorageType)
+	}
+	if cfg.ParallelVerifications == 0 {
+		return nil, errors.New("parallel verifications must be at least 1")
+	}
+	if cfg.VerificationWorkers == 0 {
+		return nil, errors.New("verification workers must be at least 1")
+	}
 	if cfg.MaxOpenFiles > 0 {
 		err := setNoFile(cfg.MaxOpenFiles)
 		if err != nil {
@@ -94,6 +128,32 @@ func NewSession(cfg Config) (*Session, error) {
 	if err != nil {
 		return nil, err
 	}
+	cfg.TrashDir, err = homedir.Expand(cfg.TrashDir)
+	if err != nil {
+		return nil, err
+	}
+	var encryptionKey []byte
+	if cfg.StorageType == "encrypted" {
+		encryptionKey, err = parseEncryptionKey(cfg.EncryptionKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	trustedSigners, err := loadTrustedSigners(cfg.TrustedSigners)
+	if err != nil {
+		return nil, err
+	}
+	var casStore *casstorage.Store
+	if cfg.StorageType == "cas" {
+		cfg.CASDir, err = homedir.Expand(cfg.CASDir)
+		if err != nil {
+			return nil, err
+		}
+		casStore, err = casstorage.NewStore(cfg.CASDir)
+		if err != nil {
+			return nil, err
+		}
+	}
 	err = os.MkdirAll(filepath.Dir(cfg.Database), 0750)
 	if err != nil {
 		return nil, err
@@ -136,14 +196,24 @@ func NewSession(cfg Config) (*Session, error) {
 	if cfg.DHTEnabled {
 		dhtConfig := dht.NewConfig()
 		dhtConfig.Address = cfg.DHTHost
+		dhtConfig.Address6 = cfg.DHTHost6
+		dhtConfig.IPv6 = cfg.DHTIPv6Enabled
 		dhtConfig.Port = int(cfg.DHTPort)
 		dhtConfig.DHTRouters = strings.Join(cfg.DHTBootstrapNodes, ",")
-		dhtConfig.SaveRoutingTable = false
 		dhtConfig.NumTargetPeers = 0
+		dhtConfig.EnforceNodeID = cfg.DHTEnforceNodeID
+		dhtConfig.NodeID, dhtConfig.NodeID6, dhtConfig.Nodes, err = loadDHTNodes(db)
+		if err != nil {
+			return nil, err
+		}
 		dhtNode, err = dht.New(dhtConfig)
 		if err != nil {
 			return nil, err
 		}
+		err = saveDHTNodeIDs(db, dhtNode)
+		if err != nil {
+			return nil, err
+		}
 		err = dhtNode.Start()
 		if err != nil {
 			return nil, err
@@ -168,12 +238,18 @@ func NewSession(cfg Config) (*Session, error) {
 		log:                l,
 		torrents:           make(map[string]*Torrent),
 		torrentsByInfoHash: make(map[dht.InfoHash][]*Torrent),
+		metadataFetches:    make(map[dht.InfoHash][]*metadataFetch),
 		availablePorts:     ports,
 		dht:                dhtNode,
 		pieceCache:         piececache.New(cfg.ReadCacheSize, cfg.ReadCacheTTL, cfg.ParallelReads),
+		filePool:           filepool.New(cfg.MaxOpenDataFiles, cfg.DataFileIdleTimeout),
+		casStore:           casStore,
+		encryptionKey:      encryptionKey,
+		trustedSigners:     trustedSigners,
 		ram:                resourcemanager.New(cfg.WriteCacheSize),
 		createdAt:          time.Now(),
 		semWrite:           semaphore.New(int(cfg.ParallelWrites)),
+		semVerify:          semaphore.New(int(cfg.ParallelVerifications)),
 		closeC:             make(chan struct{}),
 		webseedClient: http.Client{
 			Transport: &http.Transport{
@@ -200,6 +276,9 @@ func NewSession(cfg Config) (*Session, error) {
 	if cfg.SpeedLimitUpload > 0 {
 		c.bucketUpload = ratelimit.NewBucketWithRate(float64(cfg.SpeedLimitUpload), cfg.SpeedLimitUpload)
 	}
+	if cfg.ScrubSpeedLimit > 0 {
+		c.bucketScrub = ratelimit.NewBucketWithRate(float64(cfg.ScrubSpeedLimit), cfg.ScrubSpeedLimit)
+	}
 	err = c.startBlocklistReloader()
 	if err != nil {
 		return nil, err
@@ -225,8 +304,11 @@ func NewSession(cfg Config) (*Session, error) {
 	}
 	if cfg.DHTEnabled {
 		go c.processDHTResults()
+		go c.checkUpdatableTorrentsLoop()
 	}
 	go c.updateStatsLoop()
+	go c.emptyTrashLoop()
+	go c.collectGarbage()
 	return c, nil
 }
 
@@ -261,6 +343,8 @@ func (s *Session) Close() error {
 	close(s.closeC)
 
 	if s.config.DHTEnabled {
+		s.stopDHTCrawl()
+		s.saveDHTNodes()
 		s.dht.Stop()
 	}
 
@@ -288,6 +372,7 @@ func (s *Session) Close() error {
 
 	s.ram.Close()
 	s.pieceCache.Close()
+	s.filePool.Close()
 	s.metrics.Close()
 	return s.db.Close()
 }
@@ -336,6 +421,48 @@ func (s *Session) RemoveTorrent(id string) error {
 	return err
 }
 
+var errKeepDataAndTrash = errors.New("files cannot be both kept and moved to trash")
+
+// RemoveTorrentOptions contains options for removing a torrent.
+type RemoveTorrentOptions struct {
+	// Keep the files of the torrent on disk.
+	KeepData bool
+	// Move the files of the torrent into Config.TrashDir instead of deleting them.
+	// Files in trash are deleted after Config.TrashRetention.
+	MoveToTrash bool
+}
+
+// RemoveTorrentWithOptions removes the torrent from the session.
+// Unlike RemoveTorrent, it waits until the files of the torrent are deleted or moved.
+// If the torrent is removed but its files cannot be deleted or moved, a *DataError is returned.
+// An *InputError is returned if both KeepData and MoveToTrash are set.
+// Nil value can be passed as opt for default options.
+func (s *Session) RemoveTorrentWithOptions(id string, opt *RemoveTorrentOptions) error {
+	if opt == nil {
+		opt = &RemoveTorrentOptions{}
+	}
+	if opt.KeepData && opt.MoveToTrash {
+		return newInputError(errKeepDataAndTrash)
+	}
+	t, err := s.removeTorrentFromClient(id)
+	if t == nil {
+		return err
+	}
+	var err2 error
+	switch {
+	case opt.KeepData:
+		s.stopTorrent(t)
+	case opt.MoveToTrash:
+		err2 = s.stopAndTrashData(t)
+	default:
+		err2 = s.stopAndRemoveData(t)
+	}
+	if err2 != nil {
+		return newDataError(err2)
+	}
+	return err
+}
+
 func (s *Session) removeTorrentFromClient(id string) (*Torrent, error) {
 	s.mTorrents.Lock()
 	defer s.mTorrents.Unlock()
@@ -365,22 +492,86 @@ func (s *Session) removeTorrentFromClient(id string) (*Torrent, error) {
 	})
 }
 
-func (s *Session) stopAndRemoveData(t *Torrent) error {
+// dataDir returns the default directory for saving the files of the torrent with id.
+func (s *Session) dataDir(id string) string {
+	if s.config.DataDirIncludesTorrentID {
+		return filepath.Join(s.config.DataDir, id)
+	}
+	return s.config.DataDir
+}
+
+// newStorage returns the Storage implementation selected in Config for saving files under dest.
+func (s *Session) newStorage(id, dest string) (storage.Storage, error) {
+	var sto storage.Storage
+	var err error
+	switch s.config.StorageType {
+	case "mmap":
+		sto, err = mmapstorage.New(dest)
+	case "cas":
+		sto, err = casstorage.New(dest, s.casStore)
+	case "encrypted":
+		var key []byte
+		key, err = deriveTorrentKey(s.encryptionKey, id)
+		if err != nil {
+			return nil, err
+		}
+		sto, err = cryptstorage.New(dest, key)
+	default:
+		sto, err = filestorage.New(dest)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.filePool.Wrap(sto), nil
+}
+
+// newArchiveStorage returns a read-only Storage for seeding the files in the archive at path.
+func (s *Session) newArchiveStorage(path string) (storage.Storage, error) {
+	sto, err := archivestorage.New(path)
+	if err != nil {
+		return nil, err
+	}
+	return s.filePool.Wrap(sto), nil
+}
+
+func (s *Session) stopTorrent(t *Torrent) {
 	t.torrent.Close()
 	s.releasePort(t.torrent.port)
-	var err error
-	var dest string
-	if s.config.DataDirIncludesTorrentID {
-		dest = filepath.Join(s.config.DataDir, t.torrent.id)
+}
+
+// torrentDataPaths returns the paths that contain only the files of the torrent.
+// Returns nil if torrent has no files yet.
+func (s *Session) torrentDataPaths(t *Torrent) []string {
+	if t.torrent.archive != "" {
+		// Archive is not owned by the torrent.
+		return nil
+	}
+	root := t.torrent.storage.RootDir()
+	if defaultDir, _ := filepath.Abs(s.dataDir(t.torrent.id)); s.config.DataDirIncludesTorrentID && root == defaultDir {
+		// Directory belongs to the torrent only.
+		return []string{root}
 	} else if t.torrent.info != nil {
-		dest = t.torrent.info.Name
+		// Directory may be shared with other files. Remove only the files of the torrent.
+		var paths []string
+		for _, name := range t.torrent.topLevelPaths() {
+			paths = append(paths, filepath.Join(root, name))
+		}
+		return paths
 	}
-	if dest != "" {
-		err = os.RemoveAll(dest)
-		if err != nil {
-			s.log.Errorf("cannot remove torrent data. err: %s dest: %s", err, dest)
+	return nil
+}
+
+func (s *Session) stopAndRemoveData(t *Torrent) error {
+	s.stopTorrent(t)
+	var err error
+	for _, dest := range s.torrentDataPaths(t) {
+		err2 := os.RemoveAll(dest)
+		if err2 != nil {
+			s.log.Errorf("cannot remove torrent data. err: %s dest: %s", err2, dest)
+			err = err2
 		}
 	}
+	s.collectGarbage()
 	return err
 }
 
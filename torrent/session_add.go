@@ -7,18 +7,17 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/cenkalti/rain/internal/dht"
 	"github.com/cenkalti/rain/internal/magnet"
 	"github.com/cenkalti/rain/internal/metainfo"
 	"github.com/cenkalti/rain/internal/resumer"
 	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
-	"github.com/cenkalti/rain/internal/storage/filestorage"
+	"github.com/cenkalti/rain/internal/storage"
 	"github.com/cenkalti/rain/internal/webseedsource"
 	"github.com/gofrs/uuid"
-	"github.com/nictuku/dht"
 )
 
 // AddTorrentOptions contains options for adding a new torrent.
@@ -30,8 +29,25 @@ type AddTorrentOptions struct {
 	Stopped bool
 	// Stop torrent after all pieces are downloaded.
 	StopAfterDownload bool
+	// Directory to save the files of the torrent. If empty, the directory is derived from Config.
+	// Files that already exist in the directory are verified at start and seeded in place.
+	DataDir string
+	// Search the files of the torrent in other torrents of the Session and reuse their data instead of downloading.
+	// Only works when the torrent is added with its metadata, i.e. not from a magnet link.
+	// Files are reused in background before the files of the torrent are allocated.
+	// Results are returned by Torrent.CrossSeedResults.
+	CrossSeed bool
+	// Path of an uncompressed tar file or a zip file with stored members to seed the files from.
+	// Files are read from the archive without extracting. Torrent cannot download when it is seeded from an archive.
+	// DataDir is ignored if Archive is given. Archive cannot be used with magnet links or CrossSeed option.
+	Archive string
 }
 
+var (
+	errArchiveMagnet    = errors.New("torrent cannot be seeded from an archive without metadata")
+	errArchiveCrossSeed = errors.New("files in an archive cannot be cross-seeded")
+)
+
 // AddTorrent adds a new torrent to the session by reading .torrent metainfo from reader.
 // Nil value can be passed as opt for default options.
 func (s *Session) AddTorrent(r io.Reader, opt *AddTorrentOptions) (*Torrent, error) {
@@ -60,11 +76,28 @@ func (s *Session) parseMetaInfo(r io.Reader) (*metainfo.MetaInfo, error) {
 }
 
 func (s *Session) addTorrentStopped(r io.Reader, opt *AddTorrentOptions) (*Torrent, error) {
+	if opt.CrossSeed && s.config.StorageType == "encrypted" {
+		return nil, newInputError(errCrossSeedEncrypted)
+	}
+	if opt.CrossSeed && opt.Archive != "" {
+		return nil, newInputError(errArchiveCrossSeed)
+	}
 	r = io.LimitReader(r, int64(s.config.MaxTorrentSize))
 	mi, err := s.parseMetaInfo(r)
 	if err != nil {
 		return nil, newInputError(err)
 	}
+	signer, err := s.verifySignatures(mi.Info.Bytes, mi.Signatures)
+	if err != nil {
+		return nil, newInputError(err)
+	}
+	var signatures []byte
+	if len(mi.Signatures) > 0 {
+		signatures, err = metainfo.EncodeSignatures(mi.Signatures)
+		if err != nil {
+			return nil, err
+		}
+	}
 	id, port, sto, err := s.add(opt)
 	if err != nil {
 		return nil, err
@@ -108,11 +141,23 @@ func (s *Session) addTorrentStopped(r io.Reader, opt *AddTorrentOptions) (*Torre
 		Info:              mi.Info.Bytes,
 		AddedAt:           t.addedAt,
 		StopAfterDownload: opt.StopAfterDownload,
+		Signatures:        signatures,
+	}
+	if opt.Archive != "" {
+		rspec.Archive = sto.RootDir()
+	} else if opt.DataDir != "" {
+		rspec.Dest = sto.RootDir()
 	}
 	err = s.resumer.Write(id, rspec)
 	if err != nil {
 		return nil, err
 	}
+	t.archive = rspec.Archive
+	t.signatures = mi.Signatures
+	t.signer = signer
+	if opt.CrossSeed {
+		t.startCrossSeed()
+	}
 	t2 := s.insertTorrent(t)
 	return t2, nil
 }
@@ -171,10 +216,28 @@ func (s *Session) addURL(u string, opt *AddTorrentOptions) (*Torrent, error) {
 }
 
 func (s *Session) addMagnet(link string, opt *AddTorrentOptions) (*Torrent, error) {
+	if s.config.RequireTrustedSigner {
+		return nil, newInputError(errUntrustedTorrent)
+	}
 	ma, err := magnet.New(link)
 	if err != nil {
 		return nil, newInputError(err)
 	}
+	var seq int64
+	if ma.PublicKey != nil && ma.InfoHash == [20]byte{} {
+		ma.InfoHash, seq, err = s.resolveUpdatableTorrent(ma.PublicKey, ma.Salt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s.addParsedMagnet(ma, seq, opt)
+}
+
+func (s *Session) addParsedMagnet(ma *magnet.Magnet, seq int64, opt *AddTorrentOptions) (*Torrent, error) {
+	// Files in archive cannot be checked until metadata is downloaded and the torrent cannot download into an archive.
+	if opt.Archive != "" {
+		return nil, newInputError(errArchiveMagnet)
+	}
 	id, port, sto, err := s.add(opt)
 	if err != nil {
 		return nil, err
@@ -217,11 +280,20 @@ func (s *Session) addMagnet(link string, opt *AddTorrentOptions) (*Torrent, erro
 		FixedPeers:        ma.Peers,
 		AddedAt:           t.addedAt,
 		StopAfterDownload: opt.StopAfterDownload,
+		PublicKey:         ma.PublicKey,
+		Salt:              ma.Salt,
+		Seq:               seq,
+	}
+	if opt.DataDir != "" {
+		rspec.Dest = sto.RootDir()
 	}
 	err = s.resumer.Write(id, rspec)
 	if err != nil {
 		return nil, err
 	}
+	t.publicKey = ma.PublicKey
+	t.salt = ma.Salt
+	t.seq = seq
 	t2 := s.insertTorrent(t)
 	if !opt.Stopped {
 		err = t2.Start()
@@ -229,7 +301,7 @@ func (s *Session) addMagnet(link string, opt *AddTorrentOptions) (*Torrent, erro
 	return t2, err
 }
 
-func (s *Session) add(opt *AddTorrentOptions) (id string, port int, sto *filestorage.FileStorage, err error) {
+func (s *Session) add(opt *AddTorrentOptions) (id string, port int, sto storage.Storage, err error) {
 	port, err = s.getPort()
 	if err != nil {
 		return
@@ -259,13 +331,15 @@ func (s *Session) add(opt *AddTorrentOptions) (id string, port int, sto *filesto
 		}
 		id = base64.RawURLEncoding.EncodeToString(u1[:])
 	}
-	var dest string
-	if s.config.DataDirIncludesTorrentID {
-		dest = filepath.Join(s.config.DataDir, id)
-	} else {
-		dest = s.config.DataDir
+	if opt.Archive != "" {
+		sto, err = s.newArchiveStorage(opt.Archive)
+		return
+	}
+	dest := opt.DataDir
+	if dest == "" {
+		dest = s.dataDir(id)
 	}
-	sto, err = filestorage.New(dest)
+	sto, err = s.newStorage(id, dest)
 	if err != nil {
 		return
 	}
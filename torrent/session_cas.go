@@ -0,0 +1,71 @@
+package torrent
+
+import (
+	"path/filepath"
+)
+
+// collectGarbage removes the files in content-addressed storage that are not used by any torrent.
+func (s *Session) collectGarbage() {
+	if s.casStore == nil {
+		return
+	}
+	freed, err := s.casStore.GC()
+	if err != nil {
+		s.log.Errorf("cannot collect garbage in content-addressed storage: %s", err)
+	}
+	if freed > 0 {
+		s.log.Infof("removed %d bytes of unused files from content-addressed storage", freed)
+	}
+}
+
+// sealFiles moves the completed files of the torrent into content-addressed storage in background.
+func (t *torrent) sealFiles() {
+	store := t.session.casStore
+	if store == nil || t.archive != "" {
+		return
+	}
+	var paths []string
+	root := t.storage.RootDir()
+	for _, f := range t.diskFiles() {
+		if f.Stored() && f.Length > 0 {
+			paths = append(paths, filepath.Join(root, f.Path))
+		}
+	}
+	go func() {
+		for _, path := range paths {
+			err := store.Seal(path)
+			if err != nil {
+				t.log.Errorf("cannot move file to content-addressed storage: %s", err)
+			}
+		}
+	}()
+}
+
+// unsealPiece removes the objects of the files containing a corrupted piece from content-addressed storage in background,
+// so other torrents do not link to the corrupted content. Files are sealed again when the torrent completes.
+func (t *torrent) unsealPiece(i uint32) {
+	store := t.session.casStore
+	if store == nil || t.archive != "" {
+		return
+	}
+	names := make(map[string]struct{})
+	for _, sec := range t.pieces[i].Data {
+		names[sec.Name] = struct{}{}
+	}
+	var paths []string
+	root := t.storage.RootDir()
+	for j, f := range t.diskFiles() {
+		// Sections of pieces are named with the paths in torrent.
+		if _, ok := names[t.info.Files[j].Path]; ok && f.Stored() {
+			paths = append(paths, filepath.Join(root, f.Path))
+		}
+	}
+	go func() {
+		for _, path := range paths {
+			err := store.Unseal(path)
+			if err != nil {
+				t.log.Errorf("cannot remove file from content-addressed storage: %s", err)
+			}
+		}
+	}()
+}
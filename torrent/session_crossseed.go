@@ -0,0 +1,245 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/cenkalti/rain/internal/metainfo"
+)
+
+// Maximum number of pieces to check before reusing a file.
+// All pieces are verified again when the torrent is started.
+const crossSeedCheckPieces = 8
+
+// CrossSeedMethod is the way that the data of a file is reused from another torrent.
+type CrossSeedMethod string
+
+// Methods for reusing the files, in the order they are tried.
+const (
+	CrossSeedHardlink CrossSeedMethod = "hardlink"
+	CrossSeedReflink  CrossSeedMethod = "reflink"
+	CrossSeedCopy     CrossSeedMethod = "copy"
+)
+
+var (
+	errNoMatchingFile = errors.New("no matching file in other torrents")
+	errReflink        = errors.New("reflink is not supported")
+	// Files in encrypted storage cannot be checked or reused by another torrent because each torrent has a different key.
+	errCrossSeedEncrypted = errors.New("cross-seeding is not supported with encrypted storage")
+)
+
+// CrossSeedFile is the result of searching the data of a file in other torrents of the Session.
+type CrossSeedFile struct {
+	// Path of the file relative to the data directory of the torrent.
+	Path string
+	// Absolute path of the file that the data is taken from. Empty if no file is reused.
+	Source string
+	// Torrent that the source file belongs to.
+	SourceTorrent string
+	// How the data is reused. Empty if no file is reused.
+	Method CrossSeedMethod
+	// Reason why the file is not reused.
+	Error error
+}
+
+type crossSeedSource struct {
+	completedFile
+	torrentID string
+}
+
+// crossSeed searches the files in info among the completed files of other torrents and puts them in root directory.
+// Files that already exist in root are not touched. Search is stopped when closeC is closed.
+func (s *Session) crossSeed(id string, info *metainfo.Info, root string, closeC chan struct{}) []CrossSeedFile {
+	s.mTorrents.RLock()
+	torrents := make([]*Torrent, 0, len(s.torrents))
+	for _, t := range s.torrents {
+		if t.torrent.id != id {
+			torrents = append(torrents, t)
+		}
+	}
+	s.mTorrents.RUnlock()
+
+	sources := make(map[int64][]crossSeedSource)
+	for _, t := range torrents {
+		for _, f := range t.torrent.CompletedFiles() {
+			sources[f.Length] = append(sources[f.Length], crossSeedSource{completedFile: f, torrentID: t.torrent.id})
+		}
+	}
+
+	var results []CrossSeedFile
+	var offset int64
+	for i := range info.Files {
+		f := &info.Files[i]
+		begin := offset
+		offset += f.Length
+		if !f.Stored() || f.Length == 0 {
+			continue
+		}
+		select {
+		case <-closeC:
+			return results
+		default:
+		}
+		res := CrossSeedFile{Path: f.Path}
+		target := filepath.Join(root, f.Path)
+		if _, err := os.Lstat(target); err == nil {
+			res.Error = os.ErrExist
+			results = append(results, res)
+			continue
+		}
+		res.Error = errNoMatchingFile
+		for _, src := range sources[f.Length] {
+			ok, verified, err := matchFile(info, i, begin, src.Path)
+			if err != nil {
+				s.log.Debugln("cannot check file for cross-seeding:", err)
+				continue
+			}
+			if !ok {
+				continue
+			}
+			res.Source = src.Path
+			res.SourceTorrent = src.torrentID
+			res.Method, res.Error = reuseFile(src.Path, target, verified)
+			break
+		}
+		if res.Error == nil {
+			s.log.Infof("reused file %q from torrent %s with %s", f.Path, res.SourceTorrent, res.Method)
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// matchFile checks if the file at path has the content of the file at index in info.
+// Pieces that are completely inside the file, including the padding files after it, are compared with piece hashes.
+// If all of the content is covered by the checked pieces or the file hash, the file is verified.
+// Files that cannot be checked with any hash do not match.
+func matchFile(info *metainfo.Info, index int, offset int64, path string) (ok, verified bool, err error) {
+	f := &info.Files[index]
+	end := offset + f.Length
+	// Data of padding files and symlinks are known to be zeros, so pieces that contain them can be checked too.
+	padEnd := end
+	for j := index + 1; j < len(info.Files) && !info.Files[j].Stored(); j++ {
+		padEnd += info.Files[j].Length
+	}
+	pieceLength := int64(info.PieceLength)
+	first := (offset + pieceLength - 1) / pieceLength
+	last := padEnd/pieceLength - 1
+	if padEnd == info.Length {
+		// Last piece may be shorter.
+		last = int64(info.NumPieces) - 1
+	}
+	if first > last {
+		if f.SHA1 == nil {
+			return false, false, nil
+		}
+		ok, err = matchFileHash(f.SHA1, path)
+		return ok, ok, err
+	}
+	of, err := os.Open(path)
+	if err != nil {
+		return false, false, err
+	}
+	defer of.Close()
+	covered := offset%pieceLength == 0 && (padEnd%pieceLength == 0 || padEnd == info.Length)
+	step := (last - first + crossSeedCheckPieces) / crossSeedCheckPieces
+	if covered {
+		// Check all pieces so that the file can be linked without waiting for verification.
+		step = 1
+	}
+	buf := make([]byte, pieceLength)
+	for i := first; i <= last; i += step {
+		begin := i * pieceLength
+		pieceEnd := begin + pieceLength
+		if pieceEnd > info.Length {
+			pieceEnd = info.Length
+		}
+		b := buf[:pieceEnd-begin]
+		n := end - begin
+		if n > int64(len(b)) {
+			n = int64(len(b))
+		} else if n < 0 {
+			n = 0
+		}
+		_, err = of.ReadAt(b[:n], begin-offset)
+		if err != nil {
+			return false, false, err
+		}
+		for j := n; j < int64(len(b)); j++ {
+			b[j] = 0
+		}
+		sum := sha1.Sum(b)
+		if !bytes.Equal(sum[:], info.PieceHash(uint32(i))) {
+			return false, false, nil
+		}
+	}
+	if covered {
+		return true, true, nil
+	}
+	if f.SHA1 != nil {
+		ok, err = matchFileHash(f.SHA1, path)
+		return ok, ok, err
+	}
+	return true, false, nil
+}
+
+func matchFileHash(sum []byte, path string) (bool, error) {
+	of, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer of.Close()
+	h := sha1.New()
+	_, err = io.Copy(h, of)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(h.Sum(nil), sum), nil
+}
+
+// reuseFile creates a file at target with the content of src.
+// Only verified files are hardlinked because writes to a hardlink would change the source file too.
+func reuseFile(src, target string, verified bool) (CrossSeedMethod, error) {
+	err := os.MkdirAll(filepath.Dir(target), os.ModeDir|0750)
+	if err != nil {
+		return "", err
+	}
+	if verified && os.Link(src, target) == nil {
+		return CrossSeedHardlink, nil
+	}
+	if reflink(src, target) == nil {
+		return CrossSeedReflink, nil
+	}
+	err = copyFile(src, target)
+	if err != nil {
+		return "", err
+	}
+	return CrossSeedCopy, nil
+}
+
+func copyFile(src, target string) error {
+	sf, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+	tf, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tf, sf)
+	if err != nil {
+		tf.Close()
+		os.Remove(target)
+		return err
+	}
+	err = tf.Close()
+	if err != nil {
+		os.Remove(target)
+	}
+	return err
+}
@@ -1,19 +1,92 @@
 package torrent
 
 import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"net"
 	"time"
+
+	"github.com/cenkalti/rain/internal/dht"
+	"go.etcd.io/bbolt"
 )
 
+var errDHTDisabled = errors.New("DHT is disabled")
+
+// DHTStats contains statistics about the routing tables of DHT node.
+type DHTStats struct {
+	IPv4 DHTTableStats
+	// nil if IPv6 DHT is disabled.
+	IPv6 *DHTTableStats
+}
+
+// DHTTableStats contains statistics about the routing table of an address family.
+type DHTTableStats struct {
+	// ID of the DHT node in hex format.
+	NodeID string
+	// Number of nodes in routing table, including the ones that have not replied yet.
+	Nodes int
+	// Number of nodes that have replied to our queries.
+	ReachableNodes int
+	// Nodes grouped by the number of leading bits shared with our node ID. Empty buckets are not included.
+	Buckets []DHTBucket
+}
+
+// DHTBucket contains the number of nodes sharing the same number of leading bits with our node ID.
+type DHTBucket struct {
+	// Number of leading bits shared with our node ID.
+	Prefix int
+	// Number of nodes in bucket.
+	Nodes int
+	// Number of nodes in bucket that have replied to our queries.
+	ReachableNodes int
+}
+
+// DHTStats returns statistics about the routing tables of DHT node.
+func (s *Session) DHTStats() (DHTStats, error) {
+	if !s.config.DHTEnabled {
+		return DHTStats{}, errDHTDisabled
+	}
+	ds := s.dht.Stats()
+	ret := DHTStats{IPv4: newDHTTableStats(ds.IPv4)}
+	if ds.IPv6 != nil {
+		ts := newDHTTableStats(*ds.IPv6)
+		ret.IPv6 = &ts
+	}
+	return ret, nil
+}
+
+func newDHTTableStats(ts dht.TableStats) DHTTableStats {
+	ret := DHTTableStats{
+		NodeID:         hex.EncodeToString([]byte(ts.NodeID)),
+		Nodes:          ts.Nodes,
+		ReachableNodes: ts.ReachableNodes,
+		Buckets:        make([]DHTBucket, len(ts.Buckets)),
+	}
+	for i, b := range ts.Buckets {
+		ret.Buckets[i] = DHTBucket{
+			Prefix:         b.Prefix,
+			Nodes:          b.Nodes,
+			ReachableNodes: b.ReachableNodes,
+		}
+	}
+	return ret
+}
+
 func (s *Session) processDHTResults() {
 	dhtLimiter := time.NewTicker(time.Second)
 	defer dhtLimiter.Stop()
+	saveNodesTicker := time.NewTicker(s.config.DHTNodesSaveInterval)
+	defer saveNodesTicker.Stop()
 	for {
 		select {
 		case <-dhtLimiter.C:
 			s.handleDHTtick()
+		case <-saveNodesTicker.C:
+			s.saveDHTNodes()
 		case res := <-s.dht.PeersRequestResults:
 			for ih, peers := range res {
+				s.sendMetadataFetchPeers(ih, peers)
 				torrents, ok := s.torrentsByInfoHash[ih]
 				if !ok {
 					continue
@@ -43,16 +116,81 @@ func (s *Session) handleDHTtick() {
 	}
 }
 
+// loadDHTNodes returns the node IDs and the addresses of known good nodes saved in previous run.
+func loadDHTNodes(db *bbolt.DB) (id, id6 string, addrs []string, err error) {
+	err = db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(sessionBucket)
+		id = string(b.Get(dhtNodeIDKey))
+		id6 = string(b.Get(dhtNodeID6Key))
+		val := b.Get(dhtNodesKey)
+		if len(val) == 0 {
+			return nil
+		}
+		return json.Unmarshal(val, &addrs)
+	})
+	return
+}
+
+// saveDHTNodeIDs saves the current node IDs. IDs may change while the node is running (BEP 42).
+func saveDHTNodeIDs(db *bbolt.DB, node *dht.DHT) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(sessionBucket)
+		err := b.Put(dhtNodeIDKey, []byte(node.NodeID()))
+		if err != nil {
+			return err
+		}
+		if id6 := node.NodeID6(); id6 != "" {
+			return b.Put(dhtNodeID6Key, []byte(id6))
+		}
+		return nil
+	})
+}
+
+// saveDHTNodes saves the nodes that have replied to our queries, so they can be used for bootstrapping on next start.
+func (s *Session) saveDHTNodes() {
+	nodes := s.dht.KnownNodes()
+	if len(nodes) == 0 {
+		// Keep the nodes from previous run. They may be still useful.
+		return
+	}
+	addrs := make([]string, len(nodes))
+	for i, n := range nodes {
+		addrs[i] = n.Addr
+	}
+	val, err := json.Marshal(addrs)
+	if err != nil {
+		panic(err)
+	}
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(sessionBucket).Put(dhtNodesKey, val)
+	})
+	if err != nil {
+		s.log.Errorln("cannot save DHT nodes:", err.Error())
+		return
+	}
+	err = saveDHTNodeIDs(s.db, s.dht)
+	if err != nil {
+		s.log.Errorln("cannot save DHT node IDs:", err.Error())
+		return
+	}
+	s.log.Debugf("saved %d DHT nodes", len(addrs))
+}
+
 func parseDHTPeers(peers []string) []*net.TCPAddr {
 	addrs := make([]*net.TCPAddr, 0, len(peers))
 	for _, peer := range peers {
-		if len(peer) != 6 {
-			// only IPv4 is supported for now
+		var ipLen int
+		switch len(peer) {
+		case 6:
+			ipLen = net.IPv4len
+		case 18:
+			ipLen = net.IPv6len
+		default:
 			continue
 		}
 		addr := &net.TCPAddr{
-			IP:   net.IP(peer[:4]),
-			Port: int((uint16(peer[4]) << 8) | uint16(peer[5])),
+			IP:   net.IP(peer[:ipLen]),
+			Port: int((uint16(peer[ipLen]) << 8) | uint16(peer[ipLen+1])),
 		}
 		addrs = append(addrs, addr)
 	}
@@ -0,0 +1,319 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/cenkalti/rain/internal/dht"
+	"github.com/cenkalti/rain/internal/metainfo"
+)
+
+var (
+	errDHTCrawlRunning    = errors.New("DHT crawl is already running")
+	errDHTCrawlNotRunning = errors.New("DHT crawl is not running")
+	errDHTCrawlStopped    = errors.New("DHT crawl is stopped")
+)
+
+// Maximum number of discovered torrents waiting for their metadata to be downloaded.
+const maxDHTCrawlMetadataQueue = 1000
+
+// DHTCrawlOptions contains options for crawling DHT.
+type DHTCrawlOptions struct {
+	// Number of sample_infohashes queries sent per second. If zero, Config.DHTCrawlRate is used.
+	Rate int
+	// If not empty, metadata of the discovered torrents are downloaded from peers
+	// and saved into this directory as <info hash>.torrent files.
+	MetadataDir string
+}
+
+// DHTCrawlStats contains statistics about the DHT crawl.
+type DHTCrawlStats struct {
+	// True if the crawl has not been stopped yet.
+	Running bool
+	// Number of nodes that sample_infohashes query is sent.
+	NodesQueried int
+	// Number of nodes replied to sample_infohashes query.
+	NodesResponded int
+	// Number of unique info hashes discovered.
+	InfoHashes int
+	// Number of torrents that metadata is saved into DHTCrawlOptions.MetadataDir.
+	MetadataSaved int
+	// Number of torrents that metadata cannot be downloaded.
+	MetadataFailed int
+	// Number of torrents that metadata is not tried because too many downloads are waiting.
+	MetadataSkipped int
+}
+
+type dhtCrawl struct {
+	crawl       *dht.Crawl
+	metadataDir string
+	fetchC      chan dht.InfoHash
+	closeC      chan struct{}
+	doneC       chan struct{}
+
+	m sync.Mutex
+	// Most recent info hashes discovered.
+	results []InfoHash
+	// Number of info hashes dropped from the beginning of results.
+	offset int
+	stats  DHTCrawlStats
+}
+
+// StartDHTCrawl starts discovering the info hashes of torrents in DHT network (BEP 51).
+// The crawl sends sample_infohashes queries to DHT nodes with a limited rate and follows the nodes in responses.
+// Only a single crawl can run in a Session. Results of the crawl are returned by DHTCrawlResults.
+func (s *Session) StartDHTCrawl(opt *DHTCrawlOptions) error {
+	if !s.config.DHTEnabled {
+		return errDHTDisabled
+	}
+	if opt == nil {
+		opt = &DHTCrawlOptions{}
+	}
+	rate := opt.Rate
+	if rate <= 0 {
+		rate = s.config.DHTCrawlRate
+	}
+	if opt.MetadataDir != "" {
+		err := os.MkdirAll(opt.MetadataDir, os.ModeDir|0750)
+		if err != nil {
+			return err
+		}
+	}
+	s.mDHTCrawl.Lock()
+	defer s.mDHTCrawl.Unlock()
+	if s.dhtCrawl != nil && s.dhtCrawl.running() {
+		return errDHTCrawlRunning
+	}
+	c := &dhtCrawl{
+		crawl:       s.dht.Crawl(dht.CrawlConfig{Rate: rate, MaxInfoHashes: s.config.DHTCrawlMaxResults}),
+		metadataDir: opt.MetadataDir,
+		fetchC:      make(chan dht.InfoHash, maxDHTCrawlMetadataQueue),
+		closeC:      make(chan struct{}),
+		doneC:       make(chan struct{}),
+		stats:       DHTCrawlStats{Running: true},
+	}
+	s.dhtCrawl = c
+	go s.runDHTCrawl(c)
+	return nil
+}
+
+// StopDHTCrawl stops the crawl started with StartDHTCrawl.
+// Results of the crawl are kept until a new crawl is started.
+func (s *Session) StopDHTCrawl() error {
+	s.mDHTCrawl.Lock()
+	c := s.dhtCrawl
+	s.mDHTCrawl.Unlock()
+	if c == nil {
+		return errDHTCrawlNotRunning
+	}
+	c.stop()
+	return nil
+}
+
+// DHTCrawlStats returns statistics about the last crawl started with StartDHTCrawl.
+func (s *Session) DHTCrawlStats() (DHTCrawlStats, error) {
+	s.mDHTCrawl.Lock()
+	c := s.dhtCrawl
+	s.mDHTCrawl.Unlock()
+	if c == nil {
+		return DHTCrawlStats{}, errDHTCrawlNotRunning
+	}
+	cs := c.crawl.Stats()
+	c.m.Lock()
+	defer c.m.Unlock()
+	ret := c.stats
+	ret.NodesQueried = cs.Queried
+	ret.NodesResponded = cs.Responded
+	ret.InfoHashes = cs.InfoHashes
+	return ret, nil
+}
+
+// DHTCrawlResults returns the info hashes discovered by the last crawl, starting from the info hash at index from.
+// Index of the info hash that will be discovered next is returned as next, so results can be received incrementally.
+// Only the last Config.DHTCrawlMaxResults info hashes are kept.
+func (s *Session) DHTCrawlResults(from int) (infoHashes []InfoHash, next int, err error) {
+	s.mDHTCrawl.Lock()
+	c := s.dhtCrawl
+	s.mDHTCrawl.Unlock()
+	if c == nil {
+		return nil, 0, errDHTCrawlNotRunning
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	next = c.offset + len(c.results)
+	if from < c.offset {
+		from = c.offset
+	}
+	if from >= next {
+		return nil, next, nil
+	}
+	infoHashes = make([]InfoHash, next-from)
+	copy(infoHashes, c.results[from-c.offset:])
+	return infoHashes, next, nil
+}
+
+func (s *Session) stopDHTCrawl() {
+	s.mDHTCrawl.Lock()
+	c := s.dhtCrawl
+	s.mDHTCrawl.Unlock()
+	if c != nil {
+		c.stop()
+	}
+}
+
+func (c *dhtCrawl) running() bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.stats.Running
+}
+
+func (c *dhtCrawl) stop() {
+	c.m.Lock()
+	if c.stats.Running {
+		c.stats.Running = false
+		close(c.closeC)
+	}
+	c.m.Unlock()
+	c.crawl.Stop()
+	<-c.doneC
+}
+
+func (s *Session) runDHTCrawl(c *dhtCrawl) {
+	defer close(c.doneC)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	if c.metadataDir != "" {
+		wg.Add(s.config.DHTCrawlMaxMetadataFetches)
+		for i := 0; i < s.config.DHTCrawlMaxMetadataFetches; i++ {
+			go func() {
+				defer wg.Done()
+				s.fetchMetadataLoop(c)
+			}()
+		}
+	}
+	for ih := range c.crawl.C {
+		var h InfoHash
+		copy(h[:], ih)
+		c.m.Lock()
+		c.results = append(c.results, h)
+		if len(c.results) > s.config.DHTCrawlMaxResults {
+			n := len(c.results) - s.config.DHTCrawlMaxResults
+			c.results = append(c.results[:0], c.results[n:]...)
+			c.offset += n
+		}
+		if c.metadataDir != "" {
+			select {
+			case c.fetchC <- ih:
+			default:
+				c.stats.MetadataSkipped++
+			}
+		}
+		c.m.Unlock()
+	}
+}
+
+func (s *Session) fetchMetadataLoop(c *dhtCrawl) {
+	for {
+		select {
+		case ih := <-c.fetchC:
+			err := s.fetchMetadata(ih, c.metadataDir, c.closeC)
+			if err == errDHTCrawlStopped {
+				return
+			}
+			c.m.Lock()
+			if err != nil {
+				s.log.Debugf("cannot fetch metadata of %s: %s", ih, err)
+				c.stats.MetadataFailed++
+			} else {
+				c.stats.MetadataSaved++
+			}
+			c.m.Unlock()
+		case <-c.closeC:
+			return
+		}
+	}
+}
+
+// fetchMetadata downloads the metadata of the torrent from peers and saves it into dir as a .torrent file.
+// Peers are found in DHT and the metadata is downloaded without adding a torrent to the session.
+func (s *Session) fetchMetadata(ih dht.InfoHash, dir string, stopC chan struct{}) error {
+	path := filepath.Join(dir, ih.String()+".torrent")
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	f, err := newMetadataFetch(s, ih)
+	if err != nil {
+		return err
+	}
+	s.addMetadataFetch(ih, f)
+	defer s.removeMetadataFetch(ih, f)
+	b, err := f.run(s.config.DHTCrawlMetadataTimeout, stopC)
+	if err != nil {
+		return err
+	}
+	info, err := s.parseInfo(b)
+	if err != nil {
+		return fmt.Errorf("cannot parse info bytes: %s", err)
+	}
+	if info.Private {
+		return errors.New("private torrent from DHT")
+	}
+	b, err = metainfo.NewBytes(info.Bytes, nil, nil, "", nil)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0640)
+}
+
+// addMetadataFetch registers f for receiving the peers of the info hash and asks DHT for peers.
+func (s *Session) addMetadataFetch(ih dht.InfoHash, f *metadataFetch) {
+	s.mMetadataFetches.Lock()
+	s.metadataFetches[ih] = append(s.metadataFetches[ih], f)
+	s.mMetadataFetches.Unlock()
+	if s.dht != nil {
+		s.dht.PeersRequest(string(ih), false)
+	}
+}
+
+func (s *Session) removeMetadataFetch(ih dht.InfoHash, f *metadataFetch) {
+	s.mMetadataFetches.Lock()
+	a := s.metadataFetches[ih]
+	for i, it := range a {
+		if it == f {
+			a[i] = a[len(a)-1]
+			a = a[:len(a)-1]
+			break
+		}
+	}
+	if len(a) == 0 {
+		delete(s.metadataFetches, ih)
+	} else {
+		s.metadataFetches[ih] = a
+	}
+	s.mMetadataFetches.Unlock()
+
+	if s.dht == nil {
+		return
+	}
+	s.mTorrents.RLock()
+	defer s.mTorrents.RUnlock()
+	if len(s.torrentsByInfoHash[ih]) == 0 {
+		s.dht.RemoveInfoHash(string(ih))
+	}
+}
+
+// sendMetadataFetchPeers sends the peers found in DHT to the metadata fetches of the info hash.
+func (s *Session) sendMetadataFetchPeers(ih dht.InfoHash, peers []string) {
+	s.mMetadataFetches.Lock()
+	defer s.mMetadataFetches.Unlock()
+	for _, f := range s.metadataFetches[ih] {
+		select {
+		case f.peersC <- parseDHTPeers(peers):
+		default:
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package torrent
+
+import (
+	"crypto/ed25519"
+	"errors"
+
+	"github.com/cenkalti/rain/internal/dht"
+)
+
+var errNoDHTNodes = errors.New("no DHT node to store the item")
+
+// DHTGetImmutable returns the bencoded value of the immutable item stored under the SHA-1 hash of the value (BEP 44).
+func (s *Session) DHTGetImmutable(target [20]byte) ([]byte, error) {
+	if !s.config.DHTEnabled {
+		return nil, errDHTDisabled
+	}
+	item, err := s.dht.GetImmutableItem(string(target[:]), s.config.DHTItemTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return item.V, nil
+}
+
+// DHTPutImmutable stores the bencoded value as an immutable item in DHT (BEP 44).
+// Returns the target that the value can be get with.
+func (s *Session) DHTPutImmutable(v []byte) ([20]byte, error) {
+	var target [20]byte
+	if !s.config.DHTEnabled {
+		return target, errDHTDisabled
+	}
+	item := dht.NewImmutableItem(v)
+	copy(target[:], item.Target())
+	return target, s.putItem(item)
+}
+
+// DHTGetMutable returns the bencoded value and the sequence number of the mutable item signed with the key of publicKey (BEP 44).
+// salt is optional and allows storing multiple items with the same key.
+func (s *Session) DHTGetMutable(publicKey ed25519.PublicKey, salt []byte) (v []byte, seq int64, err error) {
+	if !s.config.DHTEnabled {
+		return nil, 0, errDHTDisabled
+	}
+	item, err := s.dht.GetMutableItem(publicKey, salt, s.config.DHTItemTimeout)
+	if err != nil {
+		return nil, 0, err
+	}
+	return item.V, item.Seq, nil
+}
+
+// DHTPutMutable signs the bencoded value with the key and stores it as a mutable item in DHT (BEP 44).
+// seq must be increased on every update of the item.
+// Items expire in DHT after 2 hours, so they must be put again periodically.
+func (s *Session) DHTPutMutable(key ed25519.PrivateKey, salt []byte, seq int64, v []byte) error {
+	if !s.config.DHTEnabled {
+		return errDHTDisabled
+	}
+	return s.putItem(dht.NewMutableItem(key, salt, seq, v))
+}
+
+func (s *Session) putItem(item *dht.Item) error {
+	n, err := s.dht.PutItem(item, s.config.DHTItemTimeout)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errNoDHTNodes
+	}
+	return nil
+}
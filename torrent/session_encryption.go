@@ -0,0 +1,38 @@
+package torrent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const encryptionKeyEnv = "RAIN_ENCRYPTION_KEY"
+
+// parseEncryptionKey decodes the master key from config or environment variable.
+func parseEncryptionKey(s string) ([]byte, error) {
+	if s == "" {
+		s = os.Getenv(encryptionKeyEnv)
+	}
+	if s == "" {
+		return nil, errors.New("encryption key is required for encrypted storage")
+	}
+	key, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid encryption key: " + err.Error())
+	}
+	if len(key) != 32 {
+		return nil, errors.New("encryption key must be 32 bytes")
+	}
+	return key, nil
+}
+
+// deriveTorrentKey returns the key for encrypting the files of a torrent.
+func deriveTorrentKey(master []byte, id string) ([]byte, error) {
+	key := make([]byte, 32)
+	_, err := io.ReadFull(hkdf.New(sha256.New, master, nil, []byte("rain torrent "+id)), key)
+	return key, err
+}
@@ -8,7 +8,7 @@ import (
 	"github.com/cenkalti/rain/internal/metainfo"
 	"github.com/cenkalti/rain/internal/resumer"
 	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
-	"github.com/cenkalti/rain/internal/storage/filestorage"
+	"github.com/cenkalti/rain/internal/storage"
 	"github.com/cenkalti/rain/internal/webseedsource"
 	"go.etcd.io/bbolt"
 )
@@ -74,13 +74,16 @@ func (s *Session) loadExistingTorrent(id string) (tt *Torrent, hasStarted bool,
 			bf = bf3
 		}
 	}
-	var dest string
-	if s.config.DataDirIncludesTorrentID {
-		dest = filepath.Join(s.config.DataDir, id)
+	var sto storage.Storage
+	if spec.Archive != "" {
+		sto, err = s.newArchiveStorage(spec.Archive)
 	} else {
-		dest = s.config.DataDir
+		dest := spec.Dest
+		if dest == "" {
+			dest = s.dataDir(id)
+		}
+		sto, err = s.newStorage(id, dest)
 	}
-	sto, err := filestorage.New(dest)
 	if err != nil {
 		return
 	}
@@ -110,6 +113,22 @@ func (s *Session) loadExistingTorrent(id string) (tt *Torrent, hasStarted bool,
 	}
 	t.rawTrackers = spec.Trackers
 	t.rawWebseedSources = spec.URLList
+	t.fileStats = spec.FileStats
+	t.filePaths = spec.FilePaths
+	t.archive = spec.Archive
+	t.superSeeding = spec.SuperSeeding
+	t.lastScrubAt = spec.LastScrubAt
+	t.publicKey = spec.PublicKey
+	t.salt = spec.Salt
+	t.seq = spec.Seq
+	if len(spec.Signatures) > 0 && info != nil {
+		t.signatures, err = metainfo.ParseSignatures(spec.Signatures)
+		if err != nil {
+			return
+		}
+		// Trusted signers in config may have changed after the torrent is added.
+		t.signer, _ = s.verifySignatures(info.Bytes, t.signatures)
+	}
 	go s.checkTorrent(t)
 	delete(s.availablePorts, spec.Port)
 
@@ -167,6 +186,22 @@ func (s *Session) CompactDatabase(output string) error {
 			Info:              t.torrent.info.Bytes,
 			AddedAt:           t.torrent.addedAt,
 			StopAfterDownload: t.torrent.stopAfterDownload,
+			FilePaths:         t.torrent.filePaths,
+			SuperSeeding:      t.torrent.superSeeding,
+			PublicKey:         t.torrent.publicKey,
+			Salt:              t.torrent.salt,
+			Seq:               t.torrent.seq,
+		}
+		if len(t.torrent.signatures) > 0 {
+			spec.Signatures, err = metainfo.EncodeSignatures(t.torrent.signatures)
+			if err != nil {
+				return err
+			}
+		}
+		if t.torrent.archive != "" {
+			spec.Archive = t.torrent.archive
+		} else if dest, err2 := filepath.Abs(s.dataDir(t.torrent.id)); err2 == nil && dest != t.torrent.storage.RootDir() {
+			spec.Dest = t.torrent.storage.RootDir()
 		}
 		err = res.Write(t.torrent.id, spec)
 		if err != nil {
@@ -0,0 +1,235 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/cenkalti/rain/internal/dht"
+	"github.com/cenkalti/rain/internal/handshaker/outgoinghandshaker"
+	"github.com/cenkalti/rain/internal/infodownloader"
+	"github.com/cenkalti/rain/internal/peer"
+	"github.com/cenkalti/rain/internal/peerprotocol"
+	"github.com/cenkalti/rain/internal/peersource"
+)
+
+// Maximum number of peers that are connected at once while fetching the metadata of a single torrent.
+const maxMetadataFetchPeers = 4
+
+// metadataFetch downloads the info dictionary of a torrent from the peers found in DHT.
+// It is not a torrent in session, so nothing is written to disk or resume database and the torrent is not announced.
+type metadataFetch struct {
+	session  *Session
+	infoHash [20]byte
+	peerID   [20]byte
+
+	// Addresses found in DHT are sent to this channel by the session.
+	peersC chan []*net.TCPAddr
+
+	addrs   []*net.TCPAddr
+	seenIPs map[string]struct{}
+
+	handshakers      map[*outgoinghandshaker.OutgoingHandshaker]struct{}
+	handshakeResultC chan *outgoinghandshaker.OutgoingHandshaker
+
+	// Value is nil until the extension handshake is received from the peer.
+	peers          map[*peer.Peer]*infodownloader.InfoDownloader
+	messages       chan peer.Message
+	pieceMessagesC chan interface{}
+	peerSnubbedC   chan *peer.Peer
+	disconnectC    chan *peer.Peer
+}
+
+func newMetadataFetch(s *Session, ih dht.InfoHash) (*metadataFetch, error) {
+	f := &metadataFetch{
+		session:          s,
+		peersC:           make(chan []*net.TCPAddr, 1),
+		seenIPs:          make(map[string]struct{}),
+		handshakers:      make(map[*outgoinghandshaker.OutgoingHandshaker]struct{}),
+		handshakeResultC: make(chan *outgoinghandshaker.OutgoingHandshaker),
+		peers:            make(map[*peer.Peer]*infodownloader.InfoDownloader),
+		messages:         make(chan peer.Message),
+		pieceMessagesC:   make(chan interface{}),
+		peerSnubbedC:     make(chan *peer.Peer),
+		disconnectC:      make(chan *peer.Peer),
+	}
+	copy(f.infoHash[:], ih)
+	n := copy(f.peerID[:], publicPeerIDPrefix)
+	_, err := rand.Read(f.peerID[n:])
+	return f, err
+}
+
+// run downloads the metadata from peers sent to peersC and returns the info bytes that match the info hash.
+func (f *metadataFetch) run(timeout time.Duration, stopC chan struct{}) ([]byte, error) {
+	defer f.close()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case addrs := <-f.peersC:
+			f.addrs = append(f.addrs, addrs...)
+			f.dialAddresses()
+		case oh := <-f.handshakeResultC:
+			delete(f.handshakers, oh)
+			if oh.Error != nil {
+				f.dialAddresses()
+				break
+			}
+			f.startPeer(oh)
+		case pm := <-f.messages:
+			if b := f.handleMessage(pm.Peer, pm.Message); b != nil {
+				return b, nil
+			}
+		case pm := <-f.pieceMessagesC:
+			// Pieces are never requested.
+			if msg, ok := pm.(peer.PieceMessage); ok {
+				msg.Piece.Buffer.Release()
+				f.closePeer(msg.Peer)
+			}
+		case pe := <-f.peerSnubbedC:
+			f.closePeer(pe)
+		case pe := <-f.disconnectC:
+			f.closePeer(pe)
+		case <-timer.C:
+			return nil, fmt.Errorf("timeout after %s", timeout)
+		case <-stopC:
+			return nil, errDHTCrawlStopped
+		}
+	}
+}
+
+func (f *metadataFetch) close() {
+	for oh := range f.handshakers {
+		oh.Close()
+	}
+	for pe := range f.peers {
+		pe.Close()
+	}
+}
+
+func (f *metadataFetch) dialAddresses() {
+	cfg := &f.session.config
+	for len(f.handshakers)+len(f.peers) < maxMetadataFetchPeers && len(f.addrs) > 0 {
+		addr := f.addrs[0]
+		f.addrs = f.addrs[1:]
+		ip := addr.IP.String()
+		if _, ok := f.seenIPs[ip]; ok {
+			continue
+		}
+		f.seenIPs[ip] = struct{}{}
+		h := outgoinghandshaker.New(addr, peersource.DHT)
+		f.handshakers[h] = struct{}{}
+		go h.Run(
+			cfg.PeerConnectTimeout,
+			cfg.PeerHandshakeTimeout,
+			f.peerID,
+			f.infoHash,
+			f.handshakeResultC,
+			f.session.extensions,
+			cfg.DisableOutgoingEncryption,
+			cfg.ForceOutgoingEncryption,
+		)
+	}
+}
+
+func (f *metadataFetch) startPeer(oh *outgoinghandshaker.OutgoingHandshaker) {
+	cfg := &f.session.config
+	pe := peer.New(oh.Conn, oh.Source, oh.PeerID, oh.Extensions, oh.Cipher, cfg.PieceReadTimeout, cfg.RequestTimeout, cfg.MaxRequestsIn, f.session.bucketDownload, f.session.bucketUpload)
+	f.peers[pe] = nil
+	go pe.Run(f.messages, f.pieceMessagesC, f.peerSnubbedC, f.disconnectC)
+	if !pe.ExtensionsEnabled {
+		f.closePeer(pe)
+		return
+	}
+	if pe.FastEnabled {
+		pe.SendMessage(peerprotocol.HaveNoneMessage{})
+	}
+	msg := peerprotocol.NewExtensionHandshake(0, publicExtensionHandshakeClientVersion, pe.Addr().IP, cfg.MaxRequestsIn, false)
+	// Only the metadata extension is handled.
+	msg.M = map[string]uint8{peerprotocol.ExtensionKeyMetadata: peerprotocol.ExtensionIDMetadata}
+	pe.SendMessage(peerprotocol.ExtensionMessage{
+		ExtendedMessageID: peerprotocol.ExtensionIDHandshake,
+		Payload:           msg,
+	})
+}
+
+func (f *metadataFetch) closePeer(pe *peer.Peer) {
+	if _, ok := f.peers[pe]; !ok {
+		return
+	}
+	delete(f.peers, pe)
+	pe.Close()
+	f.dialAddresses()
+}
+
+// handleMessage returns the info bytes when all of the metadata is downloaded from the peer and verified.
+func (f *metadataFetch) handleMessage(pe *peer.Peer, msg interface{}) []byte {
+	if _, ok := f.peers[pe]; !ok {
+		return nil
+	}
+	switch msg := msg.(type) {
+	case peerprotocol.ExtensionHandshakeMessage:
+		if pe.ExtensionHandshake != nil {
+			break
+		}
+		pe.ExtensionHandshake = &msg
+		if _, ok := msg.M[peerprotocol.ExtensionKeyMetadata]; !ok || msg.MetadataSize <= 0 {
+			f.closePeer(pe)
+			break
+		}
+		if msg.MetadataSize > int(f.session.config.MaxMetadataSize) {
+			pe.Logger().Debugf("metadata size larger than allowed: %d", msg.MetadataSize)
+			f.closePeer(pe)
+			break
+		}
+		id := infodownloader.New(pe)
+		f.peers[pe] = id
+		id.RequestBlocks(f.maxAllowedRequests(pe))
+		pe.ResetSnubTimer()
+	case peerprotocol.ExtensionMetadataMessage:
+		id := f.peers[pe]
+		if id == nil {
+			break
+		}
+		switch msg.Type {
+		case peerprotocol.ExtensionMetadataMessageTypeData:
+			err := id.GotBlock(msg.Piece, msg.Data)
+			if err != nil {
+				pe.Logger().Error(err)
+				f.closePeer(pe)
+				break
+			}
+			if !id.Done() {
+				id.RequestBlocks(f.maxAllowedRequests(pe))
+				pe.ResetSnubTimer()
+				break
+			}
+			pe.StopSnubTimer()
+			hash := sha1.New()
+			_, _ = hash.Write(id.Bytes)
+			if !bytes.Equal(hash.Sum(nil), f.infoHash[:]) {
+				pe.Logger().Errorln("received info does not match with hash")
+				f.closePeer(pe)
+				break
+			}
+			return id.Bytes
+		case peerprotocol.ExtensionMetadataMessageTypeReject:
+			f.closePeer(pe)
+		}
+	}
+	return nil
+}
+
+func (f *metadataFetch) maxAllowedRequests(pe *peer.Peer) int {
+	ret := f.session.config.DefaultRequestsOut
+	if pe.ExtensionHandshake.RequestQueue > 0 {
+		ret = pe.ExtensionHandshake.RequestQueue
+	}
+	if ret > f.session.config.MaxRequestsOut {
+		ret = f.session.config.MaxRequestsOut
+	}
+	return ret
+}
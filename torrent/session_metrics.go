@@ -32,6 +32,9 @@ type sessionMetrics struct {
 	SpeedUpload           metrics.Meter
 	SpeedRead             metrics.Meter
 	SpeedWrite            metrics.Meter
+	FilePoolOpenFiles     metrics.Gauge
+	FilePoolHits          metrics.Meter
+	FilePoolMisses        metrics.Meter
 }
 
 func (s *Session) initMetrics() {
@@ -83,9 +86,15 @@ func (s *Session) initMetrics() {
 		SpeedUpload:   metrics.NewRegisteredMeter("speed_upload", r),
 		SpeedRead:     s.pieceCache.NumLoadedBytes,
 		SpeedWrite:    metrics.NewRegisteredMeter("speed_write", r),
+
+		FilePoolOpenFiles: metrics.NewRegisteredFunctionalGauge("file_pool_open_files", r, func() int64 { return int64(s.filePool.Len()) }),
+		FilePoolHits:      s.filePool.Hits,
+		FilePoolMisses:    s.filePool.Misses,
 	}
 	_ = r.Register("speed_read", s.metrics.SpeedRead)
 	_ = r.Register("reads_per_seconds", s.metrics.ReadsPerSecond)
+	_ = r.Register("file_pool_hits", s.metrics.FilePoolHits)
+	_ = r.Register("file_pool_misses", s.metrics.FilePoolMisses)
 }
 
 func (m *sessionMetrics) Close() {
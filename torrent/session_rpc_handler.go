@@ -42,8 +42,11 @@ func (h *rpcHandler) ListTorrents(args *rpctypes.ListTorrentsRequest, reply *rpc
 func (h *rpcHandler) AddTorrent(args *rpctypes.AddTorrentRequest, reply *rpctypes.AddTorrentResponse) error {
 	r := base64.NewDecoder(base64.StdEncoding, strings.NewReader(args.Torrent))
 	opt := &AddTorrentOptions{
-		Stopped: args.AddTorrentOptions.Stopped,
-		ID:      args.AddTorrentOptions.ID,
+		Stopped:   args.AddTorrentOptions.Stopped,
+		ID:        args.AddTorrentOptions.ID,
+		DataDir:   args.AddTorrentOptions.DataDir,
+		CrossSeed: args.AddTorrentOptions.CrossSeed,
+		Archive:   args.AddTorrentOptions.Archive,
 	}
 	t, err := h.session.AddTorrent(r, opt)
 	var e *InputError
@@ -59,8 +62,11 @@ func (h *rpcHandler) AddTorrent(args *rpctypes.AddTorrentRequest, reply *rpctype
 
 func (h *rpcHandler) AddURI(args *rpctypes.AddURIRequest, reply *rpctypes.AddURIResponse) error {
 	opt := &AddTorrentOptions{
-		Stopped: args.AddTorrentOptions.Stopped,
-		ID:      args.AddTorrentOptions.ID,
+		Stopped:   args.AddTorrentOptions.Stopped,
+		ID:        args.AddTorrentOptions.ID,
+		DataDir:   args.AddTorrentOptions.DataDir,
+		CrossSeed: args.AddTorrentOptions.CrossSeed,
+		Archive:   args.AddTorrentOptions.Archive,
 	}
 	t, err := h.session.AddURI(args.URI, opt)
 	var e *InputError
@@ -85,7 +91,17 @@ func newTorrent(t *Torrent) rpctypes.Torrent {
 }
 
 func (h *rpcHandler) RemoveTorrent(args *rpctypes.RemoveTorrentRequest, reply *rpctypes.RemoveTorrentResponse) error {
-	return h.session.RemoveTorrent(args.ID)
+	opt := &RemoveTorrentOptions{
+		KeepData:    args.KeepData,
+		MoveToTrash: args.MoveToTrash,
+	}
+	err := h.session.RemoveTorrentWithOptions(args.ID, opt)
+	var e *DataError
+	if errors.As(err, &e) {
+		reply.DataError = e.Error()
+		return nil
+	}
+	return err
 }
 
 func (h *rpcHandler) GetMagnet(args *rpctypes.GetMagnetRequest, reply *rpctypes.GetMagnetResponse) error {
@@ -130,6 +146,10 @@ func (h *rpcHandler) GetSessionStats(args *rpctypes.GetSessionStatsRequest, repl
 		ReadCacheSize:        s.ReadCacheSize,
 		ReadCacheUtilization: s.ReadCacheUtilization,
 
+		FilePoolOpenFiles: s.FilePoolOpenFiles,
+		FilePoolHits:      s.FilePoolHits,
+		FilePoolMisses:    s.FilePoolMisses,
+
 		ReadsPerSecond: s.ReadsPerSecond,
 		ReadsActive:    s.ReadsActive,
 		ReadsPending:   s.ReadsPending,
@@ -150,6 +170,73 @@ func (h *rpcHandler) GetSessionStats(args *rpctypes.GetSessionStatsRequest, repl
 	return nil
 }
 
+func (h *rpcHandler) GetDHTStats(args *rpctypes.GetDHTStatsRequest, reply *rpctypes.GetDHTStatsResponse) error {
+	s, err := h.session.DHTStats()
+	if err != nil {
+		return err
+	}
+	reply.Stats = rpctypes.DHTStats{IPv4: newRPCDHTTableStats(s.IPv4)}
+	if s.IPv6 != nil {
+		ts := newRPCDHTTableStats(*s.IPv6)
+		reply.Stats.IPv6 = &ts
+	}
+	return nil
+}
+
+func (h *rpcHandler) StartDHTCrawl(args *rpctypes.StartDHTCrawlRequest, reply *rpctypes.StartDHTCrawlResponse) error {
+	return h.session.StartDHTCrawl(&DHTCrawlOptions{
+		Rate:        args.Rate,
+		MetadataDir: args.MetadataDir,
+	})
+}
+
+func (h *rpcHandler) StopDHTCrawl(args *rpctypes.StopDHTCrawlRequest, reply *rpctypes.StopDHTCrawlResponse) error {
+	return h.session.StopDHTCrawl()
+}
+
+func (h *rpcHandler) GetDHTCrawlResults(args *rpctypes.GetDHTCrawlResultsRequest, reply *rpctypes.GetDHTCrawlResultsResponse) error {
+	s, err := h.session.DHTCrawlStats()
+	if err != nil {
+		return err
+	}
+	ihs, next, err := h.session.DHTCrawlResults(args.From)
+	if err != nil {
+		return err
+	}
+	reply.InfoHashes = make([]string, len(ihs))
+	for i, ih := range ihs {
+		reply.InfoHashes[i] = ih.String()
+	}
+	reply.Next = next
+	reply.Stats = rpctypes.DHTCrawlStats{
+		Running:         s.Running,
+		NodesQueried:    s.NodesQueried,
+		NodesResponded:  s.NodesResponded,
+		InfoHashes:      s.InfoHashes,
+		MetadataSaved:   s.MetadataSaved,
+		MetadataFailed:  s.MetadataFailed,
+		MetadataSkipped: s.MetadataSkipped,
+	}
+	return nil
+}
+
+func newRPCDHTTableStats(s DHTTableStats) rpctypes.DHTTableStats {
+	ret := rpctypes.DHTTableStats{
+		NodeID:         s.NodeID,
+		Nodes:          s.Nodes,
+		ReachableNodes: s.ReachableNodes,
+		Buckets:        make([]rpctypes.DHTBucket, len(s.Buckets)),
+	}
+	for i, b := range s.Buckets {
+		ret.Buckets[i] = rpctypes.DHTBucket{
+			Prefix:         b.Prefix,
+			Nodes:          b.Nodes,
+			ReachableNodes: b.ReachableNodes,
+		}
+	}
+	return ret
+}
+
 func (h *rpcHandler) GetTorrentStats(args *rpctypes.GetTorrentStatsRequest, reply *rpctypes.GetTorrentStatsResponse) error {
 	t := h.session.GetTorrent(args.ID)
 	if t == nil {
@@ -181,6 +268,7 @@ func (h *rpcHandler) GetTorrentStats(args *rpctypes.GetTorrentStatsRequest, repl
 			Downloaded int64
 			Uploaded   int64
 			Wasted     int64
+			Moved      int64
 		}{
 			Total:      s.Bytes.Total,
 			Allocated:  s.Bytes.Allocated,
@@ -189,6 +277,7 @@ func (h *rpcHandler) GetTorrentStats(args *rpctypes.GetTorrentStatsRequest, repl
 			Downloaded: s.Bytes.Downloaded,
 			Uploaded:   s.Bytes.Uploaded,
 			Wasted:     s.Bytes.Wasted,
+			Moved:      s.Bytes.Moved,
 		},
 		Peers: struct {
 			Total    int
@@ -239,10 +328,12 @@ func (h *rpcHandler) GetTorrentStats(args *rpctypes.GetTorrentStatsRequest, repl
 			Snubbed: s.MetadataDownloads.Snubbed,
 			Running: s.MetadataDownloads.Running,
 		},
-		Name:        s.Name,
-		Private:     s.Private,
-		PieceLength: s.PieceLength,
-		SeededFor:   uint(s.SeededFor / time.Second),
+		Name:         s.Name,
+		Private:      s.Private,
+		SuperSeeding: s.SuperSeeding,
+		Signer:       s.Signer,
+		PieceLength:  s.PieceLength,
+		SeededFor:    uint(s.SeededFor / time.Second),
 		Speed: struct {
 			Download int
 			Upload   int
@@ -250,6 +341,29 @@ func (h *rpcHandler) GetTorrentStats(args *rpctypes.GetTorrentStatsRequest, repl
 			Download: s.Speed.Download,
 			Upload:   s.Speed.Upload,
 		},
+		Scrub: struct {
+			Running  bool
+			Checked  uint32
+			Failed   int
+			LastPass rpctypes.Time
+		}{
+			Running:  s.Scrub.Running,
+			Checked:  s.Scrub.Checked,
+			Failed:   s.Scrub.Failed,
+			LastPass: rpctypes.Time{Time: s.Scrub.LastPass},
+		},
+		Holepunch: struct {
+			Requested int
+			Relayed   int
+			Succeeded int
+			Failed    int
+		}{
+			Requested: s.Holepunch.Requested,
+			Relayed:   s.Holepunch.Relayed,
+			Succeeded: s.Holepunch.Succeeded,
+			Failed:    s.Holepunch.Failed,
+		},
+		ModifiedFiles: s.ModifiedFiles,
 	}
 	if s.Error != nil {
 		reply.Stats.Error = s.Error.Error()
@@ -312,6 +426,8 @@ func (h *rpcHandler) GetTorrentPeers(args *rpctypes.GetTorrentPeersRequest, repl
 			source = "INCOMING"
 		case SourceManual:
 			source = "MANUAL"
+		case SourceHolepunch:
+			source = "HOLEPUNCH"
 		default:
 			panic("unhandled peer source")
 		}
@@ -330,6 +446,7 @@ func (h *rpcHandler) GetTorrentPeers(args *rpctypes.GetTorrentPeersRequest, repl
 			Snubbed:            p.Snubbed,
 			EncryptedHandshake: p.EncryptedHandshake,
 			EncryptedStream:    p.EncryptedStream,
+			UploadOnly:         p.UploadOnly,
 			DownloadSpeed:      p.DownloadSpeed,
 			UploadSpeed:        p.UploadSpeed,
 		}
@@ -356,6 +473,27 @@ func (h *rpcHandler) GetTorrentWebseeds(args *rpctypes.GetTorrentWebseedsRequest
 	return nil
 }
 
+func (h *rpcHandler) GetTorrentCrossSeedResults(args *rpctypes.GetTorrentCrossSeedResultsRequest, reply *rpctypes.GetTorrentCrossSeedResultsResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	results := t.CrossSeedResults()
+	reply.Files = make([]rpctypes.CrossSeedFile, len(results))
+	for i, f := range results {
+		reply.Files[i] = rpctypes.CrossSeedFile{
+			Path:          f.Path,
+			Source:        f.Source,
+			SourceTorrent: f.SourceTorrent,
+			Method:        string(f.Method),
+		}
+		if f.Error != nil {
+			reply.Files[i].Error = f.Error.Error()
+		}
+	}
+	return nil
+}
+
 func (h *rpcHandler) StartTorrent(args *rpctypes.StartTorrentRequest, reply *rpctypes.StartTorrentResponse) error {
 	t := h.session.GetTorrent(args.ID)
 	if t == nil {
@@ -389,6 +527,14 @@ func (h *rpcHandler) VerifyTorrent(args *rpctypes.VerifyTorrentRequest, reply *r
 	return t.Verify()
 }
 
+func (h *rpcHandler) SetTorrentSuperSeeding(args *rpctypes.SetTorrentSuperSeedingRequest, reply *rpctypes.SetTorrentSuperSeedingResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	return t.SetSuperSeeding(args.Enabled)
+}
+
 func (h *rpcHandler) StartAllTorrents(args *rpctypes.StartAllTorrentsRequest, reply *rpctypes.StartAllTorrentsResponse) error {
 	return h.session.StartAll()
 }
@@ -421,6 +567,22 @@ func (h *rpcHandler) MoveTorrent(args *rpctypes.MoveTorrentRequest, reply *rpcty
 	return t.Move(args.Target)
 }
 
+func (h *rpcHandler) SetTorrentLocation(args *rpctypes.SetTorrentLocationRequest, reply *rpctypes.SetTorrentLocationResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	return t.SetLocation(args.Path, args.MoveData)
+}
+
+func (h *rpcHandler) RenameTorrentPath(args *rpctypes.RenameTorrentPathRequest, reply *rpctypes.RenameTorrentPathResponse) error {
+	t := h.session.GetTorrent(args.ID)
+	if t == nil {
+		return errTorrentNotFound
+	}
+	return t.Rename(args.OldPath, args.NewPath)
+}
+
 func (h *rpcHandler) handleMoveTorrent(w http.ResponseWriter, r *http.Request) {
 	port, err := h.session.getPort()
 	if err != nil {
@@ -510,13 +672,7 @@ func (h *rpcHandler) handleMoveTorrent(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "data expected in multipart form", http.StatusBadRequest)
 		return
 	}
-	var dest string
-	if h.session.config.DataDirIncludesTorrentID {
-		dest = filepath.Join(h.session.config.DataDir, id)
-	} else {
-		dest = h.session.config.DataDir
-	}
-	err = readData(p, dest)
+	err = readData(p, h.session.dataDir(id))
 	if err != nil {
 		h.session.log.Error(err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -0,0 +1,83 @@
+package torrent
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/cenkalti/rain/internal/metainfo"
+	"github.com/mitchellh/go-homedir"
+)
+
+var errUntrustedTorrent = errors.New("torrent is not signed by a trusted signer")
+
+// loadTrustedSigners reads the certificates of trusted torrent signers from PEM files.
+func loadTrustedSigners(paths []string) (*x509.CertPool, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	pool := x509.NewCertPool()
+	for _, path := range paths {
+		path, err := homedir.Expand(path)
+		if err != nil {
+			return nil, err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificate found in %s", path)
+		}
+	}
+	return pool, nil
+}
+
+// verifySignatures checks the signatures of the info dict (BEP 35) and returns the identity of the first trusted signer.
+// Any signature that does not match the info dict is an error, because the torrent may have been tampered with.
+// Signatures without a certificate cannot be checked and are ignored.
+// The identity is taken from the certificate because the key of the signature can be chosen freely by anyone.
+func (s *Session) verifySignatures(info []byte, sigs []metainfo.Signature) (signer string, err error) {
+	for _, sig := range sigs {
+		if sig.Certificate == nil {
+			continue
+		}
+		err = sig.Verify(info)
+		if err != nil {
+			return "", fmt.Errorf("invalid signature of %q: %s", sig.Identity, err)
+		}
+		if signer == "" && s.isTrustedSigner(sig.Certificate) {
+			signer = certificateIdentity(sig.Certificate)
+		}
+	}
+	if signer == "" && s.config.RequireTrustedSigner {
+		return "", errUntrustedTorrent
+	}
+	return signer, nil
+}
+
+// certificateIdentity returns the subject common name of the certificate, or the first name in its alternative names.
+func certificateIdentity(cert *x509.Certificate) string {
+	switch {
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	default:
+		return cert.Subject.String()
+	}
+}
+
+func (s *Session) isTrustedSigner(cert *x509.Certificate) bool {
+	if s.trustedSigners == nil {
+		return false
+	}
+	_, err := cert.Verify(x509.VerifyOptions{
+		Roots:     s.trustedSigners,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err == nil
+}
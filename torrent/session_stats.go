@@ -32,6 +32,13 @@ type SessionStats struct {
 	// Hit ratio of read cache.
 	ReadCacheUtilization int
 
+	// Number of data files open in file pool.
+	FilePoolOpenFiles int
+	// Number of accesses per second to files that are already open.
+	FilePoolHits int
+	// Number of accesses per second to files that need to be opened.
+	FilePoolMisses int
+
 	// Number of reads per second from disk.
 	ReadsPerSecond int
 	// Number of active read requests from disk.
@@ -81,6 +88,10 @@ func (s *Session) Stats() SessionStats {
 		ReadCacheSize:        s.metrics.ReadCacheSize.Value(),
 		ReadCacheUtilization: int(s.metrics.ReadCacheUtilization.Value()),
 
+		FilePoolOpenFiles: int(s.metrics.FilePoolOpenFiles.Value()),
+		FilePoolHits:      int(s.metrics.FilePoolHits.Rate1()),
+		FilePoolMisses:    int(s.metrics.FilePoolMisses.Rate1()),
+
 		ReadsPerSecond: int(s.metrics.ReadsPerSecond.Rate1()),
 		ReadsActive:    int(s.metrics.ReadsActive.Value()),
 		ReadsPending:   int(s.metrics.ReadsPending.Value()),
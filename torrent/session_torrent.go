@@ -4,6 +4,7 @@ import (
 	"archive/tar"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -185,9 +186,50 @@ func (t *Torrent) Verify() error {
 	return nil
 }
 
+// SetLocation changes the directory that the files of the torrent are saved in.
+// If moveData is true, the torrent is stopped and files are moved to the new directory while the torrent is in Moving state.
+// Files are copied if they cannot be renamed. After files are moved, the torrent is started again if it was running.
+// If moveData is false, files that already exist in the new directory are verified.
+// As in Verify, the torrent stays stopped after verification finishes.
+func (t *Torrent) SetLocation(path string, moveData bool) error {
+	return t.torrent.SetLocation(path, moveData)
+}
+
+// Rename changes the path of a file or directory in the torrent. Paths are relative to the data directory of the torrent.
+// If oldPath is a directory, all files under it are moved, e.g. the root directory of the torrent can be renamed.
+// Files are renamed on disk immediately. Torrent may be running while renaming.
+// New paths are saved to resume db and used until the torrent is removed.
+func (t *Torrent) Rename(oldPath, newPath string) error {
+	return t.torrent.Rename(oldPath, newPath)
+}
+
+// SetSuperSeeding enables or disables super-seeding mode (BEP 16) of the torrent.
+// In super-seeding mode, the torrent does not advertise its bitfield to peers while seeding.
+// Rare pieces are revealed to each peer one at a time and a new piece is revealed only after the previous one is seen at another peer.
+// Peers that are already connected when super-seeding is enabled continue to see all pieces.
+func (t *Torrent) SetSuperSeeding(enabled bool) error {
+	err := t.torrent.session.resumer.WriteSuperSeeding(t.torrent.id, enabled)
+	if err != nil {
+		return err
+	}
+	t.torrent.SetSuperSeeding(enabled)
+	return nil
+}
+
+// CrossSeedResults returns the result for each file if the torrent is added with AddTorrentOptions.CrossSeed option.
+// Results are nil until all files are processed. Reused files are verified when the torrent is started.
+// Results are not saved, so they are not available after the Session is restarted.
+func (t *Torrent) CrossSeedResults() []CrossSeedFile {
+	return t.torrent.CrossSeedResults()
+}
+
 // Move torrent to another Session.
 // target must be the RPC server address in host:port form.
+// Torrents in encrypted storage cannot be moved because the files are encrypted with a key that is derived from the key of this Session.
 func (t *Torrent) Move(target string) error {
+	if t.torrent.session.config.StorageType == "encrypted" {
+		return errors.New("torrents in encrypted storage cannot be moved")
+	}
 	t.torrent.Stop()
 	spec, err := t.torrent.session.resumer.Read(t.torrent.id)
 	if err != nil {
@@ -262,21 +304,19 @@ func (t *Torrent) generateTar(pw *io.PipeWriter) {
 	defer func() { _ = pw.CloseWithError(err) }()
 
 	tw := tar.NewWriter(pw)
-	var root string
-	if t.torrent.session.config.DataDirIncludesTorrentID {
-		root = filepath.Join(t.torrent.session.config.DataDir, t.torrent.id)
-	} else {
-		root = t.torrent.session.config.DataDir
-	}
-	walkFunc := func(path string, info os.FileInfo, err error) error {
+	root := t.torrent.storage.RootDir()
+	addFile := func(name string) error {
+		path := filepath.Join(root, name)
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
 		if err != nil {
+			t.torrent.log.Errorln("cannot stat file:", err)
 			return err
 		}
-		if info.IsDir() {
-			return nil
-		}
 		hdr := &tar.Header{
-			Name: path[len(root)+1:],
+			Name: filepath.ToSlash(name),
 			Mode: 0600,
 			Size: info.Size(),
 		}
@@ -298,14 +338,17 @@ func (t *Torrent) generateTar(pw *io.PipeWriter) {
 		}
 		return nil
 	}
-	err = filepath.Walk(root, walkFunc)
-	if os.IsNotExist(err) {
-		err = nil
-		return
-	}
-	if err != nil {
-		t.torrent.log.Errorln("error walking files:", err)
-		return
+	// Only the files of the torrent are added because the directory may be shared with other files.
+	if t.torrent.info != nil {
+		for _, f := range t.torrent.diskFiles() {
+			if !f.Stored() {
+				continue
+			}
+			err = addFile(f.Path)
+			if err != nil {
+				return
+			}
+		}
 	}
 	err = tw.Close()
 	if err != nil {
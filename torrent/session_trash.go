@@ -0,0 +1,130 @@
+package torrent
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const emptyTrashInterval = time.Hour
+
+func (s *Session) stopAndTrashData(t *Torrent) error {
+	s.stopTorrent(t)
+	var srcs []string
+	for _, src := range s.torrentDataPaths(t) {
+		if _, err := os.Stat(src); err == nil {
+			srcs = append(srcs, src)
+		}
+	}
+	if len(srcs) == 0 {
+		return nil
+	}
+	err := os.MkdirAll(s.config.TrashDir, os.ModeDir|0750)
+	if err != nil {
+		s.log.Errorf("cannot create trash dir. err: %s dest: %s", err, s.config.TrashDir)
+		return err
+	}
+	// Torrent ID is unique in session. Timestamp is added in case a torrent is added with the same ID later.
+	dest := filepath.Join(s.config.TrashDir, t.torrent.id+"."+strconv.FormatInt(time.Now().Unix(), 10))
+	if srcs[0] == t.torrent.storage.RootDir() {
+		// Directory belongs to the torrent only.
+		err = moveToTrash(srcs[0], dest)
+	} else {
+		err = os.Mkdir(dest, os.ModeDir|0750)
+		for _, src := range srcs {
+			if err != nil {
+				break
+			}
+			err = moveToTrash(src, filepath.Join(dest, filepath.Base(src)))
+		}
+	}
+	if err != nil {
+		s.log.Errorf("cannot move torrent data to trash. err: %s dest: %s", err, dest)
+		return err
+	}
+	s.log.Infof("moved torrent data to trash: %s", dest)
+	// Modification time of the entry is used as the time it is put in trash.
+	now := time.Now()
+	_ = os.Chtimes(dest, now, now)
+	return nil
+}
+
+// moveToTrash renames src to dest. If renaming fails (i.e. trash is on another device),
+// src is copied to dest and removed after all of its files are copied.
+func moveToTrash(src, dest string) error {
+	if os.Rename(src, dest) == nil {
+		return nil
+	}
+	err := filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		switch {
+		case fi.IsDir():
+			return os.MkdirAll(target, os.ModeDir|0750)
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			return copyFile(path, target)
+		}
+	})
+	if err != nil {
+		_ = os.RemoveAll(dest)
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+func (s *Session) emptyTrashLoop() {
+	s.emptyTrash()
+	ticker := time.NewTicker(emptyTrashInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.emptyTrash()
+		case <-s.closeC:
+			return
+		}
+	}
+}
+
+func (s *Session) emptyTrash() {
+	f, err := os.Open(s.config.TrashDir)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		s.log.Errorf("cannot open trash dir: %s", err)
+		return
+	}
+	fis, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		s.log.Errorf("cannot read trash dir: %s", err)
+		return
+	}
+	for _, fi := range fis {
+		if time.Since(fi.ModTime()) < s.config.TrashRetention {
+			continue
+		}
+		name := filepath.Join(s.config.TrashDir, fi.Name())
+		err = os.RemoveAll(name)
+		if err != nil {
+			s.log.Errorf("cannot remove trash entry. err: %s name: %s", err, name)
+			continue
+		}
+		s.log.Infof("removed trash entry: %s", name)
+	}
+	s.collectGarbage()
+}
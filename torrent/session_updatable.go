@@ -0,0 +1,155 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cenkalti/rain/internal/magnet"
+	"github.com/zeebo/bencode"
+)
+
+// torrentVersion is the value of the mutable item that the latest version of an updatable torrent is published with (BEP 46).
+type torrentVersion struct {
+	InfoHash []byte `bencode:"ih"`
+}
+
+// PublishTorrent publishes the info hash as the latest version of the updatable torrent identified by the key and salt (BEP 46).
+// Torrents added with a magnet link containing "xs=urn:btpk:<hex public key>" and "s=<hex salt>" are switched to the new version.
+// seq must be greater than the one used in previous publish.
+// Published versions expire in DHT after 2 hours unless they are published again.
+// Subscribed sessions also put the latest version again when they check for updates.
+func (s *Session) PublishTorrent(key ed25519.PrivateKey, salt []byte, seq int64, ih InfoHash) error {
+	v, err := bencode.EncodeBytes(torrentVersion{InfoHash: ih[:]})
+	if err != nil {
+		return err
+	}
+	return s.DHTPutMutable(key, salt, seq, v)
+}
+
+// resolveUpdatableTorrent returns the latest info hash published with the public key and salt.
+func (s *Session) resolveUpdatableTorrent(publicKey, salt []byte) (ih [20]byte, seq int64, err error) {
+	if !s.config.DHTEnabled {
+		err = errDHTDisabled
+		return
+	}
+	item, err := s.dht.GetMutableItem(publicKey, salt, s.config.DHTItemTimeout)
+	if err != nil {
+		err = fmt.Errorf("cannot resolve updatable torrent: %s", err)
+		return
+	}
+	ih, err = parseTorrentVersion(item.V)
+	return ih, item.Seq, err
+}
+
+func parseTorrentVersion(v []byte) (ih [20]byte, err error) {
+	var tv torrentVersion
+	err = bencode.DecodeBytes(v, &tv)
+	if err != nil {
+		return
+	}
+	if len(tv.InfoHash) != 20 {
+		err = errors.New("invalid info hash in published item")
+		return
+	}
+	copy(ih[:], tv.InfoHash)
+	return
+}
+
+func (s *Session) checkUpdatableTorrentsLoop() {
+	ticker := time.NewTicker(s.config.DHTUpdateCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.checkUpdatableTorrents()
+		case <-s.closeC:
+			return
+		}
+	}
+}
+
+func (s *Session) checkUpdatableTorrents() {
+	s.mTorrents.RLock()
+	var torrents []*Torrent
+	for _, t := range s.torrents {
+		if t.torrent.publicKey != nil {
+			torrents = append(torrents, t)
+		}
+	}
+	s.mTorrents.RUnlock()
+
+	for _, t := range torrents {
+		err := s.checkUpdatableTorrent(t)
+		if err != nil {
+			t.torrent.log.Errorln("cannot update torrent:", err.Error())
+		}
+	}
+}
+
+// checkUpdatableTorrent searches the latest version of the torrent in DHT and replaces the torrent with the new version if there is one.
+func (s *Session) checkUpdatableTorrent(t *Torrent) error {
+	item, err := s.dht.GetMutableItem(t.torrent.publicKey, t.torrent.salt, s.config.DHTItemTimeout)
+	if err != nil {
+		t.torrent.log.Debugln("cannot get latest version of torrent:", err.Error())
+		return nil
+	}
+	// Keep the latest version alive in DHT for other subscribers.
+	_, err = s.dht.PutItem(item, s.config.DHTItemTimeout)
+	if err != nil {
+		return err
+	}
+	if item.Seq <= t.torrent.seq {
+		return nil
+	}
+	ih, err := parseTorrentVersion(item.V)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(ih[:], t.torrent.InfoHash()) {
+		return nil
+	}
+	return s.updateTorrent(t, ih, item.Seq)
+}
+
+// updateTorrent replaces the torrent with its new version.
+// New version is saved in the same directory, so files that are not changed are verified and seeded in place.
+// Files that are removed in the new version are kept on disk.
+func (s *Session) updateTorrent(old *Torrent, ih [20]byte, seq int64) error {
+	// New version is downloaded by info hash, so its signatures cannot be checked.
+	if s.config.RequireTrustedSigner {
+		return errUntrustedTorrent
+	}
+	if old.torrent.archive != "" {
+		return errors.New("torrent is seeded from an archive")
+	}
+	ma := &magnet.Magnet{
+		InfoHash:  ih,
+		Trackers:  old.torrent.rawTrackers,
+		Peers:     old.torrent.fixedPeers,
+		PublicKey: old.torrent.publicKey,
+		Salt:      old.torrent.salt,
+	}
+	opt := &AddTorrentOptions{
+		Stopped:           true,
+		StopAfterDownload: old.torrent.stopAfterDownload,
+		DataDir:           old.torrent.storage.RootDir(),
+	}
+	running := old.Stats().Status != Stopped
+	t, err := s.addParsedMagnet(ma, seq, opt)
+	if err != nil {
+		return err
+	}
+	// Old version must be stopped before the new version starts writing to the same files.
+	err = s.RemoveTorrentWithOptions(old.torrent.id, &RemoveTorrentOptions{KeepData: true})
+	if err != nil {
+		return err
+	}
+	s.log.Infof("torrent %s is updated to new version %s with id %s", old.torrent.id, t.InfoHash(), t.torrent.id)
+	if running {
+		return t.Start()
+	}
+	return nil
+}
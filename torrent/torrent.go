@@ -21,6 +21,7 @@ import (
 	"github.com/cenkalti/rain/internal/infodownloader"
 	"github.com/cenkalti/rain/internal/logger"
 	"github.com/cenkalti/rain/internal/metainfo"
+	"github.com/cenkalti/rain/internal/mover"
 	"github.com/cenkalti/rain/internal/mse"
 	"github.com/cenkalti/rain/internal/peer"
 	"github.com/cenkalti/rain/internal/pexlist"
@@ -29,6 +30,7 @@ import (
 	"github.com/cenkalti/rain/internal/piecepicker"
 	"github.com/cenkalti/rain/internal/piecewriter"
 	"github.com/cenkalti/rain/internal/resumer"
+	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
 	"github.com/cenkalti/rain/internal/storage"
 	"github.com/cenkalti/rain/internal/suspendchan"
 	"github.com/cenkalti/rain/internal/tracker"
@@ -78,6 +80,39 @@ type torrent struct {
 	files  []allocator.File
 	pieces []piece.Piece
 
+	// State of files on disk when the bitfield is saved last time.
+	// Used for detecting files that are modified while the torrent is stopped.
+	fileStats []boltdbresumer.FileStat
+
+	// Paths of files in storage if any file is renamed. Paths in info are used if nil.
+	filePaths []string
+
+	// Path of the archive that files are read from. Files are not written if not empty.
+	archive string
+
+	// ed25519 public key that new versions of the torrent are published with (BEP 46). Nil if torrent is not updatable.
+	publicKey []byte
+	salt      []byte
+	// Sequence number of the published item that the info hash is taken from.
+	seq int64
+
+	// Signatures of the info dict in the torrent file (BEP 35).
+	signatures []metainfo.Signature
+	// Identity of the trusted signer of the torrent. Empty if the torrent is not signed by a trusted signer.
+	signer string
+
+	// Files are being reused from other torrents in background. Files are allocated after it is done.
+	crossSeeding     bool
+	crossSeedResultC chan []CrossSeedFile
+	// Results of reusing files from other torrents when the torrent is added.
+	crossSeedResults []CrossSeedFile
+
+	// Names of files that are found to be modified on disk at start.
+	modifiedFiles []string
+
+	// Pieces of modified files. If not nil, only these pieces are checked by the Verifier.
+	recheckPieces []piece.Piece
+
 	piecePicker *piecepicker.PiecePicker
 
 	// Peers are sent to this channel when they are disconnected.
@@ -150,6 +185,11 @@ type torrent struct {
 	notifyListenCommandC chan notifyListenCommand // NotifyListen()
 	addPeersCommandC     chan []*net.TCPAddr      // AddPeers()
 	addTrackersCommandC  chan []tracker.Tracker   // AddTrackers()
+	setLocationCommandC  chan setLocationRequest  // SetLocation()
+	renameCommandC       chan renameRequest       // Rename()
+	filesCommandC        chan filesRequest        // CompletedFiles()
+	superSeedCommandC    chan bool                // SetSuperSeeding()
+	crossSeedCommandC    chan crossSeedRequest    // CrossSeedResults()
 
 	// Trackers send announce responses to this channel.
 	addrsFromTrackers chan []*net.TCPAddr
@@ -206,6 +246,25 @@ type torrent struct {
 	verifierResultC   chan *verifier.Verifier
 	checkedPieces     uint32
 
+	// A worker that moves files to another directory.
+	mover          *mover.Mover
+	moverProgressC chan mover.Progress
+	moverResultC   chan *mover.Mover
+	bytesMoved     int64
+	// Storage at the new location. Replaces the current storage after files are moved.
+	moveStorage storage.Storage
+	// Start the torrent after files are moved.
+	moveRestart bool
+
+	// A Verifier that checks hashes of pieces in background while seeding.
+	scrubber          *verifier.Verifier
+	scrubberProgressC chan verifier.Progress
+	scrubberResultC   chan *verifier.Verifier
+	scrubbedPieces    uint32
+	scrubFailures     int
+	lastScrubAt       time.Time
+	scrubTicker       *time.Ticker
+
 	// Metrics
 	downloadSpeed   metrics.Meter
 	uploadSpeed     metrics.Meter
@@ -223,6 +282,27 @@ type torrent struct {
 	// Peers that are sending corrupt data are banned.
 	bannedPeerIPs map[string]struct{}
 
+	// Peers that told us about an address via PEX. Used as a relay for holepunch if we cannot connect to the address.
+	holepunchRelays map[string]*peer.Peer
+
+	// Pieces are revealed to peers one by one while seeding.
+	superSeeding bool
+
+	// Last piece that is revealed to each peer in super-seeding mode.
+	superSeedOffers map[*peer.Peer]uint32
+
+	// Tracker URLs received via tracker exchange. Each URL is handled once.
+	texReceived map[string]struct{}
+
+	// A ticker that ticks periodically to send new trackers to peers via tracker exchange.
+	texTicker *time.Ticker
+
+	// Counters for holepunch extension.
+	holepunchRequested int
+	holepunchRelayed   int
+	holepunchSucceeded int
+	holepunchFailed    int
+
 	// A signal sent to run() loop when announcers are stopped.
 	announcersStoppedC chan struct{}
 
@@ -245,6 +325,23 @@ type torrent struct {
 
 	// Set to true when manual verification is requested
 	doVerify bool
+	// Continue running after verification instead of stopping. Set when the location is changed without moving files.
+	verifyRestart bool
+
+	// True when downloading is paused because free disk space is low.
+	diskFull bool
+
+	// Protects diskFull writing from torrent loop and reading from announcer loop.
+	mDiskFull sync.RWMutex
+
+	// Last upload-only status that is sent to peers in extension handshake.
+	uploadOnlySent bool
+
+	// A ticker that ticks periodically to check free disk space while downloading.
+	diskSpaceTicker *time.Ticker
+
+	// A ticker that ticks periodically to save the bitfield and file stats while the torrent is running.
+	resumeWriteTicker *time.Ticker
 
 	// If true, the torrent is stopped automatically when all pieces are downloaded.
 	stopAfterDownload bool
@@ -327,8 +424,21 @@ func newTorrent2(
 		allocatorResultC:          make(chan *allocator.Allocator),
 		verifierProgressC:         make(chan verifier.Progress),
 		verifierResultC:           make(chan *verifier.Verifier),
+		scrubberProgressC:         make(chan verifier.Progress),
+		moverProgressC:            make(chan mover.Progress),
+		moverResultC:              make(chan *mover.Mover),
+		setLocationCommandC:       make(chan setLocationRequest),
+		renameCommandC:            make(chan renameRequest),
+		filesCommandC:             make(chan filesRequest),
+		superSeedCommandC:         make(chan bool),
+		crossSeedCommandC:         make(chan crossSeedRequest),
+		crossSeedResultC:          make(chan []CrossSeedFile),
+		scrubberResultC:           make(chan *verifier.Verifier),
 		connectedPeerIPs:          make(map[string]struct{}),
 		bannedPeerIPs:             make(map[string]struct{}),
+		holepunchRelays:           make(map[string]*peer.Peer),
+		superSeedOffers:           make(map[*peer.Peer]uint32),
+		texReceived:               make(map[string]struct{}),
 		announcersStoppedC:        make(chan struct{}),
 		dhtPeersC:                 make(chan []*net.TCPAddr, 1),
 		externalIP:                externalip.FirstExternalIP(),
@@ -50,6 +50,12 @@ func (t *torrent) handleAllocationDone(al *allocator.Allocator) {
 
 	// If we already have bitfield from resume db, skip verification and start downloading.
 	if t.bitfield != nil && !al.HasMissing {
+		// Files may be changed while the torrent is stopped. Check only the pieces of modified files.
+		t.recheckPieces = t.checkModifiedFiles()
+		if t.recheckPieces != nil {
+			t.startVerifier()
+			return
+		}
 		for i := uint32(0); i < t.bitfield.Len(); i++ {
 			t.pieces[i].Done = t.bitfield.Test(i)
 		}
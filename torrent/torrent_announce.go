@@ -32,5 +32,8 @@ func (t *torrent) announcerFields() tracker.Torrent {
 		tr.BytesLeft = t.info.Length - t.bytesComplete()
 	}
 	t.mBitfield.RUnlock()
+	t.mDiskFull.RLock()
+	tr.PartialSeed = t.diskFull && tr.BytesLeft > 0
+	t.mDiskFull.RUnlock()
 	return tr
 }
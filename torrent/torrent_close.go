@@ -20,6 +20,15 @@ func (t *torrent) close() {
 		t.stoppedEventAnnouncer.Close()
 	}
 
+	// Maybe we are in "Moving" state. Moved files are reverted back.
+	if t.mover != nil {
+		t.mover.Close()
+		// All files may be moved before the mover is closed. Save the new location in that case.
+		if t.mover.Error == nil {
+			t.handleMoveDone(t.mover)
+		}
+	}
+
 	t.downloadSpeed.Stop()
 	t.uploadSpeed.Stop()
 }
@@ -42,6 +51,8 @@ func (t *torrent) closePeer(pe *peer.Peer) {
 	}
 	t.unchoker.HandleDisconnect(pe)
 	t.pexDropPeer(pe.Addr())
+	t.removeHolepunchRelay(pe)
+	delete(t.superSeedOffers, pe)
 	t.dialAddresses()
 	t.session.metrics.Peers.Dec(1)
 }
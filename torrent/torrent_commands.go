@@ -44,6 +44,96 @@ func (t *torrent) Verify() {
 	}
 }
 
+type setLocationRequest struct {
+	Path     string
+	MoveData bool
+	Response chan error
+}
+
+// SetLocation changes the directory that files of the torrent are saved in.
+func (t *torrent) SetLocation(path string, moveData bool) error {
+	req := setLocationRequest{Path: path, MoveData: moveData, Response: make(chan error, 1)}
+	select {
+	case t.setLocationCommandC <- req:
+	case <-t.closeC:
+		return errClosed
+	}
+	select {
+	case err := <-req.Response:
+		return err
+	case <-t.closeC:
+		return errClosed
+	}
+}
+
+type renameRequest struct {
+	OldPath  string
+	NewPath  string
+	Response chan error
+}
+
+// Rename changes the path of a file or directory in the torrent.
+func (t *torrent) Rename(oldPath, newPath string) error {
+	req := renameRequest{OldPath: oldPath, NewPath: newPath, Response: make(chan error, 1)}
+	select {
+	case t.renameCommandC <- req:
+	case <-t.closeC:
+		return errClosed
+	}
+	select {
+	case err := <-req.Response:
+		return err
+	case <-t.closeC:
+		return errClosed
+	}
+}
+
+// SetSuperSeeding enables or disables super-seeding mode.
+func (t *torrent) SetSuperSeeding(enabled bool) {
+	select {
+	case t.superSeedCommandC <- enabled:
+	case <-t.closeC:
+	}
+}
+
+type crossSeedRequest struct {
+	Response chan []CrossSeedFile
+}
+
+// CrossSeedResults returns the results of reusing files from other torrents.
+func (t *torrent) CrossSeedResults() []CrossSeedFile {
+	var results []CrossSeedFile
+	req := crossSeedRequest{Response: make(chan []CrossSeedFile, 1)}
+	select {
+	case t.crossSeedCommandC <- req:
+	case <-t.closeC:
+	}
+	select {
+	case results = <-req.Response:
+	case <-t.closeC:
+	}
+	return results
+}
+
+type filesRequest struct {
+	Response chan []completedFile
+}
+
+// CompletedFiles returns the files that all of their pieces are downloaded.
+func (t *torrent) CompletedFiles() []completedFile {
+	var files []completedFile
+	req := filesRequest{Response: make(chan []completedFile, 1)}
+	select {
+	case t.filesCommandC <- req:
+	case <-t.closeC:
+	}
+	select {
+	case files = <-req.Response:
+	case <-t.closeC:
+	}
+	return files
+}
+
 // Close this torrent and release all resources.
 // Close must be called before discarding the torrent.
 func (t *torrent) Close() {
@@ -90,10 +180,12 @@ func (t *torrent) Magnet() (string, error) {
 		return "", errors.New("torrent is private")
 	}
 	m := magnet.Magnet{
-		InfoHash: t.infoHash,
-		Name:     t.Name(),
-		Trackers: t.getTieredTrackers(),
-		Peers:    t.fixedPeers,
+		InfoHash:  t.infoHash,
+		Name:      t.Name(),
+		Trackers:  t.getTieredTrackers(),
+		Peers:     t.fixedPeers,
+		PublicKey: t.publicKey,
+		Salt:      t.salt,
 	}
 	return m.String(), nil
 }
@@ -106,7 +198,7 @@ func (t *torrent) Torrent() ([]byte, error) {
 	for i, ws := range t.webseedSources {
 		webseeds[i] = ws.URL
 	}
-	return metainfo.NewBytes(t.info.Bytes, t.getTieredTrackers(), webseeds, "")
+	return metainfo.NewBytes(t.info.Bytes, t.getTieredTrackers(), webseeds, "", t.signatures)
 }
 
 func (t *torrent) getTieredTrackers() [][]string {
@@ -228,6 +320,7 @@ type Peer struct {
 	Snubbed            bool
 	EncryptedHandshake bool
 	EncryptedStream    bool
+	UploadOnly         bool
 	DownloadSpeed      int
 	UploadSpeed        int
 }
@@ -246,6 +339,8 @@ const (
 	SourceIncoming
 	// SourceManual indicates that the peer is added manually via AddPeer method.
 	SourceManual
+	// SourceHolepunch indicates that the peer is connected with the help of another peer.
+	SourceHolepunch
 )
 
 type peersRequest struct {
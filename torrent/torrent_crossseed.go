@@ -0,0 +1,62 @@
+package torrent
+
+import (
+	"path/filepath"
+)
+
+// startCrossSeed reuses the files of other torrents in background. Allocation waits until it is done.
+func (t *torrent) startCrossSeed() {
+	t.crossSeeding = true
+	info, root := t.info, t.storage.RootDir()
+	go func() {
+		results := t.session.crossSeed(t.id, info, root, t.doneC)
+		select {
+		case t.crossSeedResultC <- results:
+		case <-t.closeC:
+		}
+	}()
+}
+
+func (t *torrent) handleCrossSeedDone(results []CrossSeedFile) {
+	t.crossSeeding = false
+	t.crossSeedResults = results
+	// Allocation is postponed if the torrent is started while files are being reused.
+	if t.errC != nil && t.pieces == nil && t.allocator == nil {
+		t.startAllocator()
+	}
+}
+
+// completedFile is a file on disk that can be reused by another torrent with the same content.
+type completedFile struct {
+	// Absolute path of the file.
+	Path   string
+	Length int64
+}
+
+func (t *torrent) completedFiles() []completedFile {
+	if t.info == nil || t.bitfield == nil || t.mover != nil || t.archive != "" {
+		return nil
+	}
+	var ret []completedFile
+	var offset int64
+	root := t.storage.RootDir()
+	pieceLength := int64(t.info.PieceLength)
+	for _, f := range t.diskFiles() {
+		begin := offset
+		offset += f.Length
+		if !f.Stored() || f.Length == 0 {
+			continue
+		}
+		complete := true
+		for i := uint32(begin / pieceLength); i <= uint32((offset-1)/pieceLength); i++ {
+			if !t.bitfield.Test(i) {
+				complete = false
+				break
+			}
+		}
+		if complete {
+			ret = append(ret, completedFile{Path: filepath.Join(root, f.Path), Length: f.Length})
+		}
+	}
+	return ret
+}
@@ -0,0 +1,94 @@
+package torrent
+
+import (
+	"fmt"
+
+	"github.com/cenkalti/rain/internal/diskspace"
+)
+
+// diskFree returns the free space on the disk containing path. It is replaced in tests.
+var diskFree = diskspace.Free
+
+// checkDiskSpace pauses downloading if free disk space falls below the low-water mark, and resumes it when space is freed.
+// It is called before allocating files and periodically while downloading.
+func (t *torrent) checkDiskSpace() {
+	if t.info == nil {
+		return
+	}
+	if s := t.status(); s != Downloading && s != DiskFull {
+		return
+	}
+	free, err := diskFree(t.storage.RootDir())
+	if err != nil {
+		t.log.Warningln("cannot get free disk space:", err)
+		return
+	}
+	low := free < t.session.config.DiskSpaceLowWaterMark
+	switch {
+	case low && !t.diskFull:
+		t.pauseDownloads(fmt.Errorf("free disk space is low: %d bytes free", free))
+	case !low && t.diskFull:
+		t.resumeDownloads()
+	}
+}
+
+// warnDiskSpace logs a warning before allocating files if free disk space is not enough for the remaining bytes of the torrent.
+// Downloading is not paused because files are allocated sparsely and the space may be freed while downloading.
+func (t *torrent) warnDiskSpace() {
+	if t.info == nil {
+		return
+	}
+	free, err := diskFree(t.storage.RootDir())
+	if err != nil {
+		return
+	}
+	left := t.bytesLeft()
+	if free-left < t.session.config.DiskSpaceLowWaterMark {
+		t.log.Warningf("free disk space may not be enough: %d bytes free, %d bytes left to download", free, left)
+	}
+}
+
+// bytesLeft returns the number of bytes of the pieces that are not downloaded yet.
+// It may overestimate by less than a piece length because the last piece is shorter.
+func (t *torrent) bytesLeft() int64 {
+	if t.bitfield == nil {
+		return t.info.Length
+	}
+	left := t.info.Length - int64(t.info.PieceLength)*int64(t.bitfield.Count())
+	if left < 0 {
+		left = 0
+	}
+	return left
+}
+
+// pauseDownloads stops all running piece downloads. Peers stay connected so completed pieces are still uploaded.
+func (t *torrent) pauseDownloads(reason error) {
+	t.log.Warningln("pausing downloads:", reason)
+	t.setDiskFull(true)
+	for _, pd := range t.pieceDownloaders {
+		t.closePieceDownloader(pd)
+		pd.CancelPending()
+	}
+	for _, src := range t.webseedSources {
+		if src.Downloading() {
+			t.closeWebseedDownloader(src)
+			t.webseedActiveDownloads--
+		}
+	}
+	t.updateUploadOnly()
+}
+
+func (t *torrent) resumeDownloads() {
+	t.log.Info("free disk space is available, resuming downloads")
+	t.setDiskFull(false)
+	t.updateUploadOnly()
+	t.startPieceDownloaders()
+	// Seeds may have disconnected while we were upload-only.
+	t.dialAddresses()
+}
+
+func (t *torrent) setDiskFull(value bool) {
+	t.mDiskFull.Lock()
+	t.diskFull = value
+	t.mDiskFull.Unlock()
+}
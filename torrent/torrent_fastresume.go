@@ -0,0 +1,90 @@
+package torrent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cenkalti/rain/internal/piece"
+	"github.com/cenkalti/rain/internal/resumer/boltdbresumer"
+)
+
+// writeFileStats saves the size and modification time of files to resume db.
+func (t *torrent) writeFileStats() error {
+	files := t.diskFiles()
+	stats := make([]boltdbresumer.FileStat, len(files))
+	for i, f := range files {
+		if !f.Stored() {
+			continue
+		}
+		fi, err := t.storage.Stat(f.Path)
+		if err != nil {
+			// Without file stats, bitfield in resume db is used as is on next start.
+			t.log.Warningln("cannot get file stat:", err)
+			stats = nil
+			break
+		}
+		stats[i] = boltdbresumer.FileStat{Size: fi.Size(), ModTime: fi.ModTime()}
+	}
+	err := t.session.resumer.WriteFileStats(t.id, stats)
+	if err != nil {
+		err = fmt.Errorf("cannot write file stats to resume db: %s", err)
+		t.log.Errorln(err)
+		return err
+	}
+	t.fileStats = stats
+	return nil
+}
+
+// writeResumeData saves the bitfield together with the stats of files while the torrent is running.
+// If the program crashes, files written after the last save do not match the stats and their pieces are checked again on next start.
+func (t *torrent) writeResumeData() {
+	if t.files == nil || t.bitfield == nil {
+		return
+	}
+	err := t.writeBitfield()
+	if err != nil {
+		return
+	}
+	_ = t.writeFileStats()
+}
+
+// checkModifiedFiles compares the files on disk with the stats in resume db.
+// Pieces of modified files are marked as missing in bitfield and returned for rechecking.
+func (t *torrent) checkModifiedFiles() []piece.Piece {
+	t.modifiedFiles = nil
+	if len(t.fileStats) != len(t.files) {
+		// Resume db is written by an older version.
+		return nil
+	}
+	modified := make(map[string]struct{})
+	for i, f := range t.files {
+		if !t.info.Files[i].Stored() {
+			continue
+		}
+		st := t.fileStats[i]
+		if f.Stat == nil || f.Stat.Size() != st.Size || !f.Stat.ModTime().Equal(st.ModTime) {
+			// Sections of pieces are named with the paths in torrent.
+			modified[t.info.Files[i].Path] = struct{}{}
+			t.modifiedFiles = append(t.modifiedFiles, f.Name)
+		}
+	}
+	if len(modified) == 0 {
+		return nil
+	}
+	t.log.Warningln("files are modified while torrent is stopped:", strings.Join(t.modifiedFiles, ", "))
+	var pieces []piece.Piece
+	t.mBitfield.Lock()
+	for _, pi := range t.pieces {
+		for _, sec := range pi.Data {
+			if _, ok := modified[sec.Name]; ok {
+				t.bitfield.Clear(pi.Index)
+				pieces = append(pieces, pi)
+				break
+			}
+		}
+	}
+	t.mBitfield.Unlock()
+	// Save bitfield before checking pieces, so modified files are not trusted if the torrent is stopped during the check.
+	_ = t.writeBitfield()
+	return pieces
+}
@@ -32,8 +32,19 @@ func (t *torrent) handleOutgoingHandshakeDone(oh *outgoinghandshaker.OutgoingHan
 	delete(t.outgoingHandshakers, oh)
 	if oh.Error != nil {
 		delete(t.connectedPeerIPs, oh.Addr.IP.String())
+		switch oh.Source {
+		case peersource.Holepunch:
+			t.holepunchFailed++
+		case peersource.PEX:
+			if _, ok := oh.Error.(*net.OpError); ok {
+				t.requestHolepunch(oh.Addr)
+			}
+		}
 		t.dialAddresses()
 		return
 	}
+	if oh.Source == peersource.Holepunch {
+		t.holepunchSucceeded++
+	}
 	t.startPeer(oh.Conn, oh.Source, t.outgoingPeers, oh.PeerID, oh.Extensions, oh.Cipher)
 }
@@ -0,0 +1,144 @@
+package torrent
+
+import (
+	"net"
+
+	"github.com/cenkalti/rain/internal/handshaker/outgoinghandshaker"
+	"github.com/cenkalti/rain/internal/peer"
+	"github.com/cenkalti/rain/internal/peerprotocol"
+	"github.com/cenkalti/rain/internal/peersource"
+)
+
+// holepunchEnabled returns true if peers can be connected each other via holepunch extension for the torrent.
+// Peers of private torrents must be only from trackers.
+func (t *torrent) holepunchEnabled() bool {
+	return t.info == nil || !t.info.Private
+}
+
+func (t *torrent) handleHolepunchMessage(pe *peer.Peer, msg peerprotocol.ExtensionHolepunchMessage) {
+	if !t.holepunchEnabled() {
+		return
+	}
+	// We cannot reply to a peer that has not told the id of holepunch messages in extension handshake.
+	if !pe.HolepunchEnabled() {
+		return
+	}
+	switch msg.Type {
+	case peerprotocol.ExtensionHolepunchMessageTypeRendezvous:
+		t.relayHolepunch(pe, msg.Addr)
+	case peerprotocol.ExtensionHolepunchMessageTypeConnect:
+		t.dialHolepunch(msg.Addr)
+	case peerprotocol.ExtensionHolepunchMessageTypeError:
+		pe.Logger().Debugf("holepunch to %s failed with error code: %d", msg.Addr, msg.ErrCode)
+		t.holepunchFailed++
+	default:
+		pe.Logger().Debugln("unknown holepunch message type:", msg.Type)
+	}
+}
+
+// relayHolepunch tells both peers to connect each other at the same time.
+func (t *torrent) relayHolepunch(pe *peer.Peer, addr *net.TCPAddr) {
+	if addr.IP.Equal(pe.Addr().IP) && addr.Port == pe.Addr().Port {
+		t.sendHolepunchError(pe, addr, peerprotocol.ExtensionHolepunchErrorNoSelf)
+		return
+	}
+	target := t.findPeerByAddr(addr)
+	if target == nil {
+		t.sendHolepunchError(pe, addr, peerprotocol.ExtensionHolepunchErrorNotConnected)
+		return
+	}
+	if !target.HolepunchEnabled() {
+		t.sendHolepunchError(pe, addr, peerprotocol.ExtensionHolepunchErrorNoSupport)
+		return
+	}
+	t.sendHolepunch(target, peerprotocol.ExtensionHolepunchMessage{Type: peerprotocol.ExtensionHolepunchMessageTypeConnect, Addr: pe.Addr()})
+	t.sendHolepunch(pe, peerprotocol.ExtensionHolepunchMessage{Type: peerprotocol.ExtensionHolepunchMessageTypeConnect, Addr: addr})
+	t.holepunchRelayed++
+}
+
+func (t *torrent) findPeerByAddr(addr *net.TCPAddr) *peer.Peer {
+	for pe := range t.peers {
+		a := pe.Addr()
+		if a.IP.Equal(addr.IP) && a.Port == addr.Port {
+			return pe
+		}
+	}
+	return nil
+}
+
+func (t *torrent) sendHolepunchError(pe *peer.Peer, addr *net.TCPAddr, code uint32) {
+	t.sendHolepunch(pe, peerprotocol.ExtensionHolepunchMessage{Type: peerprotocol.ExtensionHolepunchMessageTypeError, Addr: addr, ErrCode: code})
+}
+
+func (t *torrent) sendHolepunch(pe *peer.Peer, msg peerprotocol.ExtensionHolepunchMessage) {
+	if !pe.HolepunchEnabled() {
+		return
+	}
+	pe.SendMessage(peerprotocol.ExtensionMessage{
+		ExtendedMessageID: pe.ExtensionHandshake.M[peerprotocol.ExtensionKeyHolepunch],
+		Payload:           msg,
+	})
+}
+
+// requestHolepunch asks the peer that told us the address to connect us with the peer at the address.
+// It is called when we cannot connect to an address that is received via PEX.
+func (t *torrent) requestHolepunch(addr *net.TCPAddr) {
+	relay, ok := t.holepunchRelays[addr.String()]
+	if !ok {
+		return
+	}
+	delete(t.holepunchRelays, addr.String())
+	if !relay.HolepunchEnabled() {
+		return
+	}
+	relay.Logger().Debugln("sending holepunch rendezvous for", addr)
+	t.sendHolepunch(relay, peerprotocol.ExtensionHolepunchMessage{Type: peerprotocol.ExtensionHolepunchMessageTypeRendezvous, Addr: addr})
+	t.holepunchRequested++
+}
+
+// dialHolepunch connects to the address from our listening port while the peer is connecting to us.
+func (t *torrent) dialHolepunch(addr *net.TCPAddr) {
+	if status := t.status(); status == Stopped || status == Stopping {
+		return
+	}
+	if t.session.config.ForceOutgoingEncryption {
+		t.log.Debugln("cannot holepunch because outgoing encryption is forced:", addr)
+		t.holepunchFailed++
+		return
+	}
+	ip := addr.IP.String()
+	if _, ok := t.bannedPeerIPs[ip]; ok {
+		return
+	}
+	if _, ok := t.connectedPeerIPs[ip]; ok {
+		return
+	}
+	h := outgoinghandshaker.New(addr, peersource.Holepunch)
+	h.LocalPort = t.port
+	t.outgoingHandshakers[h] = struct{}{}
+	t.connectedPeerIPs[ip] = struct{}{}
+	go h.Run(
+		t.session.config.PeerConnectTimeout,
+		t.session.config.PeerHandshakeTimeout,
+		t.peerID,
+		t.infoHash,
+		t.outgoingHandshakerResultC,
+		t.session.extensions,
+		t.session.config.DisableOutgoingEncryption,
+		t.session.config.ForceOutgoingEncryption,
+	)
+}
+
+func (t *torrent) addHolepunchRelay(pe *peer.Peer, addrs []*net.TCPAddr) {
+	for _, addr := range addrs {
+		t.holepunchRelays[addr.String()] = pe
+	}
+}
+
+func (t *torrent) removeHolepunchRelay(pe *peer.Peer) {
+	for addr, relay := range t.holepunchRelays {
+		if relay == pe {
+			delete(t.holepunchRelays, addr)
+		}
+	}
+}
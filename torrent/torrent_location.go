@@ -0,0 +1,93 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cenkalti/rain/internal/mover"
+	"github.com/cenkalti/rain/internal/storage"
+)
+
+func (t *torrent) handleSetLocation(path string, moveData bool) error {
+	if t.mover != nil {
+		return errors.New("torrent is being moved")
+	}
+	if t.archive != "" {
+		return errors.New("torrent is seeded from an archive")
+	}
+	if t.crossSeeding {
+		return errors.New("files are being reused from other torrents")
+	}
+	sto, err := t.session.newStorage(t.id, path)
+	if err != nil {
+		return err
+	}
+	if sto.RootDir() == t.storage.RootDir() {
+		return nil
+	}
+	if t.info == nil {
+		// Files are not created yet.
+		return t.setStorage(sto)
+	}
+	s := t.status()
+	if !moveData {
+		// Files must be closed before switching to new storage.
+		t.stop(nil)
+		err = t.setStorage(sto)
+		if err != nil {
+			return err
+		}
+		t.fileStats = nil
+		t.handleVerifyCommand()
+		t.verifyRestart = s != Stopped && s != Stopping
+		return nil
+	}
+	t.moveRestart = s != Stopped && s != Stopping
+	t.stop(nil)
+	t.log.Infoln("moving files to", sto.RootDir())
+	t.bytesMoved = 0
+	t.moveStorage = sto
+	t.mover = mover.New()
+	go t.mover.Run(t.diskFiles(), t.storage.RootDir(), sto.RootDir(), t.moverProgressC, t.moverResultC)
+	return nil
+}
+
+func (t *torrent) handleMoveDone(mv *mover.Mover) {
+	if t.mover != mv {
+		panic("invalid mover")
+	}
+	t.mover = nil
+	sto := t.moveStorage
+	t.moveStorage = nil
+
+	if mv.Error != nil {
+		t.moveRestart = false
+		t.lastError = fmt.Errorf("cannot move files: %s", mv.Error)
+		t.log.Error(t.lastError)
+		return
+	}
+
+	t.log.Info("files are moved")
+	err := t.setStorage(sto)
+	if err != nil {
+		t.moveRestart = false
+		t.lastError = err
+		return
+	}
+	if t.moveRestart {
+		t.moveRestart = false
+		t.start()
+	}
+}
+
+// setStorage replaces the storage of the torrent and saves the new directory to the resume db.
+func (t *torrent) setStorage(sto storage.Storage) error {
+	err := t.session.resumer.WriteDest(t.id, sto.RootDir())
+	if err != nil {
+		err = fmt.Errorf("cannot write dest to resume db: %s", err)
+		t.log.Errorln(err)
+		return err
+	}
+	t.storage = sto
+	return nil
+}
@@ -128,7 +128,10 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 		// pe.Logger().Debug("Peer ", pe.String(), " has piece #", pi.Index)
 		if t.piecePicker != nil {
 			t.piecePicker.HandleHave(pe, msg.Index)
+		} else {
+			pe.Bitfield.Set(msg.Index)
 		}
+		t.handleSuperSeedHave(pe, msg.Index)
 		t.updateInterestedState(pe)
 		t.startPieceDownloaderFor(pe)
 	case peerprotocol.BitfieldMessage:
@@ -154,7 +157,10 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 					t.piecePicker.HandleHave(pe, i)
 				}
 			}
+		} else {
+			pe.Bitfield = bf
 		}
+		t.updateSuperSeedOffer(pe)
 		t.updateInterestedState(pe)
 		t.startPieceDownloaderFor(pe)
 	case peerprotocol.HaveAllMessage:
@@ -166,7 +172,12 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 			for _, pi := range t.pieces {
 				t.piecePicker.HandleHave(pe, pi.Index)
 			}
+		} else {
+			for _, pi := range t.pieces {
+				pe.Bitfield.Set(pi.Index)
+			}
 		}
+		t.updateSuperSeedOffer(pe)
 		t.updateInterestedState(pe)
 		t.startPieceDownloaderFor(pe)
 	case peerprotocol.HaveNoneMessage:
@@ -184,6 +195,19 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 		if t.piecePicker != nil {
 			t.piecePicker.HandleAllowedFast(pe, msg.Index)
 		}
+	case peerprotocol.SuggestPieceMessage:
+		if t.pieces == nil || t.bitfield == nil {
+			pe.Messages = append(pe.Messages, msg)
+			break
+		}
+		if msg.Index >= t.info.NumPieces {
+			pe.Logger().Errorln("invalid suggest piece index:", msg.Index)
+			t.closePeer(pe)
+			break
+		}
+		if t.piecePicker != nil {
+			t.piecePicker.HandleSuggest(pe, msg.Index)
+		}
 	case peerprotocol.UnchokeMessage:
 		pe.PeerChoking = false
 		pd, ok := t.pieceDownloaders[pe]
@@ -220,6 +244,7 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 	case peerprotocol.InterestedMessage:
 		pe.PeerInterested = true
 		t.unchoker.FastUnchoke(pe)
+		t.suggestPieces(pe, t.cachedPieces())
 	case peerprotocol.NotInterestedMessage:
 		pe.PeerInterested = false
 	case peerprotocol.RequestMessage:
@@ -256,6 +281,7 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 		} else {
 			pe.SendPiece(msg, cachedpiece.New(pi, t.session.pieceCache, t.session.config.ReadCacheBlockSize, t.peerID))
 		}
+		t.handleSuperSeedRequest(pe, msg.Index)
 	case peerprotocol.RejectMessage:
 		if t.pieces == nil || t.bitfield == nil {
 			pe.Logger().Error("reject received but we don't have info")
@@ -314,9 +340,31 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 		pe.Logger().Debugln("extension handshake received:", msg)
 		if pe.ExtensionHandshake != nil {
 			pe.Logger().Debugln("peer changed extensions")
+			// Only the upload-only status and the extension ids can be changed after the first handshake.
+			pe.ExtensionHandshake.UploadOnly = msg.UploadOnly
+			if t.closeUploadOnlyPeer(pe) {
+				break
+			}
+			// Subsequent handshakes may contain only the extensions that are changed. Zero id disables the extension.
+			if pe.ExtensionHandshake.M == nil {
+				pe.ExtensionHandshake.M = make(map[string]uint8, len(msg.M))
+			}
+			for k, v := range msg.M {
+				if v == 0 {
+					delete(pe.ExtensionHandshake.M, k)
+				} else {
+					pe.ExtensionHandshake.M[k] = v
+				}
+			}
+			if pe.TEXEnabled() {
+				t.sendTEX(pe, t.texTrackerURLs())
+			}
 			break
 		}
 		pe.ExtensionHandshake = &msg
+		if t.closeUploadOnlyPeer(pe) {
+			break
+		}
 
 		if len(msg.YourIP) == 4 {
 			t.externalIP = net.IP(msg.YourIP)
@@ -331,6 +379,9 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 				}
 			}
 		}
+		if pe.TEXEnabled() {
+			t.sendTEX(pe, t.texTrackerURLs())
+		}
 	case peerprotocol.ExtensionMetadataMessage:
 		t.handleMetadataMessage(pe, msg)
 	case peerprotocol.ExtensionPEXMessage:
@@ -342,6 +393,7 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 			t.log.Error(err)
 			break
 		}
+		t.addHolepunchRelay(pe, addrs)
 		t.handleNewPeers(addrs, peersource.PEX)
 		addrs, err = tracker.DecodePeersCompact([]byte(msg.Dropped))
 		if err != nil {
@@ -349,6 +401,12 @@ func (t *torrent) handlePeerMessage(pm peer.Message) {
 			break
 		}
 		t.handleNewPeers(addrs, peersource.PEX)
+	case peerprotocol.ExtensionHolepunchMessage:
+		t.handleHolepunchMessage(pe, msg)
+	case peerprotocol.ExtensionDontHaveMessage:
+		t.handleDontHave(pe, msg)
+	case peerprotocol.ExtensionTEXMessage:
+		t.handleTEXMessage(pe, msg)
 	default:
 		panic(fmt.Sprintf("unhandled peer message type: %T", msg))
 	}
@@ -97,6 +97,14 @@ func (t *torrent) handleMetadataMessage(pe *peer.Peer, msg peerprotocol.Extensio
 			t.stop(fmt.Errorf("cannot write resume info: %s", err))
 			break
 		}
+		// Tracker exchange is not advertised until the torrent is known to be public. Tell connected peers that it is enabled now.
+		if t.texEnabled() {
+			for pe := range t.peers {
+				if pe.ExtensionsEnabled {
+					t.sendExtensionHandshake(pe)
+				}
+			}
+		}
 		t.startAllocator()
 	case peerprotocol.ExtensionMetadataMessageTypeReject:
 		id, ok := t.infoDownloaders[pe]
@@ -154,6 +154,12 @@ func (t *torrent) startPeer(
 
 func (t *torrent) sendFirstMessage(p *peer.Peer) {
 	bf := t.bitfield
+	if t.superSeeding && t.completed {
+		// Pretend that we have no pieces. Pieces are revealed one by one later.
+		p.SuperSeeding = true
+		p.SuperSeedRevealed = bitfield.New(t.info.NumPieces)
+		bf = nil
+	}
 	switch {
 	case p.FastEnabled && bf != nil && bf.All():
 		msg := peerprotocol.HaveAllMessage{}
@@ -167,25 +173,37 @@ func (t *torrent) sendFirstMessage(p *peer.Peer) {
 		msg := peerprotocol.BitfieldMessage{Data: bitfieldData}
 		p.SendMessage(&msg)
 	}
-	var metadataSize uint32
-	if t.info != nil {
-		metadataSize = uint32(len(t.info.Bytes))
-	}
 	if p.ExtensionsEnabled {
-		extHandshakeMsg := peerprotocol.NewExtensionHandshake(metadataSize, t.getClientVersion(), p.Addr().IP, t.session.config.MaxRequestsIn)
-		msg := peerprotocol.ExtensionMessage{
-			ExtendedMessageID: peerprotocol.ExtensionIDHandshake,
-			Payload:           extHandshakeMsg,
-		}
-		p.SendMessage(msg)
+		t.sendExtensionHandshake(p)
 	}
 	if p.DHTEnabled {
 		msg := peerprotocol.PortMessage{Port: t.session.config.DHTPort}
 		p.SendMessage(msg)
 	}
-	if p.FastEnabled && t.pieces != nil {
+	if p.FastEnabled && t.pieces != nil && !p.SuperSeeding {
 		p.GenerateAndSendAllowedFastMessages(t.session.config.AllowedFastSet, t.info.NumPieces, t.infoHash, t.pieces)
 	}
+	t.offerSuperSeedPiece(p)
+}
+
+func (t *torrent) sendExtensionHandshake(p *peer.Peer) {
+	var metadataSize uint32
+	if t.info != nil {
+		metadataSize = uint32(len(t.info.Bytes))
+	}
+	extHandshakeMsg := peerprotocol.NewExtensionHandshake(metadataSize, t.getClientVersion(), p.Addr().IP, t.session.config.MaxRequestsIn, t.uploadOnly())
+	// Do not advertise the extensions that are not used for this torrent.
+	if !t.texEnabled() {
+		delete(extHandshakeMsg.M, peerprotocol.ExtensionKeyTEX)
+	}
+	if !t.holepunchEnabled() {
+		delete(extHandshakeMsg.M, peerprotocol.ExtensionKeyHolepunch)
+	}
+	msg := peerprotocol.ExtensionMessage{
+		ExtendedMessageID: peerprotocol.ExtensionIDHandshake,
+		Payload:           extHandshakeMsg,
+	}
+	p.SendMessage(msg)
 }
 
 func (t *torrent) getClientVersion() string {
@@ -43,6 +43,8 @@ func (t *torrent) checkCompletion() bool {
 		pd.CancelPending()
 	}
 	t.piecePicker = nil
+	t.updateUploadOnly()
 	t.updateSeedDuration(time.Now())
+	t.sealFiles()
 	return true
 }
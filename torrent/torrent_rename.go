@@ -0,0 +1,166 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/cenkalti/rain/internal/metainfo"
+)
+
+// diskFiles returns the files of the torrent with their paths in storage.
+func (t *torrent) diskFiles() []metainfo.File {
+	if len(t.filePaths) != len(t.info.Files) {
+		return t.info.Files
+	}
+	files := make([]metainfo.File, len(t.info.Files))
+	for i, f := range t.info.Files {
+		f.Path = t.filePaths[i]
+		files[i] = f
+	}
+	return files
+}
+
+// webseedPaths returns the paths of renamed files keyed by their paths in torrent.
+func (t *torrent) webseedPaths() map[string]string {
+	if len(t.filePaths) != len(t.info.Files) {
+		return nil
+	}
+	paths := make(map[string]string)
+	for i, f := range t.info.Files {
+		if t.filePaths[i] != f.Path {
+			paths[f.Path] = t.filePaths[i]
+		}
+	}
+	return paths
+}
+
+func (t *torrent) handleRename(oldPath, newPath string) error {
+	if t.info == nil {
+		return errors.New("torrent metadata is not downloaded yet")
+	}
+	if t.mover != nil {
+		return errors.New("torrent is being moved")
+	}
+	if t.allocator != nil {
+		return errors.New("files are being allocated")
+	}
+	if t.crossSeeding {
+		return errors.New("files are being reused from other torrents")
+	}
+	oldPath, err := cleanRelativePath(oldPath)
+	if err != nil {
+		return err
+	}
+	newPath, err = cleanRelativePath(newPath)
+	if err != nil {
+		return err
+	}
+	files := t.diskFiles()
+	paths := make([]string, len(files))
+	var found bool
+	for i, f := range files {
+		paths[i] = f.Path
+		if f.Path == oldPath {
+			// Rename a single file.
+			paths[i] = newPath
+			found = true
+		} else if strings.HasPrefix(f.Path, oldPath+string(filepath.Separator)) {
+			// Rename a directory, including the root directory of the torrent.
+			paths[i] = newPath + f.Path[len(oldPath):]
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("no such file or directory in torrent: %q", oldPath)
+	}
+	err = checkPathConflicts(files, paths)
+	if err != nil {
+		return err
+	}
+	// Files are renamed one by one because the directory on disk may contain files that do not belong to the torrent.
+	for i, f := range files {
+		if paths[i] == f.Path || !f.Stored() {
+			continue
+		}
+		err = t.storage.Rename(f.Path, paths[i])
+		if err != nil {
+			t.log.Errorln("cannot rename file:", err)
+			// Revert already renamed files.
+			for j := i - 1; j >= 0; j-- {
+				if paths[j] != files[j].Path && files[j].Stored() {
+					_ = t.storage.Rename(paths[j], files[j].Path)
+				}
+			}
+			return err
+		}
+	}
+	err = t.session.resumer.WriteFilePaths(t.id, paths)
+	if err != nil {
+		err = fmt.Errorf("cannot write file paths to resume db: %s", err)
+		t.log.Errorln(err)
+		return err
+	}
+	t.filePaths = paths
+	for i := range t.files {
+		t.files[i].Name = paths[i]
+	}
+	t.log.Infof("renamed %q to %q", oldPath, newPath)
+	return nil
+}
+
+// cleanRelativePath returns the cleaned path if it points a location under the torrent directory.
+func cleanRelativePath(p string) (string, error) {
+	p = filepath.Clean(filepath.FromSlash(p))
+	if p == "." || filepath.IsAbs(p) || filepath.VolumeName(p) != "" || p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid path: %q", p)
+	}
+	return p, nil
+}
+
+// checkPathConflicts returns an error if a path is used by more than one file or used both as a file and directory.
+// Padding files and symlinks are skipped because they are not saved on disk and their paths may be duplicate.
+func checkPathConflicts(files []metainfo.File, paths []string) error {
+	stored := make(map[string]struct{}, len(paths))
+	dirs := make(map[string]struct{})
+	for i, p := range paths {
+		if !files[i].Stored() {
+			continue
+		}
+		if _, ok := stored[p]; ok {
+			return fmt.Errorf("duplicate file path: %q", p)
+		}
+		stored[p] = struct{}{}
+		for dir := filepath.Dir(p); dir != "."; dir = filepath.Dir(dir) {
+			dirs[dir] = struct{}{}
+		}
+	}
+	for p := range stored {
+		if _, ok := dirs[p]; ok {
+			return fmt.Errorf("path is used as both file and directory: %q", p)
+		}
+	}
+	return nil
+}
+
+// topLevelPaths returns the unique first elements of file paths in storage.
+func (t *torrent) topLevelPaths() []string {
+	var ret []string
+	seen := make(map[string]struct{})
+	for _, f := range t.diskFiles() {
+		if !f.Stored() {
+			continue
+		}
+		name := f.Path
+		if i := strings.IndexRune(name, filepath.Separator); i != -1 {
+			name = name[:i]
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		ret = append(ret, name)
+	}
+	return ret
+}
@@ -16,6 +16,18 @@ func (t *torrent) run() {
 	t.unchokeTicker = time.NewTicker(10 * time.Second)
 	defer t.unchokeTicker.Stop()
 
+	t.diskSpaceTicker = time.NewTicker(t.session.config.DiskSpaceCheckInterval)
+	defer t.diskSpaceTicker.Stop()
+
+	t.scrubTicker = time.NewTicker(scrubCheckInterval)
+	defer t.scrubTicker.Stop()
+
+	t.texTicker = time.NewTicker(time.Minute)
+	defer t.texTicker.Stop()
+
+	t.resumeWriteTicker = time.NewTicker(t.session.config.ResumeWriteInterval)
+	defer t.resumeWriteTicker.Stop()
+
 	for {
 		select {
 		case <-t.closeC:
@@ -30,6 +42,14 @@ func (t *torrent) run() {
 			t.setNeedMorePeers(true)
 		case <-t.verifyCommandC:
 			t.handleVerifyCommand()
+		case req := <-t.setLocationCommandC:
+			req.Response <- t.handleSetLocation(req.Path, req.MoveData)
+		case req := <-t.renameCommandC:
+			req.Response <- t.handleRename(req.OldPath, req.NewPath)
+		case p := <-t.moverProgressC:
+			t.bytesMoved = p.MovedSize
+		case mv := <-t.moverResultC:
+			t.handleMoveDone(mv)
 		case <-t.announcersStoppedC:
 			t.handleStopped()
 		case cmd := <-t.notifyErrorCommandC:
@@ -44,6 +64,14 @@ func (t *torrent) run() {
 			req.Response <- t.getPeers()
 		case req := <-t.webseedsCommandC:
 			req.Response <- t.getWebseeds()
+		case req := <-t.filesCommandC:
+			req.Response <- t.completedFiles()
+		case enabled := <-t.superSeedCommandC:
+			t.handleSuperSeedCommand(enabled)
+		case req := <-t.crossSeedCommandC:
+			req.Response <- t.crossSeedResults
+		case results := <-t.crossSeedResultC:
+			t.handleCrossSeedDone(results)
 		case p := <-t.allocatorProgressC:
 			t.bytesAllocated = p.AllocatedSize
 		case al := <-t.allocatorResultC:
@@ -52,6 +80,12 @@ func (t *torrent) run() {
 			t.checkedPieces = p.Checked
 		case ve := <-t.verifierResultC:
 			t.handleVerificationDone(ve)
+		case p := <-t.scrubberProgressC:
+			t.handleScrubProgress(p)
+		case sc := <-t.scrubberResultC:
+			t.handleScrubDone(sc)
+		case <-t.scrubTicker.C:
+			t.startScrubber()
 		case data := <-t.ramNotifyC:
 			t.startSinglePieceDownloader(data.(*peer.Peer))
 		case addrs := <-t.addrsFromTrackers:
@@ -76,6 +110,13 @@ func (t *torrent) run() {
 			t.handlePeerSnubbed(pe)
 		case <-t.unchokeTicker.C:
 			t.unchoker.TickUnchoke(t.getPeersForUnchoker(), t.completed)
+			t.suggestPiecesAll()
+		case <-t.diskSpaceTicker.C:
+			t.checkDiskSpace()
+		case <-t.texTicker.C:
+			t.sendTEXAll()
+		case <-t.resumeWriteTicker.C:
+			t.writeResumeData()
 		case ih := <-t.incomingHandshakerResultC:
 			t.handleIncomingHandshakeDone(ih)
 		case oh := <-t.outgoingHandshakerResultC:
@@ -0,0 +1,99 @@
+package torrent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cenkalti/rain/internal/piecepicker"
+	"github.com/cenkalti/rain/internal/verifier"
+)
+
+// scrubCheckInterval is the interval of checking whether a scrubbing pass is due. It is replaced in tests.
+var scrubCheckInterval = time.Minute
+
+// startScrubber starts checking pieces in background if the torrent is seeding and the last pass is old enough.
+func (t *torrent) startScrubber() {
+	cfg := t.session.config
+	if !cfg.ScrubEnabled || t.scrubber != nil || t.status() != Seeding {
+		return
+	}
+	if time.Since(t.lastScrubAt) < cfg.ScrubInterval {
+		return
+	}
+	t.log.Info("scrubbing pieces")
+	t.scrubbedPieces = 0
+	t.scrubFailures = 0
+	t.scrubber = verifier.New()
+	// A single worker is enough because reading is throttled. Scrubbing does not wait for the verification slots of the session.
+	go t.scrubber.Run(t.pieces, 1, nil, t.session.bucketScrub, t.scrubberProgressC, t.scrubberResultC)
+}
+
+func (t *torrent) handleScrubProgress(p verifier.Progress) {
+	t.scrubbedPieces = p.Checked
+	if p.OK {
+		return
+	}
+	pi := &t.pieces[p.Index]
+	if !pi.Done || pi.Writing {
+		// Piece is being downloaded again.
+		return
+	}
+	t.log.Warningf("piece #%d has failed hash check while scrubbing", p.Index)
+	t.scrubFailures++
+	t.markPieceMissing(p.Index)
+}
+
+func (t *torrent) handleScrubDone(sc *verifier.Verifier) {
+	if t.scrubber != sc {
+		panic("invalid scrubber")
+	}
+	t.scrubber = nil
+
+	if sc.Error != nil {
+		t.stop(fmt.Errorf("scrub error: %s", sc.Error))
+		return
+	}
+
+	t.lastScrubAt = time.Now()
+	t.log.Infof("scrubbing is done, %d pieces have failed", t.scrubFailures)
+	err := t.session.resumer.WriteLastScrubAt(t.id, t.lastScrubAt)
+	if err != nil {
+		t.log.Errorln("cannot write last scrub time to resume db:", err)
+	}
+}
+
+// markPieceMissing marks a corrupted piece as missing in order to download it again.
+func (t *torrent) markPieceMissing(i uint32) {
+	t.pieces[i].Done = false
+	t.mBitfield.Lock()
+	t.bitfield.Clear(i)
+	t.mBitfield.Unlock()
+	_ = t.writeBitfield()
+	t.sendDontHave(i)
+
+	t.unsealPiece(i)
+
+	if t.completed {
+		// Count the time seeded until now. Status is not Seeding after completed flag is cleared.
+		t.updateSeedDuration(time.Now())
+		// Piece picker is released after completion. Create a new one with the pieces known to be in connected peers.
+		t.completed = false
+		t.completeC = make(chan struct{})
+		t.piecePicker = piecepicker.New(t.pieces, t.session.config.EndgameMaxDuplicateDownloads, t.webseedSources)
+		for pe := range t.peers {
+			for j := uint32(0); j < pe.Bitfield.Len(); j++ {
+				if pe.Bitfield.Test(j) {
+					t.piecePicker.HandleHave(pe, j)
+				}
+			}
+		}
+		t.updateUploadOnly()
+		// Seeds and outgoing connections are closed and the address list is cleared on completion. Ask for new peers.
+		t.setNeedMorePeers(true)
+	}
+	for pe := range t.peers {
+		t.updateInterestedState(pe)
+	}
+	t.dialAddresses()
+	t.startPieceDownloaders()
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/cenkalti/rain/internal/acceptor"
 	"github.com/cenkalti/rain/internal/allocator"
 	"github.com/cenkalti/rain/internal/announcer"
+	"github.com/cenkalti/rain/internal/btconn"
 	"github.com/cenkalti/rain/internal/peer"
 	"github.com/cenkalti/rain/internal/piecedownloader"
 	"github.com/cenkalti/rain/internal/piecepicker"
@@ -17,6 +18,12 @@ import (
 )
 
 func (t *torrent) start() {
+	// Start after files are moved.
+	if t.mover != nil {
+		t.moveRestart = true
+		return
+	}
+
 	// Do not start if already started.
 	if t.errC != nil {
 		return
@@ -45,7 +52,7 @@ func (t *torrent) start() {
 			} else {
 				t.startVerifier()
 			}
-		} else {
+		} else if !t.crossSeeding {
 			t.startAllocator()
 		}
 	} else {
@@ -63,16 +70,23 @@ func (t *torrent) startVerifier() {
 	if len(t.pieces) == 0 {
 		panic("zero length pieces")
 	}
+	pieces := t.pieces
+	if t.recheckPieces != nil {
+		pieces = t.recheckPieces
+	}
 	t.verifier = verifier.New()
-	go t.verifier.Run(t.pieces, t.verifierProgressC, t.verifierResultC)
+	go t.verifier.Run(pieces, int(t.session.config.VerificationWorkers), t.session.semVerify, nil, t.verifierProgressC, t.verifierResultC)
 }
 
 func (t *torrent) startAllocator() {
 	if t.allocator != nil {
 		panic("allocator exists")
 	}
+	// Files are opened even if the disk is full so that existing pieces can be seeded.
+	t.warnDiskSpace()
+	t.checkDiskSpace()
 	t.allocator = allocator.New()
-	go t.allocator.Run(t.info, t.storage, t.allocatorProgressC, t.allocatorResultC)
+	go t.allocator.Run(t.diskFiles(), t.storage, t.allocatorProgressC, t.allocatorResultC)
 }
 
 func (t *torrent) addFixedPeers() {
@@ -111,7 +125,9 @@ func (t *torrent) startAcceptor() {
 	if t.acceptor != nil {
 		return
 	}
-	listener, err := net.ListenTCP("tcp4", &net.TCPAddr{Port: t.port})
+	// Port is shared with holepunch connections only if they can be made.
+	reuse := t.holepunchEnabled() && !t.session.config.ForceOutgoingEncryption
+	listener, err := btconn.Listen(t.port, reuse)
 	if err != nil {
 		t.log.Warningf("cannot listen port %d: %s", t.port, err)
 	} else {
@@ -190,7 +206,7 @@ func (t *torrent) startWebseedDownloader(sp *piecepicker.WebseedDownloadSpec) {
 		src.DownloadSpeed = metrics.NewMeter()
 		break
 	}
-	go ud.Run(t.webseedClient, t.pieces, len(t.info.Files) > 1, t.webseedPieceResultC.SendC(), t.piecePool, t.session.config.WebseedResponseBodyReadTimeout)
+	go ud.Run(t.webseedClient, t.pieces, len(t.info.Files) > 1, t.webseedPaths(), t.webseedPieceResultC.SendC(), t.piecePool, t.session.config.WebseedResponseBodyReadTimeout)
 }
 
 func (t *torrent) startPieceDownloaderFor(pe *peer.Peer) {
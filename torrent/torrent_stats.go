@@ -48,6 +48,8 @@ type Stats struct {
 		Wasted int64
 		// Bytes allocated on storage.
 		Allocated int64
+		// Bytes moved to the new location while the torrent is in "Moving" state.
+		Moved int64
 	}
 	Peers struct {
 		// Number of peers that are connected, handshaked and ready to send and receive messages.
@@ -97,6 +99,10 @@ type Stats struct {
 	Name string
 	// Is private torrent?
 	Private bool
+	// Pieces are revealed to peers one by one while seeding in super-seeding mode.
+	SuperSeeding bool
+	// Identity of the trusted signer of the torrent (BEP 35), taken from its certificate. Empty if the torrent is not signed by a trusted signer.
+	Signer string
 	// Length of a single piece.
 	PieceLength uint32
 	// Duration while the torrent is in Seeding status.
@@ -109,7 +115,30 @@ type Stats struct {
 		Upload int
 	}
 	// Time remaining to complete download. nil value means infinity.
-	ETA *time.Duration
+	ETA   *time.Duration
+	Scrub struct {
+		// True while pieces are being checked in background.
+		Running bool
+		// Number of pieces checked in the current or last pass.
+		Checked uint32
+		// Number of pieces that failed hash check in the current or last pass.
+		Failed int
+		// Time of the last completed full pass. Zero value means the torrent is never scrubbed.
+		LastPass time.Time
+	}
+	Holepunch struct {
+		// Number of rendezvous requests sent to relay peers for the addresses that we cannot connect.
+		Requested int
+		// Number of rendezvous requests that we have relayed between other peers.
+		Relayed int
+		// Number of peers connected after a rendezvous.
+		Succeeded int
+		// Number of failed connection attempts after a rendezvous and errors received from relay peers.
+		Failed int
+	}
+	// Files that are found to be modified on disk while the torrent is stopped.
+	// Pieces of these files are checked again at start.
+	ModifiedFiles []string
 }
 
 func (t *torrent) stats() Stats {
@@ -119,6 +148,8 @@ func (t *torrent) stats() Stats {
 	s.InfoHash = t.infoHash
 	s.Port = t.port
 	s.Status = t.status()
+	s.SuperSeeding = t.superSeeding
+	s.Signer = t.signer
 	s.Error = t.lastError
 	s.Addresses.Total = t.addrList.Len()
 	s.Addresses.Tracker = t.addrList.LenSource(peersource.Tracker)
@@ -143,7 +174,17 @@ func (t *torrent) stats() Stats {
 	s.Bytes.Wasted = t.bytesWasted.Count()
 	s.SeededFor = time.Duration(t.seededFor.Count())
 	s.Bytes.Allocated = t.bytesAllocated
+	s.Bytes.Moved = t.bytesMoved
 	s.Pieces.Checked = t.checkedPieces
+	s.ModifiedFiles = t.modifiedFiles
+	s.Scrub.Running = t.scrubber != nil
+	s.Scrub.Checked = t.scrubbedPieces
+	s.Scrub.Failed = t.scrubFailures
+	s.Scrub.LastPass = t.lastScrubAt
+	s.Holepunch.Requested = t.holepunchRequested
+	s.Holepunch.Relayed = t.holepunchRelayed
+	s.Holepunch.Succeeded = t.holepunchSucceeded
+	s.Holepunch.Failed = t.holepunchFailed
 	s.Speed.Download = int(t.downloadSpeed.Rate1())
 	s.Speed.Upload = int(t.uploadSpeed.Rate1())
 
@@ -246,6 +287,8 @@ func (t *torrent) getPeers() []Peer {
 			source = SourceIncoming
 		case peersource.Manual:
 			source = SourceManual
+		case peersource.Holepunch:
+			source = SourceHolepunch
 		default:
 			panic("unhandled peer source")
 		}
@@ -263,6 +306,7 @@ func (t *torrent) getPeers() []Peer {
 			Snubbed:            pe.Snubbed,
 			EncryptedHandshake: pe.EncryptionCipher != 0,
 			EncryptedStream:    pe.EncryptionCipher == mse.RC4,
+			UploadOnly:         pe.UploadOnly(),
 			Source:             source,
 			DownloadSpeed:      pe.DownloadSpeed(),
 			UploadSpeed:        pe.UploadSpeed(),
@@ -20,6 +20,11 @@ const (
 	Seeding
 	// Stopping the torrent. This is the status after Stop() is called. All peers are disconnected and files are closed. A stop event sent to all trackers. After trackers responded the torrent switches into Stopped state.
 	Stopping
+	// DiskFull indicates that downloading is paused because there is not enough free space on the disk.
+	// Completed pieces are still seeded. Downloading resumes automatically after space is freed.
+	DiskFull
+	// Moving indicates that the files of the torrent are being moved to another directory.
+	Moving
 )
 
 func (s Status) String() string {
@@ -31,22 +36,28 @@ func (s Status) String() string {
 		Downloading:         "Downloading",
 		Seeding:             "Seeding",
 		Stopping:            "Stopping",
+		DiskFull:            "Disk Full",
+		Moving:              "Moving",
 	}
 	return m[s]
 }
 
 func (t *torrent) status() Status {
 	switch {
+	case t.mover != nil:
+		return Moving
 	case t.errC == nil:
 		return Stopped
 	case t.stoppedEventAnnouncer != nil:
 		return Stopping
-	case t.allocator != nil:
+	case t.allocator != nil || t.crossSeeding:
 		return Allocating
 	case t.verifier != nil:
 		return Verifying
 	case t.completed:
 		return Seeding
+	case t.diskFull:
+		return DiskFull
 	case t.info == nil:
 		return DownloadingMetadata
 	default:
@@ -23,11 +23,17 @@ func (t *torrent) handleStopped() {
 
 func (t *torrent) stop(err error) {
 	s := t.status()
+	if s == Moving {
+		// Torrent is already stopped while moving. Do not start after files are moved.
+		t.moveRestart = false
+		return
+	}
 	if s == Stopping || s == Stopped {
 		return
 	}
 
 	t.log.Info("stopping torrent")
+	t.verifyRestart = false
 	t.lastError = err
 	if err != nil && err != errClosed {
 		t.log.Error(err)
@@ -44,16 +50,24 @@ func (t *torrent) stop(err error) {
 	}
 
 	// Closing data is necessary to cancel ongoing IO operations on files.
+	allocated := t.files != nil
 	t.closeData()
+	// Save the state of files after they are closed, so modifications can be detected on next start.
+	if allocated && t.bitfield != nil {
+		_ = t.writeFileStats()
+	}
 	// Data must be closed before closing Allocator.
 	t.stopAllocator()
 	// Data must be closed before closing Verifier.
 	t.stopVerifier()
+	// Data must be closed before closing Scrubber.
+	t.stopScrubber()
 
 	t.stopOutgoingHandshakers()
 	t.stopIncomingHandshakers()
 
 	t.resetSpeeds()
+	t.setDiskFull(false)
 
 	// Stop periodical announcers first.
 	announcers := t.announcers // keep a reference to the list before nilling in order to start StopAnnouncer
@@ -86,6 +100,14 @@ func (t *torrent) stopAllocator() {
 	}
 }
 
+func (t *torrent) stopScrubber() {
+	t.log.Debugln("stopping scrubber")
+	if t.scrubber != nil {
+		t.scrubber.Close()
+		t.scrubber = nil
+	}
+}
+
 func (t *torrent) stopVerifier() {
 	t.log.Debugln("stopping verifier")
 	if t.verifier != nil {
@@ -133,6 +155,7 @@ func (t *torrent) closeData() {
 	}
 	t.files = nil
 	t.pieces = nil
+	t.recheckPieces = nil
 	t.piecePicker = nil
 	t.bytesAllocated = 0
 	t.checkedPieces = 0
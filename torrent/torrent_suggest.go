@@ -0,0 +1,54 @@
+package torrent
+
+import (
+	"github.com/cenkalti/rain/internal/bitfield"
+	"github.com/cenkalti/rain/internal/cachedpiece"
+	"github.com/cenkalti/rain/internal/peer"
+	"github.com/cenkalti/rain/internal/peerprotocol"
+)
+
+// cachedPieces returns the indexes of pieces that have blocks in the read cache.
+func (t *torrent) cachedPieces() []uint32 {
+	if t.session.config.SuggestPieces <= 0 || t.bitfield == nil {
+		return nil
+	}
+	return cachedpiece.Cached(t.session.pieceCache, t.peerID)
+}
+
+// suggestPiecesAll sends suggestions to all interested peers.
+func (t *torrent) suggestPiecesAll() {
+	cached := t.cachedPieces()
+	if len(cached) == 0 {
+		return
+	}
+	for pe := range t.peers {
+		t.suggestPieces(pe, cached)
+	}
+}
+
+// suggestPieces tells the peer to download pieces that are in the read cache (BEP 6).
+// Serving these pieces does not cause disk reads, so the cache is used more efficiently.
+// Each piece is suggested to a peer only once.
+func (t *torrent) suggestPieces(pe *peer.Peer, cached []uint32) {
+	if !pe.FastEnabled || !pe.PeerInterested || pe.SuperSeeding {
+		return
+	}
+	var n int
+	for _, i := range cached {
+		if n >= t.session.config.SuggestPieces {
+			break
+		}
+		if i >= t.bitfield.Len() || !t.bitfield.Test(i) || pe.Bitfield.Test(i) {
+			continue
+		}
+		if pe.SentSuggested == nil {
+			pe.SentSuggested = bitfield.New(t.bitfield.Len())
+		}
+		if pe.SentSuggested.Test(i) {
+			continue
+		}
+		pe.SentSuggested.Set(i)
+		pe.SendMessage(peerprotocol.SuggestPieceMessage{HaveMessage: peerprotocol.HaveMessage{Index: i}})
+		n++
+	}
+}
@@ -0,0 +1,124 @@
+package torrent
+
+import (
+	"github.com/cenkalti/rain/internal/peer"
+	"github.com/cenkalti/rain/internal/peerprotocol"
+)
+
+func (t *torrent) handleSuperSeedCommand(enabled bool) {
+	if t.superSeeding == enabled {
+		return
+	}
+	t.superSeeding = enabled
+	if enabled {
+		t.log.Info("super-seeding enabled")
+		return
+	}
+	t.log.Info("super-seeding disabled")
+	// Reveal all pieces to the peers that are connected in super-seeding mode.
+	for pe := range t.peers {
+		if !pe.SuperSeeding {
+			continue
+		}
+		pe.SuperSeeding = false
+		pe.SuperSeedRevealed = nil
+		delete(t.superSeedOffers, pe)
+		if t.bitfield == nil {
+			continue
+		}
+		for i := uint32(0); i < t.bitfield.Len(); i++ {
+			if t.bitfield.Test(i) && !pe.Bitfield.Test(i) {
+				pe.SendMessage(peerprotocol.HaveMessage{Index: i})
+			}
+		}
+	}
+}
+
+// offerSuperSeedPiece reveals a new piece to the peer in super-seeding mode.
+func (t *torrent) offerSuperSeedPiece(pe *peer.Peer) {
+	if !pe.SuperSeeding || t.bitfield == nil {
+		return
+	}
+	i, ok := t.pickSuperSeedPiece(pe)
+	if !ok {
+		delete(t.superSeedOffers, pe)
+		return
+	}
+	t.superSeedOffers[pe] = i
+	pe.SuperSeedRevealed.Set(i)
+	pe.SendMessage(peerprotocol.HaveMessage{Index: i})
+}
+
+// pickSuperSeedPiece selects the rarest piece among connected peers that the peer does not have and is not revealed to the peer before.
+// Pieces that are revealed to other peers and not seen in the swarm yet are selected only if there is no other choice.
+func (t *torrent) pickSuperSeedPiece(pe *peer.Peer) (uint32, bool) {
+	offered := make(map[uint32]struct{}, len(t.superSeedOffers))
+	for _, i := range t.superSeedOffers {
+		offered[i] = struct{}{}
+	}
+	availability := make([]int, t.bitfield.Len())
+	for pe2 := range t.peers {
+		if pe2.Bitfield == nil {
+			continue
+		}
+		for i := range availability {
+			if pe2.Bitfield.Test(uint32(i)) {
+				availability[i]++
+			}
+		}
+	}
+	picked, fallback := -1, -1
+	for i, n := range availability {
+		if pe.Bitfield.Test(uint32(i)) || pe.SuperSeedRevealed.Test(uint32(i)) {
+			continue
+		}
+		if _, ok := offered[uint32(i)]; ok {
+			if fallback == -1 || n < availability[fallback] {
+				fallback = i
+			}
+			continue
+		}
+		if picked == -1 || n < availability[picked] {
+			picked = i
+		}
+	}
+	if picked == -1 {
+		picked = fallback
+	}
+	if picked == -1 {
+		return 0, false
+	}
+	return uint32(picked), true
+}
+
+// updateSuperSeedOffer is called after the peer has told which pieces it has.
+// A new piece is revealed if the peer already has the piece that is revealed before.
+func (t *torrent) updateSuperSeedOffer(pe *peer.Peer) {
+	if !pe.SuperSeeding {
+		return
+	}
+	i, ok := t.superSeedOffers[pe]
+	if !ok || pe.Bitfield.Test(i) {
+		t.offerSuperSeedPiece(pe)
+	}
+}
+
+// handleSuperSeedHave reveals a new piece to the peers whose last revealed piece is seen at another peer.
+func (t *torrent) handleSuperSeedHave(pe *peer.Peer, index uint32) {
+	for pe2, i := range t.superSeedOffers {
+		if i == index && pe2 != pe {
+			t.offerSuperSeedPiece(pe2)
+		}
+	}
+}
+
+// handleSuperSeedRequest reveals a new piece as soon as the peer starts downloading the last revealed piece
+// if the peer is the only one in the swarm. Otherwise the download would never finish.
+func (t *torrent) handleSuperSeedRequest(pe *peer.Peer, index uint32) {
+	if len(t.peers) != 1 {
+		return
+	}
+	if i, ok := t.superSeedOffers[pe]; ok && i == index {
+		t.offerSuperSeedPiece(pe)
+	}
+}
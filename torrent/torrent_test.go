@@ -1,17 +1,42 @@
 package torrent
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io"
 	"io/ioutil"
+	"math/big"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/cenkalti/rain/internal/bitfield"
+	"github.com/cenkalti/rain/internal/dht"
+	"github.com/cenkalti/rain/internal/diskspace"
 	"github.com/cenkalti/rain/internal/logger"
+	"github.com/cenkalti/rain/internal/metainfo"
+	"github.com/cenkalti/rain/internal/peerconn"
+	"github.com/cenkalti/rain/internal/peerprotocol"
+	"github.com/cenkalti/rain/internal/storage"
+	"github.com/cenkalti/rain/internal/tracker"
 	"github.com/cenkalti/rain/internal/webseedsource"
 	"github.com/fortytw2/leaktest"
 )
@@ -30,10 +55,15 @@ func init() {
 }
 
 func newTestSession(t *testing.T) (*Session, func()) {
+	return newTestSessionConfig(t, DefaultConfig)
+}
+
+func newTestSessionConfig(t *testing.T, cfg Config) (*Session, func()) {
 	tmp, closeTmp := tempdir(t)
-	cfg := DefaultConfig
 	cfg.Database = filepath.Join(tmp, "session.db")
 	cfg.DataDir = tmp
+	cfg.TrashDir = filepath.Join(tmp, "trash")
+	cfg.CASDir = filepath.Join(tmp, "cas")
 	cfg.DHTEnabled = false
 	cfg.PEXEnabled = false
 	cfg.RPCEnabled = false
@@ -188,3 +218,1643 @@ func assertCompleted(t *testing.T, tor *Torrent) {
 		t.Fatal(err)
 	}
 }
+
+// assertTestData checks that the files of the sample torrent in testdata are identical to the files in dir.
+func assertTestData(t *testing.T, dir string) {
+	src := filepath.Join(torrentDataDir, torrentName)
+	err := filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		b1, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		b2, err := ioutil.ReadFile(filepath.Join(dir, rel))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(b1, b2) {
+			t.Errorf("file is different: %s", rel)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitComplete(t *testing.T, tor *Torrent) {
+	select {
+	case <-tor.torrent.NotifyComplete():
+	case err := <-tor.torrent.NotifyError():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("download did not finish")
+	}
+}
+
+// addTestTorrent adds the sample torrent to the session in stopped state. Trackers are removed, so the torrent does not announce.
+func addTestTorrent(t *testing.T, s *Session, opt *AddTorrentOptions) *Torrent {
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var o AddTorrentOptions
+	if opt != nil {
+		o = *opt
+	}
+	o.Stopped = true
+	tor, err := s.AddTorrent(f, &o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor.torrent.trackers = nil
+	return tor
+}
+
+// copyTestData copies the files of the sample torrent into the data directory of the torrent.
+func copyTestData(t *testing.T, tor *Torrent) {
+	dest := tor.torrent.storage.RootDir()
+	err := os.MkdirAll(dest, os.ModeDir|0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = CopyDir(filepath.Join(torrentDataDir, torrentName), filepath.Join(dest, torrentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startAndWaitComplete starts the torrent, adds the peers and waits until all pieces are downloaded or verified.
+func startAndWaitComplete(t *testing.T, tor *Torrent, peers ...string) {
+	err := tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, addr := range peers {
+		err = tor.AddPeer(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitComplete(t, tor)
+}
+
+// startAndWaitListen starts the torrent and returns the address that it accepts peer connections on.
+func startAndWaitListen(t *testing.T, tor *Torrent) string {
+	err := tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case port := <-tor.torrent.NotifyListen():
+		return "127.0.0.1:" + strconv.Itoa(port)
+	case err = <-tor.torrent.NotifyError():
+		t.Fatal(err)
+	case <-time.After(timeout):
+		t.Fatal("torrent is not listening")
+	}
+	return ""
+}
+
+func TestAddTorrentDataDir(t *testing.T) {
+	defer leaktest.Check(t)()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	dataDir, closeDataDir := tempdir(t)
+	defer closeDataDir()
+
+	tor := addTestTorrent(t, s, &AddTorrentOptions{DataDir: dataDir})
+	copyTestData(t, tor)
+	startAndWaitComplete(t, tor)
+	// Existing files in the custom directory are used. Nothing is created in the default directory.
+	_, err := os.Stat(filepath.Join(s.config.DataDir, tor.ID()))
+	if !os.IsNotExist(err) {
+		t.Fatal("files are created in the default data directory")
+	}
+
+	err = s.RemoveTorrent(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		_, err = os.Stat(filepath.Join(dataDir, torrentName))
+		if os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("torrent data is not removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Custom directory itself is not owned by the torrent.
+	_, err = os.Stat(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemoveTorrentWithOptions(t *testing.T) {
+	defer leaktest.Check(t)()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+
+	addTorrent := func() *Torrent {
+		tor := addTestTorrent(t, s, nil)
+		copyTestData(t, tor)
+		return tor
+	}
+
+	tor := addTorrent()
+	dest := tor.torrent.storage.RootDir()
+	err := s.RemoveTorrentWithOptions(tor.ID(), &RemoveTorrentOptions{KeepData: true, MoveToTrash: true})
+	if !errors.Is(err, errKeepDataAndTrash) {
+		t.Fatalf("conflicting options must be rejected, got: %v", err)
+	}
+	if s.GetTorrent(tor.ID()) == nil {
+		t.Fatal("torrent is removed with conflicting options")
+	}
+	err = s.RemoveTorrentWithOptions(tor.ID(), &RemoveTorrentOptions{KeepData: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.GetTorrent(tor.ID()) != nil {
+		t.Fatal("torrent is not removed")
+	}
+	_, err = os.Stat(filepath.Join(dest, torrentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tor = addTorrent()
+	dest = tor.torrent.storage.RootDir()
+	err = s.RemoveTorrentWithOptions(tor.ID(), &RemoveTorrentOptions{MoveToTrash: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(dest)
+	if !os.IsNotExist(err) {
+		t.Fatal("torrent data is not moved to trash")
+	}
+	trash, err := filepath.Glob(filepath.Join(s.config.TrashDir, tor.ID()+".*", torrentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 1 {
+		t.Fatalf("torrent data is not in trash: %v", trash)
+	}
+}
+
+func TestRenameTorrentPath(t *testing.T) {
+	defer leaktest.Check(t)()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	dataDir, closeDataDir := tempdir(t)
+	defer closeDataDir()
+
+	tor := addTestTorrent(t, s, &AddTorrentOptions{DataDir: dataDir})
+	copyTestData(t, tor)
+	startAndWaitComplete(t, tor)
+
+	// Rename while seeding.
+	err := tor.Rename(torrentName, "renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.Rename(filepath.Join("renamed", "README"), filepath.Join("renamed", "docs", "README.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.Rename(filepath.Join("renamed", "folder"), filepath.Join("renamed", "data", "file1.bin", "x"))
+	if err == nil {
+		t.Fatal("conflicting path is accepted")
+	}
+	err = tor.Rename("renamed", "..")
+	if err == nil {
+		t.Fatal("path outside of data dir is accepted")
+	}
+	_, err = os.Stat(filepath.Join(dataDir, "renamed", "docs", "README.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(filepath.Join(dataDir, torrentName))
+	if !os.IsNotExist(err) {
+		t.Fatal("old directory is not removed")
+	}
+
+	// Renamed paths must be used after restart.
+	err = tor.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-tor.NotifyStop():
+	case <-time.After(timeout):
+		t.Fatal("torrent is not stopped")
+	}
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		stats := tor.Stats()
+		if stats.Status == Seeding && stats.Pieces.Missing == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("torrent is not seeding after restart: %s", stats.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, err = os.Stat(filepath.Join(dataDir, torrentName))
+	if !os.IsNotExist(err) {
+		t.Fatal("files are created at old paths")
+	}
+	cmd := exec.Command("diff", "-q", filepath.Join(torrentDataDir, torrentName, "README"), filepath.Join(dataDir, "renamed", "docs", "README.md"))
+	err = cmd.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPaddingFiles(t *testing.T) {
+	defer leaktest.Check(t)()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	dataDir, closeDataDir := tempdir(t)
+	defer closeDataDir()
+
+	src := filepath.Join(torrentDataDir, torrentName)
+	info, err := metainfo.NewInfoBytes("", []string{src}, false, 16<<10, "", true, logger.New("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi, err := metainfo.NewBytes(info, nil, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = CopyDir(src, filepath.Join(dataDir, torrentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor, err := s.AddTorrent(bytes.NewReader(mi), &AddTorrentOptions{Stopped: true, DataDir: dataDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var numPadding int
+	for _, f := range tor.torrent.info.Files {
+		if f.Padding {
+			numPadding++
+		}
+	}
+	if numPadding == 0 {
+		t.Fatal("torrent has no padding files")
+	}
+	startAndWaitComplete(t, tor)
+	_, err = os.Stat(filepath.Join(dataDir, torrentName, ".pad"))
+	if !os.IsNotExist(err) {
+		t.Fatal("padding files are written to disk")
+	}
+	// Padding files are not renamed on disk and do not conflict with each other.
+	err = tor.Rename(torrentName, "renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTestData(t, filepath.Join(dataDir, "renamed"))
+}
+
+func TestMmapStorage(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t)
+	defer cl()
+	cfg := DefaultConfig
+	cfg.StorageType = "mmap"
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+
+	tor := addTestTorrent(t, s, nil)
+	// Downloaded pieces are written into the mappings.
+	startAndWaitComplete(t, tor, addr)
+	assertTestData(t, filepath.Join(tor.torrent.storage.RootDir(), torrentName))
+}
+
+func TestCrossSeed(t *testing.T) {
+	defer leaktest.Check(t)()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	dataDir, closeDataDir := tempdir(t)
+	defer closeDataDir()
+
+	tor := addTestTorrent(t, s, &AddTorrentOptions{DataDir: dataDir})
+	copyTestData(t, tor)
+	startAndWaitComplete(t, tor)
+
+	addCrossSeed := func(pieceLength uint32, align bool) *Torrent {
+		// Same files with a different piece length has a different info hash.
+		info, err := metainfo.NewInfoBytes("", []string{filepath.Join(torrentDataDir, torrentName)}, false, pieceLength, "", align, logger.New("test"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mi, err := metainfo.NewBytes(info, nil, nil, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tor2, err := s.AddTorrent(bytes.NewReader(mi), &AddTorrentOptions{Stopped: true, CrossSeed: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tor2.InfoHash() == tor.InfoHash() {
+			t.Fatal("info hashes must be different")
+		}
+		return tor2
+	}
+
+	// Files are aligned to pieces, so all of their content is verified by piece hashes.
+	tor2 := addCrossSeed(16<<10, true)
+	results := waitCrossSeed(t, tor2)
+	if len(results) != 5 {
+		t.Fatalf("unexpected number of results: %d", len(results))
+	}
+	for _, res := range results {
+		if res.Error != nil {
+			t.Fatalf("file %q is not reused: %s", res.Path, res.Error)
+		}
+		if res.SourceTorrent != tor.ID() {
+			t.Fatalf("file %q is reused from torrent %q", res.Path, res.SourceTorrent)
+		}
+		if res.Method != CrossSeedHardlink {
+			t.Fatalf("file %q is reused with %q", res.Path, res.Method)
+		}
+	}
+	// Reused files pass the hash check without any peers.
+	tor2.torrent.trackers = nil
+	startAndWaitComplete(t, tor2)
+	assertTestData(t, filepath.Join(tor2.torrent.storage.RootDir(), torrentName))
+
+	// No piece is inside of a file and there are no file hashes, so files cannot be checked.
+	tor3 := addCrossSeed(32<<10, false)
+	results = waitCrossSeed(t, tor3)
+	if len(results) != 5 {
+		t.Fatalf("unexpected number of results: %d", len(results))
+	}
+	for _, res := range results {
+		if res.Error != errNoMatchingFile {
+			t.Fatalf("unverified file %q is reused: %v", res.Path, res.Error)
+		}
+	}
+}
+
+func waitCrossSeed(t *testing.T, tor *Torrent) []CrossSeedFile {
+	deadline := time.Now().Add(timeout)
+	for {
+		results := tor.CrossSeedResults()
+		if results != nil {
+			return results
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("files are not reused")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCASStorage(t *testing.T) {
+	defer leaktest.Check(t)()
+	cfg := DefaultConfig
+	cfg.StorageType = "cas"
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+
+	var paths []string
+	for i := 0; i < 2; i++ {
+		tor := addTestTorrent(t, s, &AddTorrentOptions{ID: strconv.Itoa(i)})
+		copyTestData(t, tor)
+		startAndWaitComplete(t, tor)
+		paths = append(paths, filepath.Join(tor.torrent.storage.RootDir(), torrentName, "folder", "file2.txt"))
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		fi1, err1 := os.Stat(paths[0])
+		fi2, err2 := os.Stat(paths[1])
+		if err1 == nil && err2 == nil && os.SameFile(fi1, fi2) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("files are not deduplicated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for i := 0; i < 2; i++ {
+		err := s.RemoveTorrentWithOptions(strconv.Itoa(i), &RemoveTorrentOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var numObjects int
+	err := filepath.Walk(s.config.CASDir, func(path string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() {
+			numObjects++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if numObjects != 0 {
+		t.Fatalf("%d objects are not removed", numObjects)
+	}
+}
+
+func TestEncryptedStorage(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t)
+	defer cl()
+	cfg := DefaultConfig
+	cfg.StorageType = "encrypted"
+	cfg.EncryptionKey = strings.Repeat("ab", 32)
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+
+	tor := addTestTorrent(t, s, nil)
+	startAndWaitComplete(t, tor, addr)
+	plain, err := ioutil.ReadFile(filepath.Join(torrentDataDir, torrentName, "README"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := ioutil.ReadFile(filepath.Join(s.config.DataDir, tor.ID(), torrentName, "README"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, plain) {
+		t.Fatal("file is not encrypted")
+	}
+
+	// Encrypted files are verified with the same key after restart.
+	err = tor.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-tor.NotifyStop()
+	err = tor.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-tor.NotifyStop()
+	stats := tor.Stats()
+	if stats.Pieces.Have != stats.Pieces.Total {
+		t.Fatalf("verified %d of %d pieces", stats.Pieces.Have, stats.Pieces.Total)
+	}
+
+	// Encrypted files cannot be reused or moved without decrypting.
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, err = s.AddTorrent(f, &AddTorrentOptions{ID: "other", CrossSeed: true})
+	if err == nil {
+		t.Fatal("torrent is added with cross-seeding")
+	}
+	err = tor.Move("http://127.0.0.1:1")
+	if err == nil {
+		t.Fatal("encrypted torrent is moved")
+	}
+}
+
+func TestSeedFromArchive(t *testing.T) {
+	defer leaktest.Check(t)()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	dir, closeDir := tempdir(t)
+	defer closeDir()
+
+	err := CopyDir(filepath.Join(torrentDataDir, torrentName), filepath.Join(dir, torrentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Files that are not in testdata are zeros.
+	err = ioutil.WriteFile(filepath.Join(dir, torrentName, "data", "zero.bin"), make([]byte, 10<<20), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(dir, "data.tar")
+	err = exec.Command("tar", "-cf", archive, "-C", dir, torrentName).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor := addTestTorrent(t, s, &AddTorrentOptions{Archive: archive})
+	startAndWaitComplete(t, tor)
+	// Files are read from the archive without extracting.
+	_, err = os.Stat(filepath.Join(s.config.DataDir, tor.ID()))
+	if !os.IsNotExist(err) {
+		t.Fatal("files are extracted from the archive")
+	}
+	err = s.RemoveTorrent(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Archive requires metadata and cannot be cross-seeded.
+	_, err = s.AddURI(torrentMagnetLink, &AddTorrentOptions{Archive: archive})
+	if err == nil {
+		t.Fatal("magnet link is added with archive")
+	}
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, err = s.AddTorrent(f, &AddTorrentOptions{Archive: archive, CrossSeed: true})
+	if err == nil {
+		t.Fatal("archive is added with cross-seeding")
+	}
+}
+
+func TestSuperSeeding(t *testing.T) {
+	defer leaktest.Check(t)()
+	s1, closeSession1 := newTestSession(t)
+	defer closeSession1()
+	seed := addTestTorrent(t, s1, nil)
+	copyTestData(t, seed)
+	err := seed.SetSuperSeeding(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := startAndWaitListen(t, seed)
+	waitComplete(t, seed)
+	if !seed.Stats().SuperSeeding {
+		t.Fatal("super-seeding is not enabled")
+	}
+
+	isPieceInfo := func(msg interface{}) bool {
+		switch msg.(type) {
+		case peerprotocol.BitfieldMessage, peerprotocol.HaveAllMessage, peerprotocol.HaveNoneMessage, peerprotocol.HaveMessage:
+			return true
+		}
+		return false
+	}
+	// Seeder pretends to have no pieces and reveals a single piece.
+	fast := dialTestPeer(t, seed, addr, "127.0.0.2", true)
+	if msg := readTestMessage(t, fast, isPieceInfo); msg != (peerprotocol.HaveNoneMessage{}) {
+		t.Fatalf("unexpected first message: %#v", msg)
+	}
+	if msg, ok := readTestMessage(t, fast, isPieceInfo).(peerprotocol.HaveMessage); !ok {
+		t.Fatalf("unexpected message: %#v", msg)
+	}
+	// Bitfield is not sent to peers without fast extension.
+	slow := dialTestPeer(t, seed, addr, "127.0.0.3", false)
+	if msg, ok := readTestMessage(t, slow, isPieceInfo).(peerprotocol.HaveMessage); !ok {
+		t.Fatalf("unexpected first message: %#v", msg)
+	}
+	// Next piece is not revealed before the revealed piece is seen in the swarm.
+	select {
+	case msg := <-fast.Messages():
+		if isPieceInfo(msg) {
+			t.Fatalf("unexpected message: %#v", msg)
+		}
+	case <-time.After(500 * time.Millisecond):
+	}
+	// Revealed pieces are not passed between the test peers, so the download below would not finish with them.
+	fast.Close()
+	slow.Close()
+	for deadline := time.Now().Add(timeout); seed.Stats().Peers.Total > 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("test peers are not disconnected")
+		}
+	}
+
+	s2, closeSession2 := newTestSession(t)
+	defer closeSession2()
+	tor := addTestTorrent(t, s2, nil)
+	startAndWaitComplete(t, tor, addr)
+}
+
+func TestTrackerExchange(t *testing.T) {
+	defer leaktest.Check(t)()
+	trk := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("d8:intervali60e5:peers0:e"))
+	}))
+	defer trk.Close()
+	trackerURL := trk.URL + "/announce"
+
+	s1, closeSession1 := newTestSession(t)
+	defer closeSession1()
+	seed := addTestTorrent(t, s1, nil)
+	copyTestData(t, seed)
+	tr, err := s1.trackerManager.Get(trackerURL, time.Second, "", 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed.torrent.trackers = []tracker.Tracker{tr}
+	addr := startAndWaitListen(t, seed)
+	// Trackers are exchanged after they respond successfully.
+	waitTracker := func(tor *Torrent) bool {
+		for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			for _, tr := range tor.Trackers() {
+				if tr.URL == trackerURL && tr.Status == Working {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if !waitTracker(seed) {
+		t.Fatal("tracker is not working")
+	}
+
+	s2, closeSession2 := newTestSession(t)
+	defer closeSession2()
+	tor := addTestTorrent(t, s2, nil)
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !waitTracker(tor) {
+		t.Fatal("tracker is not received")
+	}
+}
+
+// dialTestPeer connects to the torrent at addr from localIP and completes the BitTorrent handshake.
+// Torrent does not accept more than one connection from an IP, so each peer must use a different loopback address.
+func dialTestPeer(t *testing.T, tor *Torrent, addr, localIP string, fast bool) *testPeer {
+	d := net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP(localIP)}, Timeout: timeout}
+	conn, err := d.Dial("tcp4", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ext [8]byte
+	bf, _ := bitfield.NewBytes(ext[:], 64)
+	bf.Set(43) // Extension Protocol (BEP 10)
+	if fast {
+		bf.Set(61) // Fast Extension (BEP 6)
+	}
+	var id [20]byte
+	_, _ = rand.Read(id[:])
+	err = conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := append([]byte("\x13BitTorrent protocol"), ext[:]...)
+	hs = append(hs, tor.torrent.InfoHash()...)
+	hs = append(hs, id[:]...)
+	_, err = conn.Write(hs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadFull(conn, make([]byte, len(hs)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.SetDeadline(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc := peerconn.New(conn, logger.New("test peer "+localIP), timeout, 10, fast, nil, nil)
+	go pc.Run()
+	return &testPeer{Conn: pc, local: conn.LocalAddr().(*net.TCPAddr)}
+}
+
+type testPeer struct {
+	*peerconn.Conn
+	// Address of the peer as seen by the torrent.
+	local *net.TCPAddr
+}
+
+// readTestMessage returns the next message from the peer that match returns true, skipping other messages.
+func readTestMessage(t *testing.T, pc *testPeer, match func(interface{}) bool) interface{} {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case msg, ok := <-pc.Messages():
+			if !ok {
+				t.Fatal("peer is disconnected")
+			}
+			if match(msg) {
+				return msg
+			}
+		case <-timer.C:
+			t.Fatal("message is not received")
+		}
+	}
+}
+
+func TestHolepunchRelay(t *testing.T) {
+	defer leaktest.Check(t)()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	tor := addTestTorrent(t, s, nil)
+	copyTestData(t, tor)
+	addr := startAndWaitListen(t, tor)
+
+	sendExtensionHandshake := func(pc *testPeer, holepunch bool) {
+		msg := peerprotocol.NewExtensionHandshake(0, "test", nil, 10, false)
+		if !holepunch {
+			delete(msg.M, peerprotocol.ExtensionKeyHolepunch)
+		}
+		pc.SendMessage(peerprotocol.ExtensionMessage{ExtendedMessageID: peerprotocol.ExtensionIDHandshake, Payload: msg})
+	}
+	sendRendezvous := func(pc *testPeer, target *net.TCPAddr) {
+		pc.SendMessage(peerprotocol.ExtensionMessage{
+			ExtendedMessageID: peerprotocol.ExtensionIDHolepunch,
+			Payload:           peerprotocol.ExtensionHolepunchMessage{Type: peerprotocol.ExtensionHolepunchMessageTypeRendezvous, Addr: target},
+		})
+	}
+	isHolepunch := func(msg interface{}) bool {
+		_, ok := msg.(peerprotocol.ExtensionHolepunchMessage)
+		return ok
+	}
+
+	// Holepunch messages from peers that did not send the extension handshake or do not support holepunch are ignored.
+	noHandshake := dialTestPeer(t, tor, addr, "127.0.0.2", true)
+	defer noHandshake.Close()
+	noSupport := dialTestPeer(t, tor, addr, "127.0.0.3", true)
+	defer noSupport.Close()
+	sendExtensionHandshake(noSupport, false)
+	a := dialTestPeer(t, tor, addr, "127.0.0.4", true)
+	defer a.Close()
+	sendExtensionHandshake(a, true)
+	b := dialTestPeer(t, tor, addr, "127.0.0.5", true)
+	defer b.Close()
+	sendExtensionHandshake(b, true)
+	sendRendezvous(noHandshake, a.local)
+	sendRendezvous(noSupport, a.local)
+
+	// Relay tells both peers to connect each other.
+	var msg peerprotocol.ExtensionHolepunchMessage
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); {
+		sendRendezvous(a, b.local)
+		msg = readTestMessage(t, a, isHolepunch).(peerprotocol.ExtensionHolepunchMessage)
+		// Relay may not have received the extension handshake of b yet.
+		if msg.Type != peerprotocol.ExtensionHolepunchMessageTypeError {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if msg.Type != peerprotocol.ExtensionHolepunchMessageTypeConnect || msg.Addr.String() != b.local.String() {
+		t.Fatalf("unexpected message to requester: %+v", msg)
+	}
+	msg = readTestMessage(t, b, isHolepunch).(peerprotocol.ExtensionHolepunchMessage)
+	if msg.Type != peerprotocol.ExtensionHolepunchMessageTypeConnect || msg.Addr.String() != a.local.String() {
+		t.Fatalf("unexpected message to target: %+v", msg)
+	}
+
+	// Target must support holepunch.
+	sendRendezvous(a, noSupport.local)
+	msg = readTestMessage(t, a, isHolepunch).(peerprotocol.ExtensionHolepunchMessage)
+	if msg.Type != peerprotocol.ExtensionHolepunchMessageTypeError || msg.ErrCode != peerprotocol.ExtensionHolepunchErrorNoSupport {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+	if n := tor.Stats().Holepunch.Relayed; n != 1 {
+		t.Fatalf("relayed %d times", n)
+	}
+}
+
+func TestExtensionHandshakeKeys(t *testing.T) {
+	defer leaktest.Check(t)()
+	cfg := DefaultConfig
+	cfg.TEXEnabled = false
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+
+	handshakeKeys := func(tor *Torrent, localIP string) map[string]uint8 {
+		addr := startAndWaitListen(t, tor)
+		pc := dialTestPeer(t, tor, addr, localIP, true)
+		defer pc.Close()
+		msg := readTestMessage(t, pc, func(msg interface{}) bool {
+			_, ok := msg.(peerprotocol.ExtensionHandshakeMessage)
+			return ok
+		})
+		return msg.(peerprotocol.ExtensionHandshakeMessage).M
+	}
+
+	// Disabled extensions are not advertised.
+	tor := addTestTorrent(t, s, nil)
+	m := handshakeKeys(tor, "127.0.0.2")
+	if _, ok := m[peerprotocol.ExtensionKeyTEX]; ok {
+		t.Fatal("tex is advertised while it is disabled")
+	}
+	if _, ok := m[peerprotocol.ExtensionKeyHolepunch]; !ok {
+		t.Fatal("holepunch is not advertised")
+	}
+
+	// Peers of private torrents cannot be connected via holepunch.
+	info, err := metainfo.NewInfoBytes("", []string{filepath.Join(torrentDataDir, torrentName)}, true, 16<<10, "", false, logger.New("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi, err := metainfo.NewBytes(info, nil, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := s.AddTorrent(bytes.NewReader(mi), &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = handshakeKeys(private, "127.0.0.3")
+	if _, ok := m[peerprotocol.ExtensionKeyHolepunch]; ok {
+		t.Fatal("holepunch is advertised for private torrent")
+	}
+}
+
+func TestTEXAfterMetadata(t *testing.T) {
+	defer leaktest.Check(t)()
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	mi, err := metainfo.New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	tor, err := s.AddURI(torrentMagnetLink, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := startAndWaitListen(t, tor)
+	pc := dialTestPeer(t, tor, addr, "127.0.0.2", true)
+	defer pc.Close()
+	isHandshake := func(msg interface{}) bool {
+		_, ok := msg.(peerprotocol.ExtensionHandshakeMessage)
+		return ok
+	}
+
+	// Torrent may be private until the metadata is downloaded.
+	msg := readTestMessage(t, pc, isHandshake).(peerprotocol.ExtensionHandshakeMessage)
+	if _, ok := msg.M[peerprotocol.ExtensionKeyTEX]; ok {
+		t.Fatal("tex is advertised before metadata is downloaded")
+	}
+	hs := peerprotocol.NewExtensionHandshake(uint32(len(mi.Info.Bytes)), "test", nil, 10, false)
+	pc.SendMessage(peerprotocol.ExtensionMessage{ExtendedMessageID: peerprotocol.ExtensionIDHandshake, Payload: hs})
+	for i := 0; i*16<<10 < len(mi.Info.Bytes); i++ {
+		req := readTestMessage(t, pc, func(msg interface{}) bool {
+			m, ok := msg.(peerprotocol.ExtensionMetadataMessage)
+			return ok && m.Type == peerprotocol.ExtensionMetadataMessageTypeRequest
+		}).(peerprotocol.ExtensionMetadataMessage)
+		begin := int(req.Piece) * 16 << 10
+		end := begin + 16<<10
+		if end > len(mi.Info.Bytes) {
+			end = len(mi.Info.Bytes)
+		}
+		pc.SendMessage(peerprotocol.ExtensionMessage{
+			ExtendedMessageID: peerprotocol.ExtensionIDMetadata,
+			Payload: peerprotocol.ExtensionMetadataMessage{
+				Type:      peerprotocol.ExtensionMetadataMessageTypeData,
+				Piece:     req.Piece,
+				TotalSize: len(mi.Info.Bytes),
+				Data:      mi.Info.Bytes[begin:end],
+			},
+		})
+	}
+
+	// Handshake is sent again after the torrent is known to be public.
+	msg = readTestMessage(t, pc, isHandshake).(peerprotocol.ExtensionHandshakeMessage)
+	if msg.M[peerprotocol.ExtensionKeyTEX] == 0 {
+		t.Fatal("tex is not advertised after metadata is downloaded")
+	}
+}
+
+func TestDHTNodesPersistence(t *testing.T) {
+	dc := dht.NewConfig()
+	dc.Address = "127.0.0.1"
+	dc.DHTRouters = ""
+	// All packets come from the same IP in test.
+	dc.ClientPerMinuteLimit = 1000
+	remote, err := dht.New(dc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = remote.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Stop()
+
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+	cfg := DefaultConfig
+	cfg.Database = filepath.Join(tmp, "session.db")
+	cfg.DataDir = tmp
+	cfg.PEXEnabled = false
+	cfg.RPCEnabled = false
+	cfg.DHTHost = "127.0.0.1"
+	cfg.DHTPort = 0
+	cfg.DHTIPv6Enabled = false
+	cfg.DHTBootstrapNodes = []string{"127.0.0.1:" + strconv.Itoa(remote.Port())}
+
+	waitReachable := func(s *Session) DHTTableStats {
+		var stats DHTStats
+		for i := 0; i < 50; i++ {
+			stats, err = s.DHTStats()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.IPv4.ReachableNodes > 0 {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		return stats.IPv4
+	}
+
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := waitReachable(s)
+	if stats.ReachableNodes != 1 {
+		t.Fatalf("bootstrap node is not reachable: %+v", stats)
+	}
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bootstrap node is not given. Node saved in previous run must be used.
+	cfg.DHTBootstrapNodes = nil
+	s, err = NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	stats2 := waitReachable(s)
+	if stats2.ReachableNodes != 1 {
+		t.Fatalf("saved node is not reachable: %+v", stats2)
+	}
+	if stats2.NodeID != stats.NodeID {
+		t.Fatalf("node id is not persisted: %s != %s", stats2.NodeID, stats.NodeID)
+	}
+}
+
+func TestUpdatableTorrent(t *testing.T) {
+	dc := dht.NewConfig()
+	dc.Address = "127.0.0.1"
+	dc.DHTRouters = ""
+	// All packets come from the same IP in test.
+	dc.ClientPerMinuteLimit = 1000
+	remote, err := dht.New(dc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = remote.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Stop()
+
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+	cfg := DefaultConfig
+	cfg.Database = filepath.Join(tmp, "session.db")
+	cfg.DataDir = tmp
+	cfg.PEXEnabled = false
+	cfg.RPCEnabled = false
+	cfg.DHTHost = "127.0.0.1"
+	cfg.DHTPort = 0
+	cfg.DHTIPv6Enabled = false
+	cfg.DHTItemTimeout = 500 * time.Millisecond
+	cfg.DHTBootstrapNodes = []string{"127.0.0.1:" + strconv.Itoa(remote.Port())}
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for i := 0; i < 50; i++ {
+		stats, _ := s.DHTStats()
+		if stats.IPv4.ReachableNodes > 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt := []byte("dataset")
+	ih1 := InfoHash{1}
+	ih2 := InfoHash{2}
+	err = s.PublishTorrent(key, salt, 1, ih1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := "magnet:?xs=urn:btpk:" + hex.EncodeToString(pub) + "&s=" + hex.EncodeToString(salt)
+	tor, err := s.AddURI(link, &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tor.InfoHash() != ih1 {
+		t.Fatalf("unexpected info hash: %s", tor.InfoHash())
+	}
+	m, err := tor.Magnet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(m, link[len("magnet:?"):]) {
+		t.Fatalf("public key is not in magnet link: %s", m)
+	}
+
+	err = s.PublishTorrent(key, salt, 2, ih2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.checkUpdatableTorrents()
+	torrents := s.ListTorrents()
+	if len(torrents) != 1 {
+		t.Fatalf("unexpected number of torrents: %d", len(torrents))
+	}
+	if torrents[0].InfoHash() != ih2 {
+		t.Fatalf("torrent is not updated: %s", torrents[0].InfoHash())
+	}
+	if torrents[0].torrent.storage.RootDir() != tor.torrent.storage.RootDir() {
+		t.Fatal("new version must be saved in the same directory")
+	}
+
+	// New versions cannot be verified when only trusted signers are allowed.
+	s.config.RequireTrustedSigner = true
+	err = s.updateTorrent(torrents[0], InfoHash{3}, 3)
+	if !errors.Is(err, errUntrustedTorrent) {
+		t.Fatalf("update must be rejected, got: %v", err)
+	}
+	torrents = s.ListTorrents()
+	if len(torrents) != 1 || torrents[0].InfoHash() != ih2 {
+		t.Fatal("torrent must not be updated")
+	}
+}
+
+func TestDHTCrawl(t *testing.T) {
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+	cfg := DefaultConfig
+	cfg.Database = filepath.Join(tmp, "session.db")
+	cfg.DataDir = tmp
+	cfg.RPCEnabled = false
+	cfg.DHTHost = "127.0.0.1"
+	cfg.DHTPort = 0
+	cfg.DHTIPv6Enabled = false
+	cfg.DHTBootstrapNodes = nil
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, _, err = s.DHTCrawlResults(0); err != errDHTCrawlNotRunning {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	metadataDir := filepath.Join(tmp, "metadata")
+	err = s.StartDHTCrawl(&DHTCrawlOptions{MetadataDir: metadataDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(metadataDir); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.StartDHTCrawl(nil); err != errDHTCrawlRunning {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = s.StopDHTCrawl()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := s.DHTCrawlStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Running {
+		t.Fatal("crawl is still running")
+	}
+	ihs, next, err := s.DHTCrawlResults(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ihs) != 0 || next != 0 {
+		t.Fatalf("unexpected results: %v %d", ihs, next)
+	}
+	// A new crawl can be started after the previous one is stopped.
+	err = s.StartDHTCrawl(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDHTCrawlMetadata(t *testing.T) {
+	defer leaktest.Check(t)()
+	addr, cl := seeder(t)
+	defer cl()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	dir, closeDir := tempdir(t)
+	defer closeDir()
+
+	mi, err := ioutil.ReadFile(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm, err := metainfo.New(bytes.NewReader(mi))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ih := dht.InfoHash(tm.Info.Hash[:])
+	errC := make(chan error, 1)
+	go func() { errC <- s.fetchMetadata(ih, dir, make(chan struct{})) }()
+	for {
+		s.mMetadataFetches.Lock()
+		n := len(s.metadataFetches[ih])
+		s.mMetadataFetches.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	tcpAddr, err := net.ResolveTCPAddr("tcp4", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact := append([]byte(tcpAddr.IP.To4()), byte(tcpAddr.Port>>8), byte(tcpAddr.Port))
+	s.sendMetadataFetchPeers(ih, []string{string(compact)})
+	if err = <-errC; err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, ih.String()+".torrent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetched, err := metainfo.New(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetched.Info.Hash != tm.Info.Hash {
+		t.Fatal("info hash does not match")
+	}
+	// Metadata is fetched without adding a torrent to the session.
+	if n := len(s.ListTorrents()); n != 0 {
+		t.Fatalf("torrents in session: %d", n)
+	}
+	s.mMetadataFetches.Lock()
+	n := len(s.metadataFetches)
+	s.mMetadataFetches.Unlock()
+	if n != 0 {
+		t.Fatalf("metadata fetches: %d", n)
+	}
+}
+
+func TestSignedTorrent(t *testing.T) {
+	tmp, closeTmp := tempdir(t)
+	defer closeTmp()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(tmp, "cert.pem")
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig
+	cfg.TrustedSigners = []string{certFile}
+	cfg.RequireTrustedSigner = true
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+
+	f, err := os.Open(torrentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	mi, err := metainfo.New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.AddTorrent(f, nil)
+	if !errors.Is(err, errUntrustedTorrent) {
+		t.Fatalf("unsigned torrent must be rejected, got: %v", err)
+	}
+	_, err = s.AddURI(torrentMagnetLink, nil)
+	if !errors.Is(err, errUntrustedTorrent) {
+		t.Fatalf("magnet link must be rejected, got: %v", err)
+	}
+
+	sig, err := metainfo.Sign(mi.Info.Bytes, "com.example", key, cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := *sig
+	tampered.Signature = append([]byte{}, sig.Signature...)
+	tampered.Signature[len(tampered.Signature)-1] ^= 1
+	b, err := metainfo.NewBytes(mi.Info.Bytes, nil, nil, "", []metainfo.Signature{tampered})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.AddTorrent(bytes.NewReader(b), &AddTorrentOptions{Stopped: true})
+	if err == nil || errors.Is(err, errUntrustedTorrent) {
+		t.Fatalf("torrent with invalid signature must be rejected, got: %v", err)
+	}
+
+	b, err = metainfo.NewBytes(mi.Info.Bytes, nil, nil, "", []metainfo.Signature{*sig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor, err := s.AddTorrent(bytes.NewReader(b), &AddTorrentOptions{Stopped: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Signer is the identity in the certificate, not the key chosen by the creator of the torrent.
+	if signer := tor.Stats().Signer; signer != "example.com" {
+		t.Fatalf("unexpected signer: %q", signer)
+	}
+	b, err = tor.Torrent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi2, err := metainfo.New(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mi2.Signatures) != 1 || mi2.Signatures[0].Verify(mi2.Info.Bytes) != nil {
+		t.Fatal("signature is not preserved")
+	}
+}
+
+func waitStatus(t *testing.T, tor *Torrent, status Status) {
+	deadline := time.Now().Add(timeout)
+	for tor.Stats().Status != status {
+		if time.Now().After(deadline) {
+			t.Fatalf("torrent status is %s, expected %s", tor.Stats().Status, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDiskSpaceLow(t *testing.T) {
+	defer leaktest.Check(t)()
+	free := int64(1 << 40)
+	diskFree = func(string) (int64, error) { return atomic.LoadInt64(&free), nil }
+	defer func() { diskFree = diskspace.Free }()
+	addr, cl := seeder(t)
+	defer cl()
+	cfg := DefaultConfig
+	cfg.DiskSpaceCheckInterval = 50 * time.Millisecond
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+
+	atomic.StoreInt64(&free, cfg.DiskSpaceLowWaterMark-1)
+	tor := addTestTorrent(t, s, nil)
+	err := tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, tor, DiskFull)
+	time.Sleep(200 * time.Millisecond)
+	if st := tor.Stats(); st.Status != DiskFull || st.Bytes.Completed != 0 {
+		t.Fatalf("download must be paused, status: %s, completed: %d", st.Status, st.Bytes.Completed)
+	}
+
+	// Downloading is resumed when free space is above the low-water mark, even if it is not enough for the whole torrent.
+	atomic.StoreInt64(&free, cfg.DiskSpaceLowWaterMark+1)
+	waitStatus(t, tor, Downloading)
+	if err = tor.Stats().Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fullStorage fails writes with ENOSPC while full is set.
+type fullStorage struct {
+	storage.Storage
+	full *int32
+	free *int64
+}
+
+func (s fullStorage) Open(name string, size int64) (storage.File, bool, error) {
+	f, exists, err := s.Storage.Open(name, size)
+	if err != nil {
+		return nil, false, err
+	}
+	return fullFile{File: f, s: s}, exists, nil
+}
+
+type fullFile struct {
+	storage.File
+	s fullStorage
+}
+
+func (f fullFile) WriteAt(p []byte, off int64) (int, error) {
+	if atomic.LoadInt32(f.s.full) == 1 {
+		atomic.StoreInt64(f.s.free, 0)
+		return 0, &os.PathError{Op: "write", Path: "test", Err: syscall.ENOSPC}
+	}
+	return f.File.WriteAt(p, off)
+}
+
+func TestDiskFullWriteError(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("ENOSPC is not reported on windows")
+	}
+	defer leaktest.Check(t)()
+	free := int64(1 << 40)
+	diskFree = func(string) (int64, error) { return atomic.LoadInt64(&free), nil }
+	defer func() { diskFree = diskspace.Free }()
+	addr, cl := seeder(t)
+	defer cl()
+	cfg := DefaultConfig
+	cfg.DiskSpaceCheckInterval = 50 * time.Millisecond
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+
+	tor := addTestTorrent(t, s, nil)
+	full := int32(1)
+	tor.torrent.storage = fullStorage{Storage: tor.torrent.storage, full: &full, free: &free}
+	err := tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Torrent is paused instead of stopping with an error.
+	waitStatus(t, tor, DiskFull)
+	if err = tor.Stats().Error; err != nil {
+		t.Fatal(err)
+	}
+
+	atomic.StoreInt32(&full, 0)
+	// Downloading is resumed when free space is above the low-water mark, even if it is not enough for the whole torrent.
+	atomic.StoreInt64(&free, cfg.DiskSpaceLowWaterMark+1)
+	waitStatus(t, tor, Downloading)
+	if err = tor.Stats().Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecheckModifiedFiles(t *testing.T) {
+	defer leaktest.Check(t)()
+	cfg := DefaultConfig
+	cfg.ResumeWriteInterval = 50 * time.Millisecond
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+	dataDir, closeDataDir := tempdir(t)
+	defer closeDataDir()
+
+	tor := addTestTorrent(t, s, &AddTorrentOptions{DataDir: dataDir})
+	copyTestData(t, tor)
+	startAndWaitComplete(t, tor)
+
+	// File stats are saved periodically while the torrent is running.
+	deadline := time.Now().Add(timeout)
+	for {
+		spec, err := s.resumer.Read(tor.ID())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(spec.FileStats) == len(tor.torrent.info.Files) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("file stats are not saved")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	err := tor.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, tor, Stopped)
+
+	// Change the modification time of a file in the first piece.
+	touched := filepath.Join(dataDir, torrentName, "data", "file2.bin")
+	future := time.Now().Add(time.Hour)
+	err = os.Chtimes(touched, future, future)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Corrupt a file in another piece without changing its stats. It must not be checked.
+	corrupted := filepath.Join(dataDir, torrentName, "data", "zero.bin")
+	fi, err := os.Stat(corrupted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf, err := os.OpenFile(corrupted, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cf.WriteAt([]byte{1}, fi.Size()-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf.Close()
+	err = os.Chtimes(corrupted, fi.ModTime(), fi.ModTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tor.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, tor, Seeding)
+	st := tor.Stats()
+	if len(st.ModifiedFiles) != 1 || !strings.HasSuffix(st.ModifiedFiles[0], "file2.bin") {
+		t.Fatalf("unexpected modified files: %v", st.ModifiedFiles)
+	}
+	if st.Pieces.Have != st.Pieces.Total {
+		t.Fatalf("only pieces of modified files must be checked, have %d of %d pieces", st.Pieces.Have, st.Pieces.Total)
+	}
+}
+
+func TestScrubCorruptedPiece(t *testing.T) {
+	defer leaktest.Check(t)()
+	scrubCheckInterval = 50 * time.Millisecond
+	defer func() { scrubCheckInterval = time.Minute }()
+	addr, cl := seeder(t)
+	defer cl()
+	cfg := DefaultConfig
+	cfg.ScrubEnabled = true
+	cfg.ScrubSpeedLimit = 0
+	s, closeSession := newTestSessionConfig(t, cfg)
+	defer closeSession()
+	dataDir, closeDataDir := tempdir(t)
+	defer closeDataDir()
+
+	tor := addTestTorrent(t, s, &AddTorrentOptions{DataDir: dataDir})
+	copyTestData(t, tor)
+	startAndWaitComplete(t, tor)
+
+	// Corrupt the first piece while seeding.
+	corrupted := filepath.Join(dataDir, torrentName, "data", "file1.bin")
+	orig, err := ioutil.ReadFile(corrupted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := append([]byte(nil), orig...)
+	b[0]++
+	err = ioutil.WriteFile(corrupted, b, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Piece is marked as missing and the torrent is not seeding anymore.
+	waitStatus(t, tor, Downloading)
+	st := tor.Stats()
+	if st.Pieces.Missing != 1 || st.Scrub.Failed != 1 {
+		t.Fatalf("missing pieces: %d, scrub failures: %d", st.Pieces.Missing, st.Scrub.Failed)
+	}
+	if st.SeededFor == 0 {
+		t.Fatal("seeding duration is not counted")
+	}
+
+	// Piece is downloaded again.
+	err = tor.AddPeer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, tor, Seeding)
+	b, err = ioutil.ReadFile(corrupted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, orig) {
+		t.Fatal("corrupted piece is not repaired")
+	}
+}
+
+func TestInvalidVerificationConfig(t *testing.T) {
+	cfg := DefaultConfig
+	cfg.ParallelVerifications = 0
+	_, err := NewSession(cfg)
+	if err == nil {
+		t.Fatal("session is created with zero parallel verifications")
+	}
+	cfg = DefaultConfig
+	cfg.VerificationWorkers = 0
+	_, err = NewSession(cfg)
+	if err == nil {
+		t.Fatal("session is created with zero verification workers")
+	}
+}
+
+func TestSetLocation(t *testing.T) {
+	defer leaktest.Check(t)()
+	s, closeSession := newTestSession(t)
+	defer closeSession()
+	dataDir, closeDataDir := tempdir(t)
+	defer closeDataDir()
+
+	tor := addTestTorrent(t, s, &AddTorrentOptions{DataDir: dataDir})
+	copyTestData(t, tor)
+	startAndWaitComplete(t, tor)
+
+	newDir := filepath.Join(dataDir, "new")
+	err := tor.SetLocation(newDir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Torrent is started again after files are moved.
+	waitStatus(t, tor, Seeding)
+	if st := tor.Stats(); st.Error != nil {
+		t.Fatal(st.Error)
+	}
+	for _, name := range []string{"data/file1.bin", "folder/file2.txt"} {
+		if _, err = os.Stat(filepath.Join(newDir, torrentName, name)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = os.Stat(filepath.Join(dataDir, torrentName, name)); !os.IsNotExist(err) {
+			t.Fatalf("file is not removed from old location: %s", name)
+		}
+	}
+	spec, err := s.resumer.Read(tor.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Dest != newDir {
+		t.Fatalf("new location is not saved: %s", spec.Dest)
+	}
+
+	// Files are verified at the new location without moving and the torrent continues seeding.
+	err = os.Rename(newDir, filepath.Join(dataDir, "other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tor.SetLocation(filepath.Join(dataDir, "other"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, tor, Seeding)
+	if st := tor.Stats(); st.Error != nil || st.Bytes.Completed != st.Bytes.Total {
+		t.Fatalf("torrent is not seeding after verification: %+v", st)
+	}
+}
+
+func TestMoveToTrashAcrossDevices(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("tmpfs is required")
+	}
+	src, closeSrc := tempdir(t)
+	defer closeSrc()
+	// Files cannot be renamed from the temp dir on disk to tmpfs.
+	trash, err := ioutil.TempDir("/dev/shm", "rain-trash-")
+	if err != nil {
+		t.Skip("tmpfs is not available:", err)
+	}
+	defer os.RemoveAll(trash)
+
+	err = CopyDir(filepath.Join(torrentDataDir, torrentName), filepath.Join(src, torrentName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(trash, "id.1")
+	err = moveToTrash(filepath.Join(src, torrentName), dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(filepath.Join(src, torrentName))
+	if !os.IsNotExist(err) {
+		t.Fatal("source is not removed")
+	}
+	assertTestData(t, dest)
+}
@@ -0,0 +1,109 @@
+package torrent
+
+import (
+	"github.com/cenkalti/rain/internal/announcer"
+	"github.com/cenkalti/rain/internal/peer"
+	"github.com/cenkalti/rain/internal/peerprotocol"
+	"github.com/cenkalti/rain/internal/tracker"
+)
+
+const (
+	// Maximum number of tracker URLs that are handled in a single tracker exchange message.
+	texMaxTrackersPerMessage = 10
+	// Maximum number of tracker URLs that are handled for a torrent. Protects us from peers sending lots of junk URLs.
+	texMaxTrackers = 100
+)
+
+// texEnabled returns true if trackers can be exchanged for the torrent.
+// Trackers of private torrents are never exchanged. Until we get info, we cannot know if the torrent is private.
+func (t *torrent) texEnabled() bool {
+	return t.session.config.TEXEnabled && t.info != nil && !t.info.Private
+}
+
+// texTrackerURLs returns the URLs of trackers that have responded successfully.
+func (t *torrent) texTrackerURLs() []string {
+	if !t.texEnabled() {
+		return nil
+	}
+	var urls []string
+	for _, an := range t.announcers {
+		if an.Stats().Status == announcer.Working {
+			urls = append(urls, an.Tracker.URL())
+		}
+	}
+	return urls
+}
+
+// sendTEXAll sends the trackers to all peers that support the tracker exchange extension.
+func (t *torrent) sendTEXAll() {
+	urls := t.texTrackerURLs()
+	if len(urls) == 0 {
+		return
+	}
+	for pe := range t.peers {
+		if pe.TEXEnabled() {
+			t.sendTEX(pe, urls)
+		}
+	}
+}
+
+// sendTEX sends the trackers that are not sent to the peer before.
+func (t *torrent) sendTEX(pe *peer.Peer, urls []string) {
+	var added []string
+	for _, u := range urls {
+		if _, ok := pe.SentTrackers[u]; ok {
+			continue
+		}
+		pe.SentTrackers[u] = struct{}{}
+		added = append(added, u)
+	}
+	if len(added) == 0 {
+		return
+	}
+	pe.SendMessage(peerprotocol.ExtensionMessage{
+		ExtendedMessageID: pe.ExtensionHandshake.M[peerprotocol.ExtensionKeyTEX],
+		Payload:           peerprotocol.ExtensionTEXMessage{Added: added},
+	})
+}
+
+func (t *torrent) handleTEXMessage(pe *peer.Peer, msg peerprotocol.ExtensionTEXMessage) {
+	// Save tex messages for processesing later received while we don't have info yet.
+	if t.info == nil {
+		pe.Messages = append(pe.Messages, msg)
+		return
+	}
+	if !t.texEnabled() {
+		return
+	}
+	known := make(map[string]struct{}, len(t.trackers))
+	for _, tr := range t.trackers {
+		known[tr.URL()] = struct{}{}
+	}
+	added := msg.Added
+	if len(added) > texMaxTrackersPerMessage {
+		added = added[:texMaxTrackersPerMessage]
+	}
+	var trackers []tracker.Tracker
+	for _, u := range added {
+		if len(t.texReceived) >= texMaxTrackers {
+			break
+		}
+		if _, ok := known[u]; ok {
+			continue
+		}
+		if _, ok := t.texReceived[u]; ok {
+			continue
+		}
+		t.texReceived[u] = struct{}{}
+		tr, err := t.session.trackerManager.Get(u, t.session.config.TrackerHTTPTimeout, t.session.getTrackerUserAgent(false), int64(t.session.config.TrackerHTTPMaxResponseSize))
+		if err != nil {
+			pe.Logger().Debugln("invalid tracker received via tracker exchange:", u, err)
+			continue
+		}
+		pe.Logger().Debugln("new tracker received via tracker exchange:", u)
+		trackers = append(trackers, tr)
+	}
+	if len(trackers) > 0 {
+		go t.AddTrackers(trackers)
+	}
+}
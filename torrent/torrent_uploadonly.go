@@ -0,0 +1,78 @@
+package torrent
+
+import (
+	"github.com/cenkalti/rain/internal/peer"
+	"github.com/cenkalti/rain/internal/peerprotocol"
+)
+
+// uploadOnly returns true if we are not going to download pieces from peers.
+// A torrent is upload-only after it is completed and while downloads are paused because of low disk space.
+func (t *torrent) uploadOnly() bool {
+	return t.completed || t.diskFull
+}
+
+// updateUploadOnly tells connected peers if upload-only status of the torrent has changed.
+// Upload-only peers are disconnected if the torrent is completed.
+func (t *torrent) updateUploadOnly() {
+	uploadOnly := t.uploadOnly()
+	if uploadOnly == t.uploadOnlySent {
+		return
+	}
+	t.uploadOnlySent = uploadOnly
+	for pe := range t.peers {
+		if t.closeUploadOnlyPeer(pe) {
+			continue
+		}
+		if pe.ExtensionsEnabled {
+			t.sendExtensionHandshake(pe)
+		}
+	}
+}
+
+// closeUploadOnlyPeer closes the connection to the peer if both sides are seeding because no data can be transferred between them.
+func (t *torrent) closeUploadOnlyPeer(pe *peer.Peer) bool {
+	if !t.completed || !pe.UploadOnly() {
+		return false
+	}
+	pe.Logger().Debugln("closing connection to upload-only peer")
+	t.closePeer(pe)
+	return true
+}
+
+// sendDontHave tells the peers that we do not have the piece anymore.
+func (t *torrent) sendDontHave(i uint32) {
+	for pe := range t.peers {
+		if !pe.DontHaveEnabled() {
+			continue
+		}
+		pe.SendMessage(peerprotocol.ExtensionMessage{
+			ExtendedMessageID: pe.ExtensionHandshake.M[peerprotocol.ExtensionKeyDontHave],
+			Payload:           peerprotocol.ExtensionDontHaveMessage{Index: i},
+		})
+	}
+}
+
+func (t *torrent) handleDontHave(pe *peer.Peer, msg peerprotocol.ExtensionDontHaveMessage) {
+	// Save donthave messages for processesing later received while we don't have info yet.
+	if t.pieces == nil || t.bitfield == nil {
+		pe.Messages = append(pe.Messages, msg)
+		return
+	}
+	if msg.Index >= t.info.NumPieces {
+		pe.Logger().Errorln("unexpected piece index:", msg.Index)
+		t.closePeer(pe)
+		return
+	}
+	if t.piecePicker != nil {
+		t.piecePicker.HandleDontHave(pe, msg.Index)
+	} else {
+		pe.Bitfield.Clear(msg.Index)
+	}
+	// Stop downloading the piece because the peer is going to reject the requests.
+	if pd, ok := t.pieceDownloaders[pe]; ok && pd.Piece.Index == msg.Index {
+		t.closePieceDownloader(pd)
+		pd.CancelPending()
+	}
+	t.updateInterestedState(pe)
+	t.startPieceDownloaderFor(pe)
+}
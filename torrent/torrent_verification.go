@@ -31,7 +31,17 @@ func (t *torrent) handleVerificationDone(ve *verifier.Verifier) {
 
 	// Now we have a constructed and verified bitfield.
 	t.mBitfield.Lock()
-	t.bitfield = ve.Bitfield
+	if t.recheckPieces != nil {
+		// Only pieces of modified files are checked. Others are taken from resume db.
+		for _, p := range t.recheckPieces {
+			if ve.Bitfield.Test(p.Index) {
+				t.bitfield.Set(p.Index)
+			}
+		}
+		t.recheckPieces = nil
+	} else {
+		t.bitfield = ve.Bitfield
+	}
 	t.mBitfield.Unlock()
 
 	// Save the bitfield to resume db.
@@ -58,14 +68,20 @@ func (t *torrent) handleVerificationDone(ve *verifier.Verifier) {
 	}
 
 	if t.doVerify {
-		// Stop after manual verification command.
 		t.doVerify = false
-		t.stop(nil)
-		return
+		if !t.verifyRestart {
+			// Stop after manual verification command.
+			t.stop(nil)
+			return
+		}
+		t.verifyRestart = false
 	}
 
 	// Tell connected peers that pieces we have.
 	for pe := range t.peers {
+		if pe.SuperSeeding {
+			continue
+		}
 		for _, msg := range haveMessages {
 			pe.SendMessage(msg)
 		}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/cenkalti/rain/internal/diskspace"
 	"github.com/cenkalti/rain/internal/peer"
 	"github.com/cenkalti/rain/internal/peerprotocol"
 	"github.com/cenkalti/rain/internal/piecewriter"
@@ -35,6 +36,10 @@ func (t *torrent) handlePieceWriteDone(pw *piecewriter.PieceWriter) {
 		return
 	}
 	if pw.Error != nil {
+		if diskspace.IsFull(pw.Error) {
+			t.pauseDownloads(pw.Error)
+			return
+		}
 		t.stop(pw.Error)
 		return
 	}